@@ -31,6 +31,7 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -88,6 +89,20 @@ func readKarLog() {
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
+		if strings.HasPrefix(line, "{") { // -log_format json
+			var entry struct {
+				Timestamp time.Time `json:"timestamp"`
+				Level     string    `json:"level"`
+				Msg       string    `json:"msg"`
+			}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				panic(fmt.Errorf("Can't parse log entry %v: %v", line, err))
+			}
+			if entry.Level == "INFO" && strings.Contains(entry.Msg, "processing messages") {
+				processing = append(processing, entry.Timestamp)
+			}
+			continue
+		}
 		msg := strings.Split(line, "[INFO]")
 		if len(msg) == 2 {
 			ts, err := time.Parse("2006/01/02 15:04:05", strings.TrimSpace(msg[0]))
@@ -18,6 +18,7 @@
 package config
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
@@ -53,6 +54,8 @@ const (
 	PurgeCmd = "purge"
 	// DrainCmd is the command "drain"
 	DrainCmd = "drain"
+	// LogLevelCmd is the command "loglevel"
+	LogLevelCmd = "loglevel"
 	// VersionCmd is the command "version"
 	VersionCmd = "version"
 	// HelpCmd is the command "help"
@@ -112,6 +115,12 @@ var (
 	// MissingComponentTimeout is how long to wait on a missing service or actor type before timing out and returning an error.
 	MissingComponentTimeout time.Duration
 
+	// TracingExporter is the OpenTelemetry trace exporter (otlp, stdout, or file), "" disables the export of spans
+	TracingExporter string
+
+	// TracingEndpoint is the URL of the OTLP collector or the path of the file for the file exporter
+	TracingEndpoint string
+
 	// GetSystemComponent describes what system information to get
 	GetSystemComponent string
 
@@ -124,10 +133,25 @@ var (
 	// GetActorInstanceID is an actor instance whose state will be read
 	GetActorInstanceID string
 
+	// GetPath restrict reminder and subscription gets to a specific actor method
+	GetPath string
+
+	// GetTopic restrict subscription gets to a specific topic
+	GetTopic string
+
+	// GetBefore and GetAfter restrict reminder gets to a range of next fire times (time or duration from now)
+	GetBefore, GetAfter string
+
 	// GetOutputStyle is whether to print a human readable output, or return a JSON string of data.
 	// Currently only applies to calling system/information/
 	GetOutputStyle string
 
+	// LogLevelComponent is the component whose log verbosity to set ("" for the log itself)
+	LogLevelComponent string
+
+	// LogLevelSidecar is the sidecar whose log verbosity to get or set ("" for all sidecars)
+	LogLevelSidecar string
+
 	// RestBodyContentType specifies the content type of the request body
 	RestBodyContentType string
 
@@ -136,6 +160,9 @@ var (
 
 	// temporary variables to parse command line options
 	kafkaBrokers, verbosity, configDir, actorTypes, redisCABase64 string
+	logFormat                                                     string
+	kafkaCABase64, kafkaCertBase64, kafkaKeyBase64                string
+	kafkaTokenFile, redisAddresses                                string
 	topicConfig                                                   = map[string]*string{"retention.ms": strptr("900000"), "segment.ms": strptr("300000")}
 
 	// enable cache for actor placement
@@ -152,8 +179,13 @@ func globalOptions(f *flag.FlagSet) {
 	f.BoolVar(&KafkaConfig.EnableTLS, "kafka_enable_tls", false, "Use TLS to communicate with Kafka")
 	f.StringVar(&KafkaConfig.User, "kafka_username", "", "The SASL username if any")
 	f.StringVar(&KafkaConfig.Password, "kafka_password", "", "The SASL password if any")
+	f.StringVar(&KafkaConfig.Mechanism, "kafka_sasl_mechanism", "", "The SASL mechanism: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512, or OAUTHBEARER (default PLAIN)")
+	f.StringVar(&kafkaTokenFile, "kafka_token_file", "", "The file containing the SASL/OAUTHBEARER access token (reread when modified)")
 	f.StringVar(&KafkaConfig.Version, "kafka_version", "", "Kafka cluster version")
 	f.BoolVar(&KafkaConfig.TLSSkipVerify, "kafka_tls_skip_verify", false, "Skip server name verification for Kafka when connecting over TLS")
+	f.StringVar(&kafkaCABase64, "kafka_ca_cert", "", "The base64-encoded Kafka CA certificate bundle if any")
+	f.StringVar(&kafkaCertBase64, "kafka_client_cert", "", "The base64-encoded client certificate for mutual TLS with Kafka if any")
+	f.StringVar(&kafkaKeyBase64, "kafka_client_key", "", "The base64-encoded client private key for mutual TLS with Kafka if any")
 	f.BoolVar(&IsDebugMode, "debug", false, "Allow debugging (slower)")
 	f.Func("kafka_topic_config", "Kafka topic config: k1=v1,k2=v2,...", func(arg string) error {
 		for _, x := range strings.Split(arg, ",") {
@@ -166,6 +198,7 @@ func globalOptions(f *flag.FlagSet) {
 		return nil
 	})
 
+	f.StringVar(&RedisConfig.Backend, "store_backend", "", "The store backend: redis or memory (default redis)")
 	f.StringVar(&RedisConfig.Host, "redis_host", "", "The Redis host")
 	f.IntVar(&RedisConfig.Port, "redis_port", 0, "The Redis port")
 	f.BoolVar(&RedisConfig.EnableTLS, "redis_enable_tls", false, "Use TLS to communicate with Redis")
@@ -173,11 +206,16 @@ func globalOptions(f *flag.FlagSet) {
 	f.StringVar(&RedisConfig.User, "redis_user", "", "The user to use to connect to the Redis server")
 	f.BoolVar(&RedisConfig.TLSSkipVerify, "redis_tls_skip_verify", false, "Skip server name verification for Redis when connecting over TLS")
 	f.StringVar(&redisCABase64, "redis_ca_cert", "", "The base64-encoded Redis CA certificate if any")
+	f.StringVar(&RedisConfig.Mode, "redis_mode", "", "The Redis mode: standalone, sentinel, or cluster (default standalone)")
+	f.StringVar(&redisAddresses, "redis_addresses", "", "The Redis sentinels (sentinel mode) or cluster seed nodes (cluster mode) as a comma separated list of host:port (default redis_host:redis_port)")
+	f.StringVar(&RedisConfig.MasterName, "redis_master_name", "", "The name of the Redis master monitored by the sentinels (default mymaster)")
+	f.StringVar(&RedisConfig.SentinelPassword, "redis_sentinel_password", "", "The password to use to connect to the Redis sentinels if any")
 
 	f.DurationVar(&RequestRetryLimit, "request_retry_limit", -1*time.Second, "Time limit on retrying failing redis/http connections (<0 is infinite)")
 	f.DurationVar(&RedisConfig.LongOperation, "redis_slow_op_threshold", 1*time.Second, "Threshold for reporting long-running redis operations")
 
 	f.StringVar(&verbosity, "v", "error", "Logging verbosity")
+	f.StringVar(&logFormat, "log_format", "", "Logging format [text|json] (default text)")
 
 	f.StringVar(&configDir, "config_dir", "", "Directory containing configuration files")
 
@@ -187,17 +225,23 @@ func globalOptions(f *flag.FlagSet) {
 func init() {
 	var err error
 
+	// unit tests of the packages importing config do not run a command
+	if strings.HasSuffix(os.Args[0], ".test") {
+		return
+	}
+
 	usage := `kar COMMAND ...
 
 Available commands:
-  run     run application component
-  get     query running application
-  invoke  invoke actor instance
-  rest    perform a REST operation on a service endpoint
-  purge   purge application messages and state
-  drain   drain application messages
-  version print version
-  help    print help message`
+  run      run application component
+  get      query running application
+  invoke   invoke actor instance
+  rest     perform a REST operation on a service endpoint
+  purge    purge application messages and state
+  drain    drain application messages
+  loglevel get or set the log verbosity of running sidecars
+  version  print version
+  help     print help message`
 
 	description := `Use "kar COMMAND -h" for more information about a command`
 
@@ -250,14 +294,21 @@ Available commands:
 		flag.DurationVar(&KafkaConfig.SessionBusyTimeout, "actor_busy_timeout", 2*time.Minute, "Time to wait on a busy actor before timing out (0 is infinite)")
 		flag.DurationVar(&MissingComponentTimeout, "missing_component_timeout", 2*time.Minute, "Time to wait on request to unknown service or actor type before timing out (0 is infinite)")
 		flag.BoolVar(&KafkaConfig.Cancellation, "cancel", false, "Cancel a pending call if the caller has failed")
+		flag.BoolVar(&KafkaConfig.Local, "local", false, "Run in a single process without Kafka and Redis (for local development)")
+		flag.StringVar(&TracingExporter, "tracing_exporter", "", "The OpenTelemetry trace exporter [otlp|stdout|file] (tracing is disabled if empty)")
+		flag.StringVar(&TracingEndpoint, "tracing_endpoint", "", "The OTLP collector URL or the output file of the file trace exporter")
 
 	case GetCmd:
 		usage = "kar get [OPTIONS]"
 		description = "Inspect state of an active application"
-		flag.StringVar(&GetSystemComponent, "s", "actors", "Subsystem to query [actors|sidecars]")
+		flag.StringVar(&GetSystemComponent, "s", "actors", "Subsystem to query [actors|sidecars|reminders|subscriptions]")
 		flag.BoolVar(&GetResidentOnly, "mr", false, "Only include memory-resident actor instances")
 		flag.StringVar(&GetActorType, "t", "", "Type of the actor instance to get")
 		flag.StringVar(&GetActorInstanceID, "i", "", "Instance id of a single actor whose state to get")
+		flag.StringVar(&GetPath, "path", "", "Actor method of the reminders or subscriptions to get")
+		flag.StringVar(&GetTopic, "topic", "", "Topic of the subscriptions to get")
+		flag.StringVar(&GetBefore, "before", "", "Only get reminders due before this time or duration from now (e.g. 1h)")
+		flag.StringVar(&GetAfter, "after", "", "Only get reminders due after this time or duration from now")
 		flag.StringVar(&GetOutputStyle, "o", "", "Output style of information calls. 'json' for JSON formatting")
 
 	case InvokeCmd:
@@ -280,6 +331,13 @@ Available commands:
 		usage = "kar drain [OPTIONS]"
 		description = "Drain application messages"
 
+	case LogLevelCmd:
+		usage = "kar loglevel [OPTIONS] [LEVEL]"
+		description = "Get or set the log verbosity of running sidecars\n\nLEVEL is one of fatal, error, warning, info, or debug.\nUse LEVEL default with -c to restore the verbosity of the log for the component."
+		flag.StringVar(&LogLevelComponent, "c", "", "Component whose verbosity to set [rpc|store|reminders|events|debug] (default the whole log)")
+		flag.StringVar(&LogLevelSidecar, "sidecar", "", "Id of the sidecar whose verbosity to get or set (default all sidecars)")
+		flag.StringVar(&GetOutputStyle, "o", "", "Output style of information calls. 'json' for JSON formatting")
+
 	case VersionCmd:
 		fmt.Println(Version)
 		os.Exit(0)
@@ -328,6 +386,15 @@ Available commands:
 	logger.SetVerbosity(verbosity)
 	logger.SetOutput(os.Stdout)
 
+	if logFormat == "" {
+		if logFormat = os.Getenv("KAR_LOG_FORMAT"); logFormat == "" {
+			logFormat = loadStringFromConfig(configDir, "log_format")
+		}
+	}
+	if err := logger.SetFormat(logFormat); err != nil {
+		logger.Fatal("%v", err)
+	}
+
 	if AppName == "" {
 		logger.Fatal("app name is required")
 	}
@@ -360,6 +427,36 @@ Available commands:
 		}
 	}
 
+	if TracingExporter == "" {
+		if TracingExporter = os.Getenv("KAR_TRACING_EXPORTER"); TracingExporter == "" {
+			TracingExporter = loadStringFromConfig(configDir, "tracing_exporter")
+		}
+	}
+	switch TracingExporter {
+	case "":
+	case "otlp":
+		if TracingEndpoint == "" {
+			if TracingEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); TracingEndpoint == "" {
+				if TracingEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); TracingEndpoint != "" {
+					TracingEndpoint = strings.TrimSuffix(TracingEndpoint, "/") + "/v1/traces"
+				} else if TracingEndpoint = loadStringFromConfig(configDir, "tracing_endpoint"); TracingEndpoint == "" {
+					TracingEndpoint = "http://localhost:4318/v1/traces"
+				}
+			}
+		}
+	case "stdout":
+	case "file":
+		if TracingEndpoint == "" {
+			if TracingEndpoint = os.Getenv("KAR_TRACING_ENDPOINT"); TracingEndpoint == "" {
+				if TracingEndpoint = loadStringFromConfig(configDir, "tracing_endpoint"); TracingEndpoint == "" {
+					logger.Fatal("the file trace exporter requires a tracing endpoint")
+				}
+			}
+		}
+	default:
+		logger.Fatal("invalid tracing exporter %s", TracingExporter)
+	}
+
 	if !KafkaConfig.EnableTLS {
 		ktmp := os.Getenv("KAFKA_ENABLE_TLS")
 		if ktmp == "" {
@@ -374,7 +471,7 @@ Available commands:
 
 	if kafkaBrokers == "" {
 		if kafkaBrokers = os.Getenv("KAFKA_BROKERS"); kafkaBrokers == "" {
-			if kafkaBrokers = loadStringFromConfig(configDir, "kafka_brokers"); kafkaBrokers == "" {
+			if kafkaBrokers = loadStringFromConfig(configDir, "kafka_brokers"); kafkaBrokers == "" && !KafkaConfig.Local {
 				logger.Fatal("at least one Kafka broker is required")
 			}
 		}
@@ -396,6 +493,34 @@ Available commands:
 		}
 	}
 
+	if KafkaConfig.Mechanism == "" {
+		if KafkaConfig.Mechanism = os.Getenv("KAFKA_SASL_MECHANISM"); KafkaConfig.Mechanism == "" {
+			if KafkaConfig.Mechanism = loadStringFromConfig(configDir, "kafka_sasl_mechanism"); KafkaConfig.Mechanism == "" {
+				KafkaConfig.Mechanism = rpc.SASLPlain
+			}
+		}
+	}
+
+	KafkaConfig.Mechanism = strings.ToUpper(KafkaConfig.Mechanism)
+	switch KafkaConfig.Mechanism {
+	case rpc.SASLPlain:
+	case rpc.SASLScramSHA256, rpc.SASLScramSHA512:
+		if KafkaConfig.Password == "" && !KafkaConfig.Local {
+			logger.Fatal("a password is required for SASL mechanism %s", KafkaConfig.Mechanism)
+		}
+	case rpc.SASLOAuthBearer:
+		if kafkaTokenFile == "" {
+			if kafkaTokenFile = os.Getenv("KAFKA_TOKEN_FILE"); kafkaTokenFile == "" {
+				if kafkaTokenFile = loadStringFromConfig(configDir, "kafka_token_file"); kafkaTokenFile == "" && !KafkaConfig.Local {
+					logger.Fatal("a token file is required for SASL mechanism %s", rpc.SASLOAuthBearer)
+				}
+			}
+		}
+		KafkaConfig.TokenProvider = rpc.NewFileTokenProvider(kafkaTokenFile)
+	default:
+		logger.Fatal("invalid Kafka SASL mechanism %s", KafkaConfig.Mechanism)
+	}
+
 	if KafkaConfig.Version == "" {
 		if KafkaConfig.Version = os.Getenv("KAFKA_VERSION"); KafkaConfig.Version == "" {
 			if KafkaConfig.Version = loadStringFromConfig(configDir, "kafka_version"); KafkaConfig.Version == "" {
@@ -416,8 +541,72 @@ Available commands:
 		}
 	}
 
+	if kafkaCABase64 == "" {
+		if kafkaCABase64 = os.Getenv("KAFKA_CA"); kafkaCABase64 == "" {
+			kafkaCABase64 = loadStringFromConfig(configDir, "kafka_ca")
+		}
+	}
+
+	if kafkaCABase64 != "" {
+		buf, err := base64.StdEncoding.DecodeString(kafkaCABase64)
+		if err != nil {
+			logger.Fatal("error parsing Kafka CA certificate: %v", err)
+		}
+
+		KafkaConfig.RootCAs = x509.NewCertPool()
+		if !KafkaConfig.RootCAs.AppendCertsFromPEM(buf) {
+			logger.Fatal("error parsing Kafka CA certificate: no PEM-encoded certificate found")
+		}
+	}
+
+	if kafkaCertBase64 == "" {
+		if kafkaCertBase64 = os.Getenv("KAFKA_CLIENT_CERT"); kafkaCertBase64 == "" {
+			kafkaCertBase64 = loadStringFromConfig(configDir, "kafka_client_cert")
+		}
+	}
+
+	if kafkaKeyBase64 == "" {
+		if kafkaKeyBase64 = os.Getenv("KAFKA_CLIENT_KEY"); kafkaKeyBase64 == "" {
+			kafkaKeyBase64 = loadStringFromConfig(configDir, "kafka_client_key")
+		}
+	}
+
+	if kafkaCertBase64 != "" || kafkaKeyBase64 != "" {
+		if kafkaCertBase64 == "" || kafkaKeyBase64 == "" {
+			logger.Fatal("Kafka client certificate and key must be specified together")
+		}
+		cert, err := base64.StdEncoding.DecodeString(kafkaCertBase64)
+		if err != nil {
+			logger.Fatal("error parsing Kafka client certificate: %v", err)
+		}
+		key, err := base64.StdEncoding.DecodeString(kafkaKeyBase64)
+		if err != nil {
+			logger.Fatal("error parsing Kafka client key: %v", err)
+		}
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			logger.Fatal("error parsing Kafka client certificate and key: %v", err)
+		}
+		KafkaConfig.Certificates = []tls.Certificate{pair}
+	}
+
 	KafkaConfig.TopicConfig = topicConfig
 
+	if KafkaConfig.Local {
+		RedisConfig.Backend = store.MemoryBackend
+	}
+
+	if RedisConfig.Backend == "" {
+		if RedisConfig.Backend = os.Getenv("KAR_STORE_BACKEND"); RedisConfig.Backend == "" {
+			if RedisConfig.Backend = loadStringFromConfig(configDir, "store_backend"); RedisConfig.Backend == "" {
+				RedisConfig.Backend = store.RedisBackend
+			}
+		}
+	}
+	if RedisConfig.Backend != store.RedisBackend && RedisConfig.Backend != store.MemoryBackend {
+		logger.Fatal("invalid store backend %s", RedisConfig.Backend)
+	}
+
 	if !RedisConfig.EnableTLS {
 		rtmp := os.Getenv("REDIS_ENABLE_TLS")
 		if rtmp == "" {
@@ -442,9 +631,44 @@ Available commands:
 		}
 	}
 
+	if RedisConfig.Mode == "" {
+		if RedisConfig.Mode = os.Getenv("REDIS_MODE"); RedisConfig.Mode == "" {
+			if RedisConfig.Mode = loadStringFromConfig(configDir, "redis_mode"); RedisConfig.Mode == "" {
+				RedisConfig.Mode = store.RedisStandalone
+			}
+		}
+	}
+	if RedisConfig.Mode != store.RedisStandalone && RedisConfig.Mode != store.RedisSentinel && RedisConfig.Mode != store.RedisCluster {
+		logger.Fatal("invalid Redis mode %s", RedisConfig.Mode)
+	}
+
+	if redisAddresses == "" {
+		if redisAddresses = os.Getenv("REDIS_ADDRESSES"); redisAddresses == "" {
+			redisAddresses = loadStringFromConfig(configDir, "redis_addresses")
+		}
+	}
+
+	if redisAddresses != "" {
+		RedisConfig.Addresses = strings.Split(redisAddresses, ",")
+	}
+
+	if RedisConfig.MasterName == "" {
+		if RedisConfig.MasterName = os.Getenv("REDIS_MASTER_NAME"); RedisConfig.MasterName == "" {
+			if RedisConfig.MasterName = loadStringFromConfig(configDir, "redis_master_name"); RedisConfig.MasterName == "" {
+				RedisConfig.MasterName = "mymaster"
+			}
+		}
+	}
+
+	if RedisConfig.SentinelPassword == "" {
+		if RedisConfig.SentinelPassword = os.Getenv("REDIS_SENTINEL_PASSWORD"); RedisConfig.SentinelPassword == "" {
+			RedisConfig.SentinelPassword = loadStringFromConfig(configDir, "redis_sentinel_password")
+		}
+	}
+
 	if RedisConfig.Host == "" {
 		if RedisConfig.Host = os.Getenv("REDIS_HOST"); RedisConfig.Host == "" {
-			if RedisConfig.Host = loadStringFromConfig(configDir, "redis_host"); RedisConfig.Host == "" {
+			if RedisConfig.Host = loadStringFromConfig(configDir, "redis_host"); RedisConfig.Host == "" && RedisConfig.Backend == store.RedisBackend && len(RedisConfig.Addresses) == 0 {
 				logger.Fatal("Redis host is required")
 			}
 		}
@@ -505,6 +729,10 @@ Available commands:
 		logger.Fatal("rest expects either three or four arguments; got %v", len(flag.Args()))
 	}
 
+	if CmdName == LogLevelCmd && len(flag.Args()) > 1 {
+		logger.Fatal("loglevel expects at most one argument; got %v", len(flag.Args()))
+	}
+
 	GetOutputStyle = strings.ToLower(GetOutputStyle)
 }
 
@@ -18,10 +18,13 @@ package runtime
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/IBM/kar/core/internal/config"
 	"github.com/IBM/kar/core/pkg/logger"
@@ -40,14 +43,77 @@ type bindings interface {
 	add(ctx context.Context, b binding) (int, error)
 	cancel(actor Actor, id string) []binding
 	find(actor Actor, id string) []binding
+	list(f bindingFilter) []binding // find bindings of any actor matching filter
+
+	// parse serialized list of bindings returned by list
+	unmarshal(data []byte) ([]binding, error)
 
 	// parse binding creation request payload to binding object and serialized binding (map[string]string)
-	parse(actor Actor, id, key, payload string) (binding, map[string]string, error)
+	parse(ctx context.Context, actor Actor, id, key, payload string) (binding, map[string]string, error)
 
 	// parse serialized binding
 	load(actor Actor, id, key string, m map[string]string) (binding, error)
 }
 
+// criteria for listing bindings, empty fields match all bindings
+type bindingFilter struct {
+	ActorType string    // type of the bound actor
+	Path      string    // actor method invoked by the binding
+	Topic     string    // topic of a subscription
+	Before    time.Time // next fire time of a reminder is before
+	After     time.Time // next fire time of a reminder is after
+}
+
+// encode filter as a sidecar command
+func (f bindingFilter) command(kind string) map[string]string {
+	msg := map[string]string{
+		"command":   "getBindings",
+		"kind":      kind,
+		"actorType": f.ActorType,
+		"path":      f.Path,
+		"topic":     f.Topic,
+	}
+	if !f.Before.IsZero() {
+		msg["before"] = f.Before.Format(time.RFC3339Nano)
+	}
+	if !f.After.IsZero() {
+		msg["after"] = f.After.Format(time.RFC3339Nano)
+	}
+	return msg
+}
+
+// decode filter from a sidecar command
+func bindingFilterFromCommand(msg map[string]string) (bindingFilter, error) {
+	f := bindingFilter{ActorType: msg["actorType"], Path: msg["path"], Topic: msg["topic"]}
+	var err error
+	if msg["before"] != "" {
+		if f.Before, err = time.Parse(time.RFC3339Nano, msg["before"]); err != nil {
+			return f, err
+		}
+	}
+	if msg["after"] != "" {
+		if f.After, err = time.Parse(time.RFC3339Nano, msg["after"]); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// parseFireTime parses either a time in RFC 3339 format or a duration relative to now
+func parseFireTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected an RFC 3339 time or a duration", s)
+	}
+	return time.Now().Add(d), nil
+}
+
 // a collection of bindings and a mutex to protect it
 type pair struct {
 	bindings bindings
@@ -61,7 +127,7 @@ var (
 
 // redis key for binding
 func bindingKey(kind string, actor Actor, partition, id string) string {
-	return "binding" + config.Separator + partition + config.Separator + kind + config.Separator + actor.Type + config.Separator + actor.ID + config.Separator + id
+	return actorKey(actor.Type, actor.ID, "binding"+config.Separator+partition+config.Separator+kind+config.Separator+actor.Type+config.Separator+actor.ID+config.Separator+id)
 }
 
 // redis key for all bindings for a partition
@@ -69,9 +135,23 @@ func bindingPattern(partition string) string {
 	return "binding" + config.Separator + partition + config.Separator + "*"
 }
 
+// redis key for the index of the bindings for a partition
+// the index is a hash whose fields are the redis keys of the bindings
+func bindingIndexKey(partition string) string {
+	return "binding" + config.Separator + "index" + config.Separator + partition
+}
+
+// field of the index hash marking the index as complete
+const bindingIndexMarker = "indexed"
+
+// partition for redis key
+func keyPartition(key string) string {
+	return strings.Split(store.UntaggedKey(key), config.Separator)[1]
+}
+
 // binding for redis key
 func keyBinding(key string) (kind string, actor Actor, partition int32, id string) {
-	parts := strings.Split(key, config.Separator)
+	parts := strings.Split(store.UntaggedKey(key), config.Separator)
 	p64, err := strconv.ParseInt(parts[1], 10, 32)
 	if err != nil {
 		logger.Fatal("Unable to parse partition as an int: %v", err)
@@ -98,6 +178,7 @@ func loadBinding(ctx context.Context, kind string, actor Actor, partition, id st
 		return err
 	}
 	if len(data) == 0 { // bindingscription no longer exists
+		_, err = store.HDel(ctx, bindingIndexKey(partition), key)
 		return err
 	}
 	b, err := pair.bindings.load(actor, id, key, data)
@@ -119,7 +200,12 @@ func deleteBindings(ctx context.Context, kind string, actor Actor, id string) in
 	defer pair.mu.Unlock()
 	found := pair.bindings.cancel(actor, id)
 	for _, b := range found {
-		store.Del(ctx, b.k())
+		deleteBinding(ctx, b.k())
+		if s, ok := b.(source); ok && s.ExactlyOnce {
+			if _, err := store.Del(ctx, eventOffsetsKey(s.Actor, s.ID)); err != nil {
+				logger.Error("failed to delete the processed events of subscription %v of %v: %v", s.ID, s.Actor, err)
+			}
+		}
 	}
 	logger.Debug("deleted %v binding(s) matching {%v, %v}", len(found), actor, id)
 	return len(found)
@@ -135,23 +221,64 @@ func getBindings(kind string, actor Actor, id string) []binding {
 	return found
 }
 
+// find bindings matching filter in memory
+func listBindings(kind string, f bindingFilter) []binding {
+	pair := pairs[kind]
+	pair.mu.Lock()
+	defer pair.mu.Unlock()
+	return pair.bindings.list(f)
+}
+
+// getAllBindings returns the bindings of the given kind matching filter for all sidecars in the app
+func getAllBindings(ctx context.Context, kind string, f bindingFilter) ([]binding, error) {
+	result := []binding{}
+	sidecars, _ := rpc.GetNodeIDs()
+	for _, sidecar := range sidecars {
+		if sidecar == rpc.GetNodeID() {
+			result = append(result, listBindings(kind, f)...)
+			continue
+		}
+		// Make call to another sidecar, returns the result of listBindings() there
+		bytes, err := json.Marshal(f.command(kind))
+		if err != nil {
+			return nil, err
+		}
+		bytes, err = rpc.Call(ctx, rpc.Destination{Target: rpc.Node{ID: sidecar}, Method: sidecarEndpoint}, time.Time{}, "", bytes)
+		if err != nil {
+			logger.Debug("Error gathering %v: %v", kind, err)
+			return nil, err
+		}
+		var reply Reply
+		if err = json.Unmarshal(bytes, &reply); err != nil {
+			return nil, err
+		}
+		if reply.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("sidecar %v failed to list %v: %v", sidecar, kind, reply.Payload)
+		}
+		found, err := pairs[kind].bindings.unmarshal([]byte(reply.Payload))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, found...)
+	}
+	return result, nil
+}
+
 // create or update a binding in redis and memory
 func putBinding(ctx context.Context, kind string, actor Actor, id, payload string) (int, error) {
 	pair := pairs[kind]
 	pair.mu.Lock()
 	defer pair.mu.Unlock()
-	keys, _ := store.Keys(ctx, bindingKey(kind, actor, "*", id))
-	var key string
-	var successCode int
-	if len(keys) > 0 { // reuse existing key
-		key = keys[0]
-		successCode = http.StatusOK
-	} else { // new key using partition assigned to handle bindings
-		p := rpc.BindingPartition()
-		key = bindingKey(kind, actor, strconv.Itoa(int(p)), id)
+	key, err := findBindingKey(ctx, pair, kind, actor, id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	successCode := http.StatusOK
+	if key == "" { // new key using partition assigned to handle bindings
+		key = bindingKey(kind, actor, strconv.Itoa(int(rpc.BindingPartition())), id)
 		successCode = http.StatusNoContent
 	}
-	b, m, err := pair.bindings.parse(actor, id, key, payload)
+	b, m, err := pair.bindings.parse(ctx, actor, id, key, payload)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
@@ -160,30 +287,93 @@ func putBinding(ctx context.Context, kind string, actor Actor, id, payload strin
 	if err != nil {
 		return code, err
 	}
-	store.HSetMultiple(ctx, key, m)
+	store.HSet(ctx, bindingIndexKey(keyPartition(key)), key, "")
+	store.HReplace(ctx, key, m) // replace all the fields of an existing binding
 	logger.Debug("put binding %v", b)
 	return successCode, nil
 }
 
+// find the redis key of an existing binding, in memory or else in the binding index of every partition
+// returns "" if the binding does not exist
+func findBindingKey(ctx context.Context, pair pair, kind string, actor Actor, id string) (string, error) {
+	if found := pair.bindings.find(actor, id); len(found) > 0 {
+		return found[0].k(), nil
+	}
+	partitions, _ := rpc.GetPartitions()
+	for _, p := range partitions {
+		partition := strconv.Itoa(int(p))
+		key := bindingKey(kind, actor, partition, id)
+		found, err := store.HExists(ctx, bindingIndexKey(partition), key)
+		if err != nil {
+			return "", err
+		}
+		if found == 1 {
+			return key, nil
+		}
+	}
+	return "", nil
+}
+
+// delete binding from redis and from the index of its partition
+func deleteBinding(ctx context.Context, key string) {
+	store.Del(ctx, key)
+	store.HDel(ctx, bindingIndexKey(keyPartition(key)), key)
+}
+
+// build the index of the bindings for a partition if missing using a one-time scan of the keys
+func ensureBindingIndex(ctx context.Context, partition string) error {
+	index := bindingIndexKey(partition)
+	found, err := store.HExists(ctx, index, bindingIndexMarker)
+	if err != nil || found == 1 {
+		return err
+	}
+	keys, err := store.Keys(ctx, bindingPattern(partition))
+	if err != nil {
+		return err
+	}
+	m := map[string]string{bindingIndexMarker: "1"}
+	for _, key := range keys {
+		kind, actor, _, id := keyBinding(key)
+		m[bindingKey(kind, actor, partition, id)] = "" // the hash tag of the key is lost outside of cluster mode
+	}
+	_, err = store.HSetMultiple(ctx, index, m)
+	logger.Info("indexed %v persisted bindings for partition %v", len(keys), partition)
+	return err
+}
+
 // ensure bindings for this partition are loaded from redis in memory
 func loadBindings(ctx context.Context, partitions []int32) error {
 	logger.Debug("loadBindings starting")
 	for _, p := range partitions {
-		keys, err := store.Keys(ctx, bindingPattern(strconv.Itoa(int(p))))
-		if err != nil {
+		partition := strconv.Itoa(int(p))
+		if err := ensureBindingIndex(ctx, partition); err != nil {
 			return err
 		}
-		logger.Debug("found %v persisted bindings for partition %v", len(keys), p)
-		for _, key := range keys {
-			kind, actor, partition, id := keyBinding(key)
-			err = LoadBinding(ctx, kind, actor, partition, id)
+		// page through the index; the pattern skips the marker
+		count := 0
+		cursor := 0
+		for {
+			next, entries, err := store.HScan(ctx, bindingIndexKey(partition), cursor, bindingPattern(partition))
 			if err != nil {
-				if err != ctx.Err() {
-					logger.Error("tell binding failed: %v", err)
+				return err
+			}
+			for i := 0; i < len(entries); i += 2 {
+				kind, actor, partition, id := keyBinding(entries[i])
+				err = LoadBinding(ctx, kind, actor, partition, id)
+				if err != nil {
+					if err != ctx.Err() {
+						logger.Error("tell binding failed: %v", err)
+					}
+					return nil
 				}
-				return nil
+				count++
+			}
+			cursor = next
+			if cursor == 0 {
+				break
 			}
 		}
+		logger.Debug("found %v persisted bindings for partition %v", count, p)
 	}
 	logger.Debug("loadBindings completed")
 	return nil
@@ -0,0 +1,258 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package runtime
+
+/*
+ * This file implements the HTTP and Kafka protocol bindings of CloudEvents 1.0.
+ *
+ * In binary mode, the context attributes of the event are carried in headers
+ * (ce-<attribute> for HTTP, ce_<attribute> for Kafka) and the body is the event data
+ * whose media type is specified by the content-type header.
+ * In structured mode, the event is encoded as a JSON object with content type
+ * application/cloudevents+json.
+ */
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/IBM/kar/core/pkg/rpc"
+)
+
+const (
+	cloudEventsContentType    = "application/cloudevents+json"
+	cloudEventsSpecVersion    = "1.0"
+	kafkaCloudEventsPrefix    = "ce_"
+	kafkaContentTypeHeader    = "content-type"
+	httpCloudEventsPrefix     = "Ce-" // canonical form of the ce- prefix
+	cloudEventsModeBinary     = "binary"
+	cloudEventsModeStructured = "structured"
+)
+
+// isJSONContentType returns true if the content type denotes JSON
+func isJSONContentType(contentType string) bool {
+	contentType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	return contentType == "text/json" ||
+		contentType == "application/json" ||
+		strings.HasSuffix(contentType, "+json")
+}
+
+// isCloudEventsContentType returns true if the content type denotes a structured CloudEvent
+func isCloudEventsContentType(contentType string) bool {
+	return strings.HasPrefix(strings.TrimSpace(contentType), cloudEventsContentType)
+}
+
+// cloudEvent returns the structured representation of the event if the event is a CloudEvent, nil otherwise
+func (e *eventEnv) cloudEvent() map[string]interface{} {
+	if e.ceDecoded {
+		return e.ce
+	}
+	e.ceDecoded = true
+	if _, ok := e.event.Headers[kafkaCloudEventsPrefix+"specversion"]; ok { // binary mode
+		ce := map[string]interface{}{}
+		for k, v := range e.event.Headers {
+			if strings.HasPrefix(k, kafkaCloudEventsPrefix) {
+				ce[strings.TrimPrefix(k, kafkaCloudEventsPrefix)] = v
+			}
+		}
+		contentType := e.event.Headers[kafkaContentTypeHeader]
+		if contentType != "" {
+			ce["datacontenttype"] = contentType
+		}
+		setCloudEventData(ce, contentType, e.event.Value)
+		e.ce = ce
+		return e.ce
+	}
+	var body interface{}
+	if isCloudEventsContentType(e.event.Headers[kafkaContentTypeHeader]) {
+		json.Unmarshal(e.event.Value, &body)
+	} else {
+		body = e.decodeBody()
+	}
+	if m, ok := body.(map[string]interface{}); ok && m["specversion"] != nil { // structured mode
+		e.ce = m
+	}
+	return e.ce
+}
+
+// setCloudEventData adds the data of a binary mode CloudEvent to its structured representation
+func setCloudEventData(ce map[string]interface{}, contentType string, data []byte) {
+	switch {
+	case len(data) == 0:
+	case (contentType == "" || isJSONContentType(contentType)) && json.Valid(data):
+		ce["data"] = json.RawMessage(data)
+	case utf8.Valid(data):
+		ce["data"] = string(data)
+	default:
+		ce["data_base64"] = base64.StdEncoding.EncodeToString(data)
+	}
+}
+
+// cloudEventData returns the data of a structured CloudEvent and its content type
+func cloudEventData(ce map[string]interface{}) ([]byte, string, error) {
+	contentType, _ := ce["datacontenttype"].(string)
+	if s, ok := ce["data_base64"].(string); ok {
+		data, err := base64.StdEncoding.DecodeString(s)
+		return data, contentType, err
+	}
+	data, ok := ce["data"]
+	if !ok {
+		return nil, contentType, nil
+	}
+	if s, ok := data.(string); ok && contentType != "" && !isJSONContentType(contentType) {
+		return []byte(s), contentType, nil
+	}
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	buf, err := json.Marshal(data)
+	return buf, contentType, err
+}
+
+// validateCloudEvent checks the required context attributes of a CloudEvent
+func validateCloudEvent(ce map[string]interface{}) error {
+	if ce["specversion"] != cloudEventsSpecVersion {
+		return fmt.Errorf("unsupported CloudEvents specversion %v, expected %s", ce["specversion"], cloudEventsSpecVersion)
+	}
+	for _, attribute := range []string{"id", "source", "type"} {
+		if s, ok := ce[attribute].(string); !ok || s == "" {
+			return fmt.Errorf("missing or invalid CloudEvent attribute %s", attribute)
+		}
+	}
+	return nil
+}
+
+// attributeString returns the string encoding of a context attribute for use in a header
+func attributeString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	buf, _ := json.Marshal(v)
+	return string(buf)
+}
+
+// encodeCloudEvent converts a CloudEvent received over HTTP in binary or structured mode
+// into a Kafka event in the requested mode ("" to preserve the mode of the request).
+// It returns the value and the headers to publish. Other events are published unchanged.
+func encodeCloudEvent(header http.Header, body []byte, mode string) ([]byte, map[string]string, error) {
+	if mode != "" && mode != cloudEventsModeBinary && mode != cloudEventsModeStructured {
+		return nil, nil, fmt.Errorf("invalid CloudEvents mode %q, expected %s or %s", mode, cloudEventsModeBinary, cloudEventsModeStructured)
+	}
+	contentType := header.Get("Content-Type")
+	var ce map[string]interface{}
+	switch {
+	case header.Get(httpCloudEventsPrefix+"Specversion") != "": // binary mode
+		ce = map[string]interface{}{}
+		for k, v := range header {
+			if strings.HasPrefix(k, httpCloudEventsPrefix) && len(v) > 0 {
+				ce[strings.ToLower(strings.TrimPrefix(k, httpCloudEventsPrefix))] = v[0]
+			}
+		}
+		if err := validateCloudEvent(ce); err != nil {
+			return nil, nil, err
+		}
+		if mode != cloudEventsModeStructured {
+			headers := map[string]string{}
+			for k, v := range ce {
+				headers[kafkaCloudEventsPrefix+k] = v.(string)
+			}
+			if contentType != "" {
+				headers[kafkaContentTypeHeader] = contentType
+			}
+			return body, headers, nil
+		}
+		if contentType != "" {
+			ce["datacontenttype"] = contentType
+		}
+		setCloudEventData(ce, contentType, body)
+
+	case isCloudEventsContentType(contentType): // structured mode
+		if err := json.Unmarshal(body, &ce); err != nil || ce == nil {
+			return nil, nil, errors.New("structured CloudEvent must be a JSON object")
+		}
+		if err := validateCloudEvent(ce); err != nil {
+			return nil, nil, err
+		}
+		if mode == cloudEventsModeBinary {
+			data, dataContentType, err := cloudEventData(ce)
+			if err != nil {
+				return nil, nil, err
+			}
+			headers := map[string]string{}
+			for k, v := range ce {
+				if k != "data" && k != "data_base64" && k != "datacontenttype" {
+					headers[kafkaCloudEventsPrefix+k] = attributeString(v)
+				}
+			}
+			if data != nil {
+				headers[kafkaContentTypeHeader] = dataContentType
+			}
+			return data, headers, nil
+		}
+		return body, map[string]string{kafkaContentTypeHeader: cloudEventsContentType}, nil
+
+	default:
+		if mode != "" {
+			return nil, nil, errors.New("request is not a CloudEvent")
+		}
+		return body, nil, nil
+	}
+
+	buf, err := json.Marshal(ce)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf, map[string]string{kafkaContentTypeHeader: cloudEventsContentType}, nil
+}
+
+// addCloudEventExtensions adds the key and headers of a CloudEvent as extension attributes.
+// The key is added as the partitionkey attribute. Headers are added as attributes whose names are the
+// lowercase alphanumeric characters of the header names as required by CloudEvents. Existing attributes
+// are preserved. If several headers map to the same attribute, the first header name in lexicographic
+// order wins. Subscriptions with an envelope receive the key and the headers unchanged.
+func addCloudEventExtensions(ce map[string]interface{}, event rpc.Event) {
+	if _, ok := ce["partitionkey"]; !ok && event.Key != nil {
+		ce["partitionkey"] = string(event.Key)
+	}
+	names := make([]string, 0, len(event.Headers))
+	for k := range event.Headers {
+		if !strings.HasPrefix(k, kafkaCloudEventsPrefix) && k != kafkaContentTypeHeader {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		name := strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+				return r
+			}
+			if r >= 'A' && r <= 'Z' {
+				return r - 'A' + 'a'
+			}
+			return -1
+		}, k)
+		if _, ok := ce[name]; !ok && name != "" && name != "data" {
+			ce[name] = event.Headers[k]
+		}
+	}
+}
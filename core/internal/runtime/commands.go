@@ -31,6 +31,7 @@ import (
 	"github.com/IBM/kar/core/pkg/logger"
 	"github.com/IBM/kar/core/pkg/rpc"
 	"github.com/IBM/kar/core/pkg/store"
+	"github.com/cenkalti/backoff/v4"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
@@ -413,6 +414,12 @@ func handlerSidecar(ctx context.Context, target rpc.Node, value []byte) ([]byte,
 	} else if msg["command"] == "getRuntimeAddr" {
 		replyBytes, replyErr = getRuntimeAddr(ctx, msg)
 		return replyBytes, replyErr
+	} else if msg["command"] == "getBindings" {
+		replyBytes, replyErr = getBindingInformation(ctx, msg)
+		return replyBytes, replyErr
+	} else if msg["command"] == "logLevels" {
+		replyBytes, replyErr = logLevels(ctx, msg)
+		return replyBytes, replyErr
 	} else {
 		logger.Error("unexpected command %s", msg["command"]) // dropping message
 		return nil, nil
@@ -491,7 +498,7 @@ func handlerDebugger(ctx context.Context, target rpc.Node, value []byte) ([]byte
 		replyBytes, replyErr = editResponse(msg)
 		return replyBytes, replyErr
 	} else {
-		logger.Error("unexpected command %s", msg["command"]) // dropping message
+		debuggerLog.Error("unexpected command %s", msg["command"]) // dropping message
 		return nil, nil
 	}
 }
@@ -506,14 +513,14 @@ func handlerService(ctx context.Context, target rpc.Service, value []byte) ([]by
 
 	command := msg["command"]
 	if !(command == "call" || command == "tell") {
-		logger.Error("unexpected command %s", command)
+		logger.ErrorContext(ctx, "unexpected command %s", command)
 		return nil, nil // returning `nil` error indicates that message processing is complete (ie, drop unknown commands)
 	}
 
 	reply, err := invoke(ctx, msg["method"], msg, target.Name+":"+msg["path"])
 	if err != nil {
 		if err != ctx.Err() {
-			logger.Debug("%s failed to invoke %s: %v", command, msg["path"], err)
+			logger.DebugContext(ctx, "%s failed to invoke %s: %v", command, msg["path"], err)
 		}
 		return nil, err
 	}
@@ -523,7 +530,7 @@ func handlerService(ctx context.Context, target rpc.Service, value []byte) ([]by
 		if command == "tell" {
 			// reply is dropped after logging non-200 status code; no one is waiting for it.
 			if reply.StatusCode >= 300 || reply.StatusCode < 200 {
-				logger.Error("Asynchronous %s of %s returned status %v with body %s", msg["method"], msg["path"], reply.StatusCode, reply.Payload)
+				logger.ErrorContext(ctx, "Asynchronous %s of %s returned status %v with body %s", msg["method"], msg["path"], reply.StatusCode, reply.Payload)
 			}
 		} else {
 			if msg["actorTailCall"] == "true" {
@@ -632,7 +639,7 @@ func handlerActor(ctx context.Context, target rpc.Session, instance *rpc.Session
 	}
 
 	if target.Flow != instance.ActiveFlow {
-		logger.Error("Flow violation: mismatch between target %v and instance %v at entry", target, instance)
+		logger.ErrorContext(ctx, "Flow violation: mismatch between target %v and instance %v at entry", target, instance)
 		return nil, nil, fmt.Errorf("Flow violation: mismatch between target %v and instance %v at entry", target, instance)
 	}
 
@@ -643,16 +650,23 @@ func handlerActor(ctx context.Context, target rpc.Session, instance *rpc.Session
 		}
 		// delete persistent actor state
 		if _, err := store.Del(ctx, stateKey(actor.Type, actor.ID)); err != nil && err != store.ErrNil {
-			logger.Error("deleting persistent state of %v failed with %v", actor, err)
+			logger.ErrorContext(ctx, "deleting persistent state of %v failed with %v", actor, err)
 		}
 		// clear placement data and sidecar's in-memory state (effectively also releases the lock, since we are deleting the table entry)
 		err = rpc.DelSession(ctx, rpc.Session{Name: actor.Type, ID: actor.ID})
 		if err != nil {
-			logger.Error("deleting placement data for %v failed with %v", actor, err)
+			logger.ErrorContext(ctx, "deleting placement data for %v failed with %v", actor, err)
 		}
 		return nil, reply, err
 	}
 
+	if msg["eventSubscription"] != "" { // deduplicated event delivery
+		deliver, err := dedupEvents(ctx, actor, msg)
+		if err != nil || !deliver {
+			return nil, nil, err
+		}
+	}
+
 	var dest *rpc.Destination = nil
 	if !instance.Activated {
 		reply, err = activate(ctx, actor, session, msg)
@@ -675,9 +689,10 @@ func handlerActor(ctx context.Context, target rpc.Session, instance *rpc.Session
 		if command == "call" || command == "tell" {
 			reply = nil
 			replyStruct, err := invoke(ctx, msg["method"], msg, metricLabel)
+			succeeded := false // the actor method returned without error
 			if err != nil {
 				if err != ctx.Err() {
-					logger.Debug("%s failed to invoke %s: %v", command, msg["path"], err)
+					logger.DebugContext(ctx, "%s failed to invoke %s: %v", command, msg["path"], err)
 				}
 			} else if replyStruct != nil {
 				debugReply, _ = json.Marshal(*replyStruct)
@@ -685,14 +700,16 @@ func handlerActor(ctx context.Context, target rpc.Session, instance *rpc.Session
 					// TELL: no waiting caller, so we have to inspect here and figure out if the method returned void, a result, a tail call, or an error
 					if replyStruct.StatusCode == http.StatusNoContent {
 						// Void return from a tell; nothing further to do.
+						succeeded = true
 					} else if replyStruct.StatusCode == http.StatusOK {
 						var result actorCallResult
 						if err = json.Unmarshal([]byte(replyStruct.Payload), &result); err != nil {
-							logger.Error("Asynchronous invoke of %s had malformed result. %v", msg["path"], err)
+							logger.ErrorContext(ctx, "Asynchronous invoke of %s had malformed result. %v", msg["path"], err)
 							err = nil // don't try to rexecute; this is a KAR runtime-level protocol error that should never happen
 						} else {
+							succeeded = !result.Error
 							if result.Error {
-								logger.Error("Asynchronous invoke of %s raised error %s\nStacktrace: %v", msg["path"], result.Message, result.Stack)
+								logger.ErrorContext(ctx, "Asynchronous invoke of %s raised error %s\nStacktrace: %v", msg["path"], result.Message, result.Stack)
 							} else if result.TailCall {
 								cr := result.Value.(map[string]interface{})
 								if _, ok := cr["serviceName"]; ok {
@@ -705,7 +722,7 @@ func handlerActor(ctx context.Context, target rpc.Session, instance *rpc.Session
 									}
 									dest = &rpc.Destination{Target: nextActor, Method: actorEndpoint}
 								} else {
-									logger.Error("Asynchronous invoke of %s returned unsupported tail call result %v", msg["path"], cr)
+									logger.ErrorContext(ctx, "Asynchronous invoke of %s returned unsupported tail call result %v", msg["path"], cr)
 									err = fmt.Errorf("Asynchronous invoke of %s returned unsupported tail call result %v", msg["path"], cr)
 								}
 								if dest != nil {
@@ -723,7 +740,7 @@ func handlerActor(ctx context.Context, target rpc.Session, instance *rpc.Session
 							}
 						}
 					} else {
-						logger.Error("Asynchronous invoke of %s returned status %v with body %s", msg["path"], replyStruct.StatusCode, replyStruct.Payload)
+						logger.ErrorContext(ctx, "Asynchronous invoke of %s returned status %v with body %s", msg["path"], replyStruct.StatusCode, replyStruct.Payload)
 					}
 				} else {
 					// CALL: there is a waiting caller, so after handling tail calls, anything else (normal or error) is simply passed through.
@@ -765,15 +782,18 @@ func handlerActor(ctx context.Context, target rpc.Session, instance *rpc.Session
 					}
 				}
 			}
+			if succeeded && err == nil && msg["eventSubscription"] != "" {
+				recordEvents(ctx, actor, msg) // the events have been processed
+			}
 		} else {
-			logger.Error("unexpected actor command %s", msg["command"]) // dropping message
+			logger.ErrorContext(ctx, "unexpected actor command %s", msg["command"]) // dropping message
 			reply = nil
 			err = nil
 		}
 	}
 
 	if target.Flow != instance.ActiveFlow {
-		logger.Error("Flow violation: mismatch between target %v and instance %v at exit", target, instance)
+		logger.ErrorContext(ctx, "Flow violation: mismatch between target %v and instance %v at exit", target, instance)
 	}
 
 	/*accessing isDebuggerPresent without a lock -- risky! but fast*/
@@ -844,8 +864,10 @@ func handlerBinding(ctx context.Context, target rpc.Session, instance *rpc.Sessi
 	case "load":
 		reply = nil
 		err = bindingLoad(ctx, actor, msg)
+	case "pause", "resume", "seek", "lag":
+		reply, err = subscriptionControl(ctx, actor, msg)
 	default:
-		logger.Error("unexpected binding command %s", msg["command"]) // dropping message
+		logger.ErrorContext(ctx, "unexpected binding command %s", msg["command"]) // dropping message
 		reply = nil
 		err = nil
 	}
@@ -923,6 +945,54 @@ func getActorInformation(ctx context.Context, msg map[string]string) ([]byte, er
 	return json.Marshal(reply)
 }
 
+// Returns the bindings of this sidecar matching the filter in msg
+func getBindingInformation(ctx context.Context, msg map[string]string) ([]byte, error) {
+	var reply Reply
+	f, err := bindingFilterFromCommand(msg)
+	if _, ok := pairs[msg["kind"]]; !ok {
+		err = fmt.Errorf("unknown binding kind %v", msg["kind"])
+	}
+	if err != nil {
+		reply = Reply{StatusCode: http.StatusBadRequest, Payload: err.Error(), ContentType: "text/plain"}
+		return json.Marshal(reply)
+	}
+	m, err := json.Marshal(listBindings(msg["kind"], f))
+	if err != nil {
+		logger.Debug("Error marshaling binding information: %v", err)
+		reply = Reply{StatusCode: http.StatusInternalServerError}
+	} else {
+		reply = Reply{StatusCode: http.StatusOK, Payload: string(m), ContentType: "application/json"}
+	}
+	return json.Marshal(reply)
+}
+
+// Sets the log verbosity of this sidecar if msg has levels and returns the log verbosity
+func logLevels(ctx context.Context, msg map[string]string) ([]byte, error) {
+	var reply Reply
+	if msg["levels"] != "" {
+		var levels logger.Levels
+		err := json.Unmarshal([]byte(msg["levels"]), &levels)
+		if err == nil {
+			err = logger.SetLevels(levels)
+		}
+		if err != nil {
+			reply = Reply{StatusCode: http.StatusBadRequest, Payload: err.Error(), ContentType: "text/plain"}
+			return json.Marshal(reply)
+		}
+	}
+	m, err := json.Marshal(logger.GetLevels())
+	if err != nil {
+		logger.Debug("Error marshaling log levels: %v", err)
+		reply = Reply{StatusCode: http.StatusInternalServerError}
+	} else {
+		if msg["levels"] != "" {
+			logger.Warning("log verbosity set to %s", m)
+		}
+		reply = Reply{StatusCode: http.StatusOK, Payload: string(m), ContentType: "application/json"}
+	}
+	return json.Marshal(reply)
+}
+
 // Returns this sidecar's hostname and port
 func getRuntimeAddr(ctx context.Context, msg map[string]string) ([]byte, error) {
 	replyMap := map[string]interface{} {}
@@ -993,7 +1063,7 @@ func setBreakpoint(ctx context.Context, msg map[string]string) ([]byte, error) {
 	breakpoints[msg["breakpointId"]] = breakpoint
 	breakpointsByAttrs[attrs] = breakpoint //msg["breakpointId"]
 
-	//fmt.Printf("Breakpoints after set: %v\n", breakpoints)
+	debuggerLog.Debug("breakpoints after set: %v", breakpoints)
 
 	breakpointsLock.Unlock()
 
@@ -1013,7 +1083,7 @@ func unsetBreakpoint(ctx context.Context, msg map[string]string) ([]byte, error)
 	}
 	delete(breakpointsByAttrs, flowAttrs)
 
-	//fmt.Printf("Breakpoints after unset: %v\n", breakpoints)
+	debuggerLog.Debug("breakpoints after unset: %v", breakpoints)
 
 	breakpointsLock.Unlock()
 
@@ -1033,7 +1103,7 @@ func pause(info actorTuple_t, bk breakpoint_t) ([]byte, error) {
 		pausedBreaks[info] = bk
 		isChannelOpenLock.Unlock()
 	}
-	//fmt.Printf("paused actors after pause: %v\n", isActorPaused)
+	debuggerLog.Debug("paused actors after pause: %v", isActorPaused)
 	isActorPausedLock.Unlock()
 
 	reply := Reply{StatusCode: http.StatusOK, ContentType: "application/json"}
@@ -1075,7 +1145,7 @@ func unpause(info actorTuple_t) ([]byte, error) {
 	}
 	isChannelOpenLock.Unlock()
 endUnpause:
-	//fmt.Printf("just unpaused actor %v", info)
+	debuggerLog.Debug("unpaused actor %v", info)
 
 	isActorPausedLock.Unlock()
 
@@ -1480,20 +1550,20 @@ func activate(ctx context.Context, actor Actor, session string, causingMsg map[s
 	reply, err := invoke(ctx, "GET", map[string]string{"path": activatePath}, actor.Type+":activate")
 	if err != nil {
 		if err != ctx.Err() {
-			logger.Debug("activate failed to invoke %s: %v", actorRuntimeRoutePrefix+actor.Type+"/"+actor.ID, err)
+			logger.DebugContext(ctx, "activate failed to invoke %s: %v", actorRuntimeRoutePrefix+actor.Type+"/"+actor.ID, err)
 		}
 		return nil, err
 	}
 	if reply.StatusCode >= http.StatusBadRequest {
 		if causingMsg["command"] == "call" {
-			logger.Debug("activate %v returned status %v with body %s, aborting call %s", actor, reply.StatusCode, reply.Payload, causingMsg["path"])
+			logger.DebugContext(ctx, "activate %v returned status %v with body %s, aborting call %s", actor, reply.StatusCode, reply.Payload, causingMsg["path"])
 		} else {
 			// Log at error level becasue there is no one waiting on the method reponse to notice the failure.
-			logger.Error("activate %v returned status %v with body %s, aborting tell %s", actor, reply.StatusCode, reply.Payload, causingMsg["path"])
+			logger.ErrorContext(ctx, "activate %v returned status %v with body %s, aborting tell %s", actor, reply.StatusCode, reply.Payload, causingMsg["path"])
 		}
 		return json.Marshal(reply)
 	}
-	logger.Debug("activate %v returned status %v with body %s", actor, reply.StatusCode, reply.Payload)
+	logger.DebugContext(ctx, "activate %v returned status %v with body %s", actor, reply.StatusCode, reply.Payload)
 	return nil, nil
 }
 
@@ -1502,15 +1572,15 @@ func deactivate(ctx context.Context, actor *rpc.SessionInstance) {
 	reply, err := invoke(ctx, "DELETE", map[string]string{"path": actorRuntimeRoutePrefix + actor.Name + "/" + actor.ID}, actor.Name+":deactivate")
 	if err != nil {
 		if err != ctx.Err() {
-			logger.Debug("deactivate failed to invoke %s: %v", actorRuntimeRoutePrefix+actor.Name+"/"+actor.ID, err)
+			logger.DebugContext(ctx, "deactivate failed to invoke %s: %v", actorRuntimeRoutePrefix+actor.Name+"/"+actor.ID, err)
 		}
 		return
 	}
 	actor.Activated = false
 	if reply.StatusCode >= http.StatusBadRequest {
-		logger.Error("deactivate %v returned status %v with body %s", actor, reply.StatusCode, reply.Payload)
+		logger.ErrorContext(ctx, "deactivate %v returned status %v with body %s", actor, reply.StatusCode, reply.Payload)
 	} else {
-		logger.Debug("deactivate %v returned status %v with body %s", actor, reply.StatusCode, reply.Payload)
+		logger.DebugContext(ctx, "deactivate %v returned status %v with body %s", actor, reply.StatusCode, reply.Payload)
 	}
 	return
 }
@@ -1683,17 +1753,58 @@ func ManageBindings(ctx context.Context) {
 	}
 }
 
+// the outcome of ValidateActorConfig
+var appStatus struct {
+	sync.Mutex
+	answered     bool     // the user process answered for all the Actor types
+	unrecognized []string // the Actor types not recognized by the user process
+}
+
 // ValidateActorConfig checks to make sure the user process actually supports
 // all the Actor types that were specified with `-actors` when the sidecar was launched.
+// It keeps trying with an exponential backoff until the user process answers for all the Actor types
+// or the context is cancelled.
 func ValidateActorConfig(ctx context.Context) {
+	b := backoff.NewExponentialBackOff()
+	b.MaxInterval = validateActorConfigMaxInterval
+	b.MaxElapsedTime = 0
+	for attempt := 1; !validateActorTypes(ctx, attempt); attempt++ {
+		select {
+		case <-time.After(b.NextBackOff()):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// the maximum delay between two attempts to validate the Actor types
+const validateActorConfigMaxInterval = 30 * time.Second
+
+// validateActorTypes queries the user process once for each Actor type
+// and returns true if the user process answered for all of them
+// only the failures of the first attempt are logged as warnings, the next ones are debug messages
+func validateActorTypes(ctx context.Context, attempt int) bool {
+	logFailure := logger.Debug
+	if attempt == 1 {
+		logFailure = logger.Warning
+	}
+	answered := true
+	unrecognized := []string{}
 	for _, actorType := range config.ActorTypes {
 		reply, err := invoke(ctx, "HEAD", map[string]string{"path": actorRuntimeRoutePrefix + actorType}, "")
 		if err != nil {
 			if err != ctx.Err() {
-				logger.Error("validate actor type failed for %s: %v", actorType, err)
+				logFailure("validate actor type failed for %s (attempt %v): %v", actorType, attempt, err)
 			}
+			answered = false
 		} else if reply.StatusCode != http.StatusOK {
 			logger.Error("Actor type %v is not recognized by application process!", actorType)
+			unrecognized = append(unrecognized, actorType)
 		}
 	}
+	appStatus.Lock()
+	appStatus.answered = answered
+	appStatus.unrecognized = unrecognized
+	appStatus.Unlock()
+	return answered
 }
@@ -0,0 +1,264 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package runtime
+
+/*
+ * This file contains a parser and evaluator for cron expressions used in reminders.
+ *
+ * An expression has 5 fields (minute hour day-of-month month day-of-week)
+ * or 6 fields (second minute hour day-of-month month day-of-week).
+ * Fields may use *, ?, lists (1,15), ranges (1-5), steps (0/10, 0-30/5),
+ * and names for months (JAN-DEC) and days of the week (SUN-SAT).
+ * Sunday is day 0 or 7. The macros @yearly, @annually, @monthly, @weekly,
+ * @daily, @midnight, and @hourly are also supported.
+ *
+ * As in standard cron, if both the day-of-month and day-of-week fields are
+ * restricted, a time matches if either field matches. A field starting with
+ * * or ? is unrestricted, even if it specifies a step.
+ *
+ * Daylight saving time transitions are handled as in standard cron. If the
+ * hour field is unrestricted, the expression is matched against the wall clock
+ * as time passes: times skipped by the clock never match and repeated times
+ * match twice. Otherwise, each matching time fires once: a time skipped by the
+ * clock fires when the clock skips it and a repeated time fires the first time.
+ */
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a parsed cron expression
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64 // bit sets of matching values
+	hourStar, domStar, dowStar            bool   // unrestricted hour and day fields
+	location                              *time.Location
+}
+
+// the valid range and the names of the values of a cron field
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronSecond = cronField{name: "second", min: 0, max: 59}
+	cronMinute = cronField{name: "minute", min: 0, max: 59}
+	cronHour   = cronField{name: "hour", min: 0, max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}}
+	cronDow = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}}
+
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+)
+
+// parseCron parses a cron expression to be evaluated in the given time zone (UTC if empty)
+func parseCron(spec, timeZone string) (*cronSchedule, error) {
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %v", timeZone, err)
+	}
+
+	if macro, ok := cronMacros[strings.ToLower(strings.TrimSpace(spec))]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 or 6 fields, found %v", spec, len(fields))
+	}
+
+	s := &cronSchedule{location: location}
+	if s.second, _, err = parseCronField(fields[0], cronSecond); err != nil {
+		return nil, err
+	}
+	if s.minute, _, err = parseCronField(fields[1], cronMinute); err != nil {
+		return nil, err
+	}
+	if s.hour, s.hourStar, err = parseCronField(fields[2], cronHour); err != nil {
+		return nil, err
+	}
+	if s.dom, s.domStar, err = parseCronField(fields[3], cronDom); err != nil {
+		return nil, err
+	}
+	if s.month, _, err = parseCronField(fields[4], cronMonth); err != nil {
+		return nil, err
+	}
+	if s.dow, s.dowStar, err = parseCronField(fields[5], cronDow); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 { // 7 is Sunday
+		s.dow |= 1
+	}
+	if s.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid cron expression %q: never fires", spec)
+	}
+	return s, nil
+}
+
+// parseCronField returns the bit set of the values matching the expression and whether the expression is unrestricted
+func parseCronField(expr string, f cronField) (uint64, bool, error) {
+	var bits uint64
+	star := strings.HasPrefix(expr, "*") || strings.HasPrefix(expr, "?")
+	for _, part := range strings.Split(expr, ",") {
+		rangeAndStep := strings.SplitN(part, "/", 2)
+		var low, high int
+		if rangeAndStep[0] == "*" || rangeAndStep[0] == "?" {
+			low, high = f.min, f.max
+		} else {
+			bounds := strings.SplitN(rangeAndStep[0], "-", 2)
+			var err error
+			if low, err = parseCronValue(bounds[0], f); err != nil {
+				return 0, false, err
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = parseCronValue(bounds[1], f); err != nil {
+					return 0, false, err
+				}
+			} else if len(rangeAndStep) == 2 { // n/step means n-max/step
+				high = f.max
+			}
+		}
+		step := 1
+		if len(rangeAndStep) == 2 {
+			var err error
+			if step, err = strconv.Atoi(rangeAndStep[1]); err != nil || step <= 0 {
+				return 0, false, fmt.Errorf("invalid step %q in cron %s field", rangeAndStep[1], f.name)
+			}
+		}
+		if low > high {
+			return 0, false, fmt.Errorf("invalid range %q in cron %s field", rangeAndStep[0], f.name)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, star, nil
+}
+
+// parseCronValue parses a number or name and checks the result is in range
+func parseCronValue(s string, f cronField) (int, error) {
+	v, ok := f.names[strings.ToLower(s)]
+	if !ok {
+		var err error
+		if v, err = strconv.Atoi(s); err != nil {
+			return 0, fmt.Errorf("invalid value %q in cron %s field", s, f.name)
+		}
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %v out of range [%v-%v] in cron %s field", v, f.min, f.max, f.name)
+	}
+	return v, nil
+}
+
+// dayMatches checks the day-of-month and day-of-week fields
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first matching time strictly after t or the zero time if none in the next five years
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.In(s.location).Truncate(time.Second)
+	if s.hourStar {
+		return s.match(t.Add(time.Second))
+	}
+
+	// match the wall clock represented as a UTC time
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	for {
+		wall = s.match(wall.Add(time.Second))
+		if wall.IsZero() {
+			return wall
+		}
+		if at := s.wallTime(wall); at.After(t) {
+			return at
+		}
+	}
+}
+
+// match returns the first matching time at or after t in the location of t
+// or the zero time if none in the next five years
+func (s *cronSchedule) match(t time.Time) time.Time {
+	yearLimit := t.Year() + 5
+
+	for t.Year() <= yearLimit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			// next hour of the wall clock, irrespective of the offset of the location
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute - time.Duration(t.Second())*time.Second)
+			continue
+		}
+		if s.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// wallTime returns the first time the wall clock of the location shows the given UTC time
+// or the end of the daylight saving time transition if the wall clock skips it
+func (s *cronSchedule) wallTime(wall time.Time) time.Time {
+	var at time.Time
+	// the offsets in effect around the given time
+	for _, d := range []time.Duration{-24 * time.Hour, 24 * time.Hour} {
+		_, offset := wall.Add(d).In(s.location).Zone()
+		t := wall.Add(-time.Duration(offset) * time.Second).In(s.location)
+		if _, o := t.Zone(); o == offset && (at.IsZero() || t.Before(at)) {
+			at = t
+		}
+	}
+	if at.IsZero() {
+		_, offset := wall.Add(-24 * time.Hour).In(s.location).Zone() // the offset before the transition
+		at, _ = wall.Add(-time.Duration(offset) * time.Second).In(s.location).ZoneBounds()
+	}
+	return at
+}
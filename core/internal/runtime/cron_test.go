@@ -0,0 +1,213 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package runtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		timeZone string
+		from     string
+		firings  []string // successive firings after from
+	}{
+		{"monthly in Paris", "0 2 1 * *", "Europe/Paris", "2023-01-15T00:00:00+01:00", []string{
+			"2023-02-01T02:00:00+01:00",
+			"2023-03-01T02:00:00+01:00",
+			"2023-04-01T02:00:00+02:00",
+			"2023-05-01T02:00:00+02:00",
+		}},
+		{"monthly in Paris after fall back", "0 2 1 * *", "Europe/Paris", "2023-10-15T00:00:00+02:00", []string{
+			"2023-11-01T02:00:00+01:00",
+			"2023-12-01T02:00:00+01:00",
+		}},
+		{"every second", "* * * * * *", "", "2023-01-01T00:00:00.5Z", []string{
+			"2023-01-01T00:00:01Z",
+			"2023-01-01T00:00:02Z",
+		}},
+		{"macro", "@weekly", "", "2023-01-01T00:00:00Z", []string{
+			"2023-01-08T00:00:00Z",
+			"2023-01-15T00:00:00Z",
+		}},
+		{"leap day", "0 12 29 2 *", "", "2023-01-01T00:00:00Z", []string{
+			"2024-02-29T12:00:00Z",
+			"2028-02-29T12:00:00Z",
+		}},
+
+		// day of month or day of week
+		{"day of month or day of week", "0 0 13 * FRI", "", "2023-01-01T00:00:00Z", []string{
+			"2023-01-06T00:00:00Z",
+			"2023-01-13T00:00:00Z",
+			"2023-01-20T00:00:00Z",
+			"2023-01-27T00:00:00Z",
+			"2023-02-03T00:00:00Z",
+			"2023-02-10T00:00:00Z",
+			"2023-02-13T00:00:00Z",
+		}},
+		{"stepped range of days or day of week", "0 0 1-31/10 * MON", "", "2023-01-01T00:00:00Z", []string{
+			"2023-01-02T00:00:00Z",
+			"2023-01-09T00:00:00Z",
+			"2023-01-11T00:00:00Z",
+			"2023-01-16T00:00:00Z",
+			"2023-01-21T00:00:00Z",
+		}},
+		{"every other day and day of week", "0 0 */2 * MON", "", "2023-01-01T00:00:00Z", []string{
+			"2023-01-09T00:00:00Z",
+			"2023-01-23T00:00:00Z",
+			"2023-02-13T00:00:00Z",
+		}},
+		{"day of month and every other day of week", "0 0 1 * */2", "", "2022-12-31T00:00:00Z", []string{
+			"2023-01-01T00:00:00Z",
+			"2023-04-01T00:00:00Z",
+		}},
+		{"day of week 7 is Sunday", "0 0 ? * 7", "", "2023-01-02T00:00:00Z", []string{
+			"2023-01-08T00:00:00Z",
+		}},
+
+		// daylight saving time in Paris: 2023-03-26 02:00 -> 03:00 and 2023-10-29 03:00 -> 02:00
+		{"spring forward", "30 2 * * *", "Europe/Paris", "2023-03-25T12:00:00+01:00", []string{
+			"2023-03-26T03:00:00+02:00", // the clock skips 02:30
+			"2023-03-27T02:30:00+02:00",
+		}},
+		{"spring forward at end of gap", "0 3 * * *", "Europe/Paris", "2023-03-26T00:00:00+01:00", []string{
+			"2023-03-26T03:00:00+02:00",
+			"2023-03-27T03:00:00+02:00",
+		}},
+		{"spring forward with seconds", "10 59 2 * * *", "Europe/Paris", "2023-03-25T12:00:00+01:00", []string{
+			"2023-03-26T03:00:00+02:00",
+			"2023-03-27T02:59:10+02:00",
+		}},
+		{"spring forward every half hour", "0,30 * * * *", "Europe/Paris", "2023-03-26T01:00:00+01:00", []string{
+			"2023-03-26T01:30:00+01:00",
+			"2023-03-26T03:00:00+02:00",
+			"2023-03-26T03:30:00+02:00",
+		}},
+		{"fall back", "30 2 * * *", "Europe/Paris", "2023-10-29T00:00:00+02:00", []string{
+			"2023-10-29T02:30:00+02:00", // 02:30 fires once
+			"2023-10-30T02:30:00+01:00",
+		}},
+		{"fall back during repeated hour", "30 2 * * *", "Europe/Paris", "2023-10-29T02:15:00+01:00", []string{
+			"2023-10-30T02:30:00+01:00",
+		}},
+		{"fall back every half hour", "0,30 * * * *", "Europe/Paris", "2023-10-29T02:00:00+02:00", []string{
+			"2023-10-29T02:30:00+02:00",
+			"2023-10-29T02:00:00+01:00",
+			"2023-10-29T02:30:00+01:00",
+			"2023-10-29T03:00:00+01:00",
+		}},
+
+		// half-hour offsets
+		{"half-hour offset", "0 1 * * *", "Asia/Kolkata", "2023-01-01T00:00:00+05:30", []string{
+			"2023-01-01T01:00:00+05:30",
+			"2023-01-02T01:00:00+05:30",
+		}},
+		{"half-hour offset every other hour", "0 */2 * * *", "Australia/Adelaide", "2023-10-01T00:30:00+09:30", []string{
+			"2023-10-01T04:00:00+10:30", // the clock skips 02:00
+			"2023-10-01T06:00:00+10:30",
+		}},
+		{"half-hour offset spring forward", "0 2 * * *", "Australia/Adelaide", "2023-09-30T12:00:00+09:30", []string{
+			"2023-10-01T03:00:00+10:30",
+			"2023-10-02T02:00:00+10:30",
+		}},
+		{"half-hour offset fall back", "30 2 * * *", "Australia/Adelaide", "2023-04-02T00:00:00+10:30", []string{
+			"2023-04-02T02:30:00+10:30",
+			"2023-04-03T02:30:00+09:30",
+		}},
+		// daylight saving time shifts by 30 minutes on Lord Howe Island:
+		// 2023-04-02 02:00 -> 01:30 and 2023-10-01 02:00 -> 02:30
+		{"half-hour shift fall back every hour", "0 * * * *", "Australia/Lord_Howe", "2023-04-02T00:30:00+11:00", []string{
+			"2023-04-02T01:00:00+11:00",
+			"2023-04-02T02:00:00+10:30",
+			"2023-04-02T03:00:00+10:30",
+		}},
+		{"half-hour shift fall back", "45 1 * * *", "Australia/Lord_Howe", "2023-04-01T12:00:00+11:00", []string{
+			"2023-04-02T01:45:00+11:00",
+			"2023-04-03T01:45:00+10:30",
+		}},
+		{"half-hour shift spring forward", "15 2 * * *", "Australia/Lord_Howe", "2023-09-30T12:00:00+10:30", []string{
+			"2023-10-01T02:30:00+11:00",
+			"2023-10-02T02:15:00+11:00",
+		}},
+		{"half-hour shift spring forward every hour", "0 * * * *", "Australia/Lord_Howe", "2023-10-01T00:30:00+10:30", []string{
+			"2023-10-01T01:00:00+10:30",
+			"2023-10-01T03:00:00+11:00",
+		}},
+	}
+	for _, test := range tests {
+		s, err := parseCron(test.spec, test.timeZone)
+		if err != nil {
+			t.Errorf("%s: parseCron(%q, %q) failed: %v", test.name, test.spec, test.timeZone, err)
+			continue
+		}
+		from, err := time.Parse(time.RFC3339Nano, test.from)
+		if err != nil {
+			t.Fatalf("%s: invalid time %v", test.name, test.from)
+		}
+		for _, firing := range test.firings {
+			expected, err := time.Parse(time.RFC3339, firing)
+			if err != nil {
+				t.Fatalf("%s: invalid time %v", test.name, firing)
+			}
+			next := s.next(from)
+			if !next.Equal(expected) {
+				t.Errorf("%s: next(%v) = %v, want %v", test.name, from.Format(time.RFC3339), next.Format(time.RFC3339), firing)
+				break
+			}
+			if _, offset := next.Zone(); offset != zoneOffset(expected) {
+				t.Errorf("%s: next(%v) = %v is not in time zone %q", test.name, from.Format(time.RFC3339), next.Format(time.RFC3339), test.timeZone)
+			}
+			from = next
+		}
+	}
+}
+
+// offset of a time parsed from RFC3339
+func zoneOffset(t time.Time) int {
+	_, offset := t.Zone()
+	return offset
+}
+
+func TestCronParseErrors(t *testing.T) {
+	tests := []struct {
+		spec, timeZone string
+	}{
+		{"* * * *", ""},
+		{"* * * * * * *", ""},
+		{"60 * * * *", ""},
+		{"* 24 * * *", ""},
+		{"* * 0 * *", ""},
+		{"* * 32 * *", ""},
+		{"* * * 13 *", ""},
+		{"* * * * 8", ""},
+		{"* * * foo *", ""},
+		{"5-1 * * * *", ""},
+		{"*/0 * * * *", ""},
+		{"*/x * * * *", ""},
+		{"0 0 30 2 *", ""}, // never fires
+		{"@never", ""},
+		{"* * * * *", "Mars/Olympus_Mons"},
+	}
+	for _, test := range tests {
+		if _, err := parseCron(test.spec, test.timeZone); err == nil {
+			t.Errorf("parseCron(%q, %q) succeeded, want error", test.spec, test.timeZone)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package runtime
+
+/*
+ * This file contains a parser and evaluator for the filter and projection
+ * expressions of event subscriptions.
+ *
+ * A filter is a boolean expression combining comparisons (==, !=, <, <=, >, >=)
+ * with &&, ||, !, and parentheses. Operands are literals (strings in single or
+ * double quotes, numbers, true, false, null) or references to the event:
+ *   ce.<attribute>  a CloudEvent attribute (binary or structured mode)
+ *   header.<name>   a Kafka header
+ *   key             the Kafka key of the event (null if none)
+ *   body.<field>    a field of the JSON body (body alone denotes the entire body)
+ * Fields can be nested (body.order.total), names that are not identifiers can be
+ * quoted using brackets (header["content-type"]), and array elements are selected
+ * using indices (body.items[0]). A reference that does not resolve evaluates to null.
+ * An operand used as a condition is true unless it is null, false, 0, or "".
+ *
+ * A projection is either a reference or a JSON object whose values are references,
+ * for instance {"id": "body.order.id", "type": "ce.type"}.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/kar/core/pkg/rpc"
+)
+
+// the event being evaluated
+type eventEnv struct {
+	event     rpc.Event
+	jsonBody  bool                   // is the body expected to be JSON?
+	body      interface{}            // decoded body
+	decoded   bool                   // has the body been decoded?
+	ce        map[string]interface{} // structured representation of the CloudEvent, nil if not a CloudEvent
+	ceDecoded bool                   // has the CloudEvent been decoded?
+}
+
+// value of the root of a reference
+func (e *eventEnv) root(name string) interface{} {
+	switch name {
+	case "header":
+		return stringMap(e.event.Headers)
+	case "body":
+		return e.decodeBody()
+	case "key":
+		if e.event.Key == nil {
+			return nil
+		}
+		return string(e.event.Key)
+	case "ce":
+		attributes := map[string]interface{}{}
+		for k, v := range e.cloudEvent() {
+			if k != "data" && k != "data_base64" {
+				attributes[k] = v
+			}
+		}
+		return attributes
+	}
+	return nil
+}
+
+func (e *eventEnv) decodeBody() interface{} {
+	if !e.decoded {
+		e.decoded = true
+		if !e.jsonBody || json.Unmarshal(e.event.Value, &e.body) != nil {
+			e.body = string(e.event.Value)
+		}
+	}
+	return e.body
+}
+
+func stringMap(m map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// an expression
+type eventExpr interface {
+	eval(env *eventEnv) interface{}
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+type referenceExpr struct {
+	root string
+	path []interface{} // field names and array indices
+}
+
+type notExpr struct {
+	x eventExpr
+}
+
+type binaryExpr struct {
+	op   string
+	x, y eventExpr
+}
+
+func (e literalExpr) eval(env *eventEnv) interface{} {
+	return e.value
+}
+
+func (e referenceExpr) eval(env *eventEnv) interface{} {
+	v := env.root(e.root)
+	for _, step := range e.path {
+		switch s := step.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			v = m[s]
+		case int:
+			a, ok := v.([]interface{})
+			if !ok || s < 0 || s >= len(a) {
+				return nil
+			}
+			v = a[s]
+		}
+	}
+	return v
+}
+
+func (e notExpr) eval(env *eventEnv) interface{} {
+	return !truthy(e.x.eval(env))
+}
+
+func (e binaryExpr) eval(env *eventEnv) interface{} {
+	switch e.op {
+	case "&&":
+		return truthy(e.x.eval(env)) && truthy(e.y.eval(env))
+	case "||":
+		return truthy(e.x.eval(env)) || truthy(e.y.eval(env))
+	}
+	return compareValues(e.op, e.x.eval(env), e.y.eval(env))
+}
+
+// truthy converts a value to a boolean
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// compareValues compares two values, converting strings to numbers when compared to numbers
+func compareValues(op string, x, y interface{}) bool {
+	if _, ok := x.(float64); ok {
+		y = numericString(y)
+	} else if _, ok := y.(float64); ok {
+		x = numericString(x)
+	}
+	switch op {
+	case "==":
+		return reflect.DeepEqual(x, y)
+	case "!=":
+		return !reflect.DeepEqual(x, y)
+	}
+	var c int
+	switch a := x.(type) {
+	case float64:
+		b, ok := y.(float64)
+		if !ok {
+			return false
+		}
+		if a < b {
+			c = -1
+		} else if a > b {
+			c = 1
+		}
+	case string:
+		b, ok := y.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(a, b)
+	default:
+		return false
+	}
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// numericString converts a string to a number if possible
+func numericString(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+// a projection of an event
+type eventProjection struct {
+	ref    eventExpr            // a single reference
+	fields map[string]eventExpr // or an object whose values are references
+}
+
+func (p *eventProjection) eval(env *eventEnv) interface{} {
+	if p.fields == nil {
+		return p.ref.eval(env)
+	}
+	result := make(map[string]interface{}, len(p.fields))
+	for k, ref := range p.fields {
+		result[k] = ref.eval(env)
+	}
+	return result
+}
+
+// parseEventFilter parses a filter expression
+func parseEventFilter(expr string) (eventExpr, error) {
+	p, err := newExprParser(expr)
+	if err != nil {
+		return nil, err
+	}
+	x, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("invalid filter %q: unexpected %q", expr, p.peek())
+	}
+	return x, nil
+}
+
+// parseEventProjection parses a reference or a JSON object whose values are references
+func parseEventProjection(spec string) (*eventProjection, error) {
+	if strings.HasPrefix(strings.TrimSpace(spec), "{") {
+		var m map[string]string
+		if err := json.Unmarshal([]byte(spec), &m); err != nil {
+			return nil, fmt.Errorf("invalid projection %q: %v", spec, err)
+		}
+		p := &eventProjection{fields: make(map[string]eventExpr, len(m))}
+		for k, v := range m {
+			ref, err := parseEventReference(v)
+			if err != nil {
+				return nil, err
+			}
+			p.fields[k] = ref
+		}
+		return p, nil
+	}
+	ref, err := parseEventReference(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &eventProjection{ref: ref}, nil
+}
+
+func parseEventReference(spec string) (eventExpr, error) {
+	p, err := newExprParser(spec)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ref.(referenceExpr); !ok || !p.done() {
+		return nil, fmt.Errorf("invalid projection %q: expected a reference", spec)
+	}
+	return ref, nil
+}
+
+// tokens are identifiers, numbers, quoted strings, and operators
+type exprToken struct {
+	kind  rune // 'i' for identifiers, 'n' for numbers, 's' for strings, 'o' for operators
+	text  string
+	value interface{} // value of a number or string
+}
+
+type exprParser struct {
+	expr   string
+	tokens []exprToken
+	pos    int
+}
+
+func newExprParser(expr string) (*exprParser, error) {
+	p := &exprParser{expr: expr}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(expr) && (expr[j] == '_' || expr[j] >= 'a' && expr[j] <= 'z' || expr[j] >= 'A' && expr[j] <= 'Z' || expr[j] >= '0' && expr[j] <= '9') {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: 'i', text: expr[i:j]})
+			i = j
+		case c >= '0' && c <= '9' || c == '-':
+			j := i + 1
+			for j < len(expr) {
+				d := expr[j]
+				if !(d >= '0' && d <= '9' || d == '.' || d == 'e' || d == 'E' || (d == '-' || d == '+') && (expr[j-1] == 'e' || expr[j-1] == 'E')) {
+					break
+				}
+				j++
+			}
+			f, err := strconv.ParseFloat(expr[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expression %q: bad number %q", expr, expr[i:j])
+			}
+			p.tokens = append(p.tokens, exprToken{kind: 'n', text: expr[i:j], value: f})
+			i = j
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(expr) && expr[j] != c; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				sb.WriteByte(expr[j])
+			}
+			if j == len(expr) {
+				return nil, fmt.Errorf("invalid expression %q: unterminated string", expr)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: 's', text: expr[i : j+1], value: sb.String()})
+			i = j + 1
+		default:
+			op := ""
+			for _, o := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", "."} {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("invalid expression %q: unexpected character %q", expr, c)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: 'o', text: op})
+			i += len(op)
+		}
+	}
+	return p, nil
+}
+
+func (p *exprParser) done() bool {
+	return p.pos == len(p.tokens)
+}
+
+func (p *exprParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos].text
+}
+
+// accept consumes the next token if it is the given operator
+func (p *exprParser) accept(op string) bool {
+	if !p.done() && p.tokens[p.pos].kind == 'o' && p.tokens[p.pos].text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (eventExpr, error) {
+	x, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var y eventExpr
+		y, err = p.parseAnd()
+		x = binaryExpr{op: "||", x: x, y: y}
+	}
+	return x, err
+}
+
+func (p *exprParser) parseAnd() (eventExpr, error) {
+	x, err := p.parseUnary()
+	for err == nil && p.accept("&&") {
+		var y eventExpr
+		y, err = p.parseUnary()
+		x = binaryExpr{op: "&&", x: x, y: y}
+	}
+	return x, err
+}
+
+func (p *exprParser) parseUnary() (eventExpr, error) {
+	if p.accept("!") {
+		x, err := p.parseUnary()
+		return notExpr{x: x}, err
+	}
+	x, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			y, err := p.parseOperand()
+			return binaryExpr{op: op, x: x, y: y}, err
+		}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseOperand() (eventExpr, error) {
+	if p.accept("(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("invalid expression %q: expected \")\"", p.expr)
+		}
+		return x, nil
+	}
+	if p.done() {
+		return nil, fmt.Errorf("invalid expression %q: unexpected end", p.expr)
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case 'n', 's':
+		return literalExpr{value: t.value}, nil
+	case 'i':
+		switch t.text {
+		case "true":
+			return literalExpr{value: true}, nil
+		case "false":
+			return literalExpr{value: false}, nil
+		case "null":
+			return literalExpr{value: nil}, nil
+		case "ce", "header", "body", "key":
+			return p.parseReference(t.text)
+		}
+		return nil, fmt.Errorf("invalid expression %q: unknown reference %q, expected ce, header, body, or key", p.expr, t.text)
+	}
+	return nil, fmt.Errorf("invalid expression %q: unexpected %q", p.expr, t.text)
+}
+
+func (p *exprParser) parseReference(root string) (eventExpr, error) {
+	ref := referenceExpr{root: root}
+	for {
+		if p.accept(".") {
+			if p.done() || p.tokens[p.pos].kind != 'i' {
+				return nil, fmt.Errorf("invalid expression %q: expected a field name after \".\"", p.expr)
+			}
+			ref.path = append(ref.path, p.tokens[p.pos].text)
+			p.pos++
+		} else if p.accept("[") {
+			if p.done() {
+				return nil, fmt.Errorf("invalid expression %q: unexpected end", p.expr)
+			}
+			t := p.tokens[p.pos]
+			p.pos++
+			switch t.kind {
+			case 's':
+				ref.path = append(ref.path, t.value)
+			case 'n':
+				ref.path = append(ref.path, int(t.value.(float64)))
+			default:
+				return nil, fmt.Errorf("invalid expression %q: expected a string or an index after \"[\"", p.expr)
+			}
+			if !p.accept("]") {
+				return nil, fmt.Errorf("invalid expression %q: expected \"]\"", p.expr)
+			}
+		} else {
+			return ref, nil
+		}
+	}
+}
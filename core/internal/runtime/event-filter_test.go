@@ -0,0 +1,275 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package runtime
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/IBM/kar/core/pkg/rpc"
+)
+
+// the event used to evaluate filters and projections
+func testEventEnv() *eventEnv {
+	return &eventEnv{
+		event: rpc.Event{
+			Key: []byte("customer-42"),
+			Value: []byte(`{"order": {"id": "o-1", "total": 250, "count": "3", "items": [{"sku": "a"}, {"sku": "b"}]},
+				"status": "shipped", "flag": false, "zero": 0, "empty": "", "missing": null, "content-type": "odd"}`),
+			Headers: map[string]string{"region": "eu", "content-type": "application/json", "ce_specversion": "1.0",
+				"ce_type": "order.shipped", "ce_id": "1", "ce_source": "shop", "version": "10"},
+		},
+		jsonBody: true,
+	}
+}
+
+func TestEventFilterParseErrors(t *testing.T) {
+	tests := []struct {
+		filter string
+		err    string
+	}{
+		{"", "unexpected end"},
+		{"body.a ==", "unexpected end"},
+		{"body.a == 1 )", `unexpected ")"`},
+		{"(body.a == 1", `expected ")"`},
+		{"body.a == 'x", "unterminated string"},
+		{`body.a == "x`, "unterminated string"},
+		{"body.a = 1", `unexpected character '='`},
+		{"body.a == 1 & body.b", `unexpected character '&'`},
+		{"body.a == 1 | body.b", `unexpected character '|'`},
+		{"body.a == 1.2.3", "bad number"},
+		{"body.a == -", "bad number"},
+		{"data.a == 1", `unknown reference "data"`},
+		{"body.a == b", `unknown reference "b"`},
+		{"body.", `expected a field name after "."`},
+		{"body.1", `expected a field name after "."`},
+		{"body[", "unexpected end"},
+		{"body[a]", `expected a string or an index after "["`},
+		{"body['a'", `expected "]"`},
+		{"body.a == 1 == 2", `unexpected "=="`},
+		{"body.a body.b", `unexpected "body"`},
+		{"body.a == #", `unexpected character '#'`},
+		{"&& body.a", `unexpected "&&"`},
+	}
+	for _, test := range tests {
+		_, err := parseEventFilter(test.filter)
+		if err == nil {
+			t.Errorf("parseEventFilter(%q) succeeded, want error containing %q", test.filter, test.err)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parseEventFilter(%q) returned error %q, want error containing %q", test.filter, err, test.err)
+		}
+	}
+}
+
+func TestEventFilterEval(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		// literals and truthiness
+		{"true", true},
+		{"false", false},
+		{"null", false},
+		{"1", true},
+		{"0", false},
+		{"'x'", true},
+		{"''", false},
+		{"body.status", true},
+		{"body.flag", false},
+		{"body.zero", false},
+		{"body.empty", false},
+		{"body.missing", false},
+		{"body.undefined", false},
+		{"body.order", true},
+		{"body.order.items", true},
+
+		// references
+		{"body.status == 'shipped'", true},
+		{`body.status == "shipped"`, true},
+		{"body.order.id == 'o-1'", true},
+		{"body.order.items[1].sku == 'b'", true},
+		{"body.order.items[2].sku == null", true},
+		{"body.order.items[-1] == null", true},
+		{"body.order.id[0] == null", true},
+		{"body.status.sub == null", true},
+		{"body['status'] == 'shipped'", true},
+		{`body["order"]["items"][0]["sku"] == 'a'`, true},
+		{`body["content-type"] == 'odd'`, true},
+		{`header["content-type"] == 'application/json'`, true},
+		{"header.region == 'eu'", true},
+		{"header.zone == null", true},
+		{"key == 'customer-42'", true},
+		{"ce.type == 'order.shipped'", true},
+		{"ce.source == 'shop' && ce.specversion == '1.0'", true},
+		{"ce.data == null", true},
+		{"body.missing == null && body.undefined == null", true},
+		{"body.missing == body.undefined", true},
+
+		// number and string coercion
+		{"body.order.total == 250", true},
+		{"body.order.total == 250.0", true},
+		{"body.order.total == 2.5e2", true},
+		{"body.order.total == '250'", true},
+		{"'250' == body.order.total", true},
+		{"body.order.total > '99'", true},
+		{"body.order.count == 3", true},
+		{"body.order.count == '3'", true},
+		{"body.order.count == '3.0'", false},
+		{"body.order.count >= 3", true},
+		{"header.version > 9", true},
+		{"header.version > '9'", false}, // string comparison
+		{"header.version < '9'", true},
+		{"body.status == 1", false},
+		{"body.status < 1", false},
+		{"body.status > 1", false},
+		{"body.status != 1", true},
+		{"body.order.total > -1", true},
+		{"body.order.total < 1e3", true},
+		{"body.order.total <= 250", true},
+		{"body.order.total < 250", false},
+		{"body.order.total >= 251", false},
+		{"body.flag == false", true},
+		{"body.flag < true", false}, // booleans are not ordered
+		{"body.missing < 1", false},
+		{"body.order == body.order", true},
+		{"'abc' < 'abd'", true},
+		{"'b' > 'abc'", true},
+
+		// operator precedence and associativity
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"false && false || true", true},
+		{"false && (false || true)", false},
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"!!true", true},
+		{"!body.status", false},
+		{"!body.undefined", true},
+		{"!body.status == 'pending'", true}, // negation applies to the comparison
+		{"body.status == 'shipped' && body.order.total > 100 || key == 'x'", true},
+		{"key == 'x' || body.status == 'shipped' && body.order.total > 1000", false},
+		{"body.status != 'shipped' || header.region == 'eu' && !(key == null)", true},
+	}
+	for _, test := range tests {
+		x, err := parseEventFilter(test.filter)
+		if err != nil {
+			t.Errorf("parseEventFilter(%q) failed: %v", test.filter, err)
+			continue
+		}
+		if got := truthy(x.eval(testEventEnv())); got != test.want {
+			t.Errorf("filter %q evaluated to %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestEventFilterNonJSONBody(t *testing.T) {
+	env := &eventEnv{event: rpc.Event{Value: []byte(`{"a": 1}`)}}
+	x, err := parseEventFilter(`body == '{"a": 1}' && body.a == null && key == null`)
+	if err != nil {
+		t.Fatalf("parseEventFilter failed: %v", err)
+	}
+	if !truthy(x.eval(env)) {
+		t.Errorf("body of a non-JSON event is not a string")
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		op   string
+		x, y interface{}
+		want bool
+	}{
+		{"==", 1.0, "1", true},
+		{"==", "1", 1.0, true},
+		{"==", "01", 1.0, true},
+		{"==", "01", "1", false},
+		{"==", "x", 1.0, false},
+		{"<", "2", 10.0, true},
+		{"<", "2", "10", false},
+		{"<", 2.0, "x", false},
+		{">", "x", 2.0, false},
+		{"==", nil, nil, true},
+		{"!=", nil, 0.0, true},
+		{"==", true, true, true},
+		{"<=", true, true, false},
+		{"==", map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": 1.0}, true},
+		{"==", []interface{}{"a"}, []interface{}{"b"}, false},
+		{"?", 1.0, 1.0, false},
+	}
+	for _, test := range tests {
+		if got := compareValues(test.op, test.x, test.y); got != test.want {
+			t.Errorf("compareValues(%q, %#v, %#v) = %v, want %v", test.op, test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestEventProjection(t *testing.T) {
+	tests := []struct {
+		projection string
+		want       interface{}
+	}{
+		{"body.order.id", "o-1"},
+		{"body.order.items[0]", map[string]interface{}{"sku": "a"}},
+		{`body["content-type"]`, "odd"},
+		{"body.undefined", nil},
+		{"key", "customer-42"},
+		{"header.region", "eu"},
+		{"ce.type", "order.shipped"},
+		{" body.status ", "shipped"},
+		{`{"id": "body.order.id", "type": "ce.type", "skus": "body.order.items", "none": "body.undefined"}`,
+			map[string]interface{}{
+				"id":   "o-1",
+				"type": "order.shipped",
+				"skus": []interface{}{map[string]interface{}{"sku": "a"}, map[string]interface{}{"sku": "b"}},
+				"none": nil,
+			}},
+		{`{}`, map[string]interface{}{}},
+	}
+	for _, test := range tests {
+		p, err := parseEventProjection(test.projection)
+		if err != nil {
+			t.Errorf("parseEventProjection(%q) failed: %v", test.projection, err)
+			continue
+		}
+		if got := p.eval(testEventEnv()); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("projection %q evaluated to %#v, want %#v", test.projection, got, test.want)
+		}
+	}
+}
+
+func TestEventProjectionParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"'literal'",
+		"42",
+		"true",
+		"null",
+		"body.a == 1",
+		"body.a body.b",
+		"data.a",
+		`{"id": 1}`,
+		`{"id": "body.a == 1"}`,
+		`{"id": "'x'"}`,
+		`{"id": "body.a"`,
+	}
+	for _, test := range tests {
+		if _, err := parseEventProjection(test); err == nil {
+			t.Errorf("parseEventProjection(%q) succeeded, want error", test)
+		}
+	}
+}
@@ -19,12 +19,19 @@ package runtime
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/IBM/kar/core/internal/config"
+	"github.com/IBM/kar/core/pkg/logger"
 	"github.com/IBM/kar/core/pkg/rpc"
+	"github.com/IBM/kar/core/pkg/store"
 )
 
 // source describes an event source (subscription)
@@ -43,15 +50,37 @@ type source struct {
 	// The expected MIME type of events delivered by this subscription
 	ContentType string `json:"contenttype,omitempty"`
 	// Use the oldest available offset if no offset was previously committed
-	OffsetOldest bool               `json:"oldestoffset"`
-	cancel       context.CancelFunc // not serialized
-	closed       <-chan struct{}    // not serialized
+	OffsetOldest bool `json:"oldestoffset"`
+	// The topic receiving the events that cannot be delivered
+	DeadLetterTopic string `json:"deadLetterTopic,omitempty"`
+	// The number of times to retry delivering an event before giving up
+	MaxRedelivery int `json:"maxRedelivery,omitempty"`
+	// The expression selecting the events to deliver
+	Filter string `json:"filter,omitempty"`
+	// The projection applied to the events before delivery
+	Projection string `json:"projection,omitempty"`
+	// The maximum number of events delivered per actor invocation, 0 to deliver events one at a time
+	BatchSize int `json:"batchSize,omitempty"`
+	// The maximum time to wait for a batch of events to fill up
+	BatchLinger time.Duration `json:"batchLinger,omitempty"`
+	// Discard the events redelivered to the actor after it processed them (best effort)
+	ExactlyOnce bool `json:"exactlyOnce,omitempty"`
+	// Deliver each event wrapped in an envelope with its topic, partition, offset, key, and headers
+	Envelope bool `json:"envelope,omitempty"`
+	// Is the delivery of events paused?
+	Paused     bool               `json:"paused,omitempty"`
+	filter     eventExpr          // parsed Filter, not serialized
+	projection *eventProjection   // parsed Projection, not serialized
+	cancel     context.CancelFunc // not serialized
+	closed     <-chan struct{}    // not serialized
 }
 
 // EventSubscribeOptions documents the request body for subscribing an actor to a topic
 type EventSubscribeOptions struct {
 	// The expected MIME content type of the events that will be produced by this subscription
-	// If an explicit value is not provided, the default value of application/json+cloudevent will be used.
+	// If an explicit value is not provided, the default value of application/cloudevents+json will be used.
+	// With this content type, CloudEvents in binary mode (ce_ headers) or structured mode are delivered
+	// to the actor in structured mode, exposing the attributes (id, source, type, ...) and the data.
 	// Example: application/json
 	ContentType string `json:"contentType,omitempty"`
 	// The actor method to be invoked with each delivered event
@@ -59,6 +88,64 @@ type EventSubscribeOptions struct {
 	Path string `json:"path"`
 	// The name of the topic being subscribed to
 	Topic string `json:"topic"`
+	// The optional topic to publish events to when they cannot be delivered to the actor.
+	// An event is published unchanged to the dead-letter topic if it cannot be transformed
+	// into an actor invocation (for instance if its body is not valid JSON
+	// while the content type of the subscription is a JSON type) or if it cannot be delivered
+	// after maxRedelivery retries. The headers `DeadLetterError`, `DeadLetterTopic`,
+	// `DeadLetterPartition`, `DeadLetterOffset`, and `DeadLetterAttempts` describe the failure.
+	// If no dead-letter topic is specified, malformed events are logged and skipped,
+	// and events that cannot be delivered are not committed and are consumed again after a delay.
+	// Example: orders-dlt
+	DeadLetterTopic string `json:"deadLetterTopic,omitempty"`
+	// The optional number of times to retry delivering an event before giving up.
+	// Defaults to 0.
+	// Example: 3
+	MaxRedelivery int `json:"maxRedelivery,omitempty"`
+	// The optional expression selecting the events to deliver; other events are skipped.
+	// The expression can compare CloudEvent attributes (`ce.type`), Kafka headers (`header.region`),
+	// and fields of the JSON body (`body.order.total`) with literals using `==`, `!=`, `<`, `<=`, `>`, `>=`,
+	// and combine comparisons using `&&`, `||`, `!`, and parentheses.
+	// Example: ce.type == 'order.created' && body.data.total > 100
+	Filter string `json:"filter,omitempty"`
+	// The optional projection to deliver instead of the event, either a reference
+	// to a part of the event or an object whose values are references.
+	// Example: { "id": "body.data.id", "total": "body.data.total" }
+	Projection interface{} `json:"projection,omitempty"`
+	// The optional maximum number of events to deliver per actor invocation.
+	// If specified, the actor method is invoked with a single argument containing an array of events
+	// and the offsets of the events are committed once the batch is delivered.
+	// Defaults to 0 (events are delivered one at a time).
+	// Example: 100
+	BatchSize int `json:"batchSize,omitempty"`
+	// The optional maximum time to wait for a batch of events to fill up, specified as a GoLang Duration.
+	// Defaults to 0 (the events available are delivered immediately).
+	// Example: 500ms
+	BatchLinger string `json:"batchLinger,omitempty"`
+	// The optional flag requesting a best-effort deduplication of redelivered events.
+	// If true, the offsets of the events successfully processed by the actor are recorded in the persistent store
+	// and events redelivered after a failure of the subscription are not delivered again to the actor.
+	// Delivery remains at least once: the offsets are recorded separately from the state of the actor,
+	// so events are delivered again if the actor instance fails after processing them but before the offsets are recorded.
+	// Defaults to false (no deduplication).
+	// Example: true
+	ExactlyOnce bool `json:"exactlyOnce,omitempty"`
+	// The optional flag requesting that each event be wrapped in an envelope
+	// `{ "topic", "partition", "offset", "key", "headers", "event" }`
+	// exposing the Kafka key and headers of the event unchanged irrespective of its content type.
+	// Defaults to false (events are delivered as is).
+	// Example: true
+	Envelope bool `json:"envelope,omitempty"`
+}
+
+// eventEnvelope wraps an event delivered to a subscription with an envelope
+type eventEnvelope struct {
+	Topic     string            `json:"topic"`
+	Partition int32             `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Key       *string           `json:"key,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Event     json.RawMessage   `json:"event"`
 }
 
 // topicCreateOptions documents the request body for creating a topic
@@ -77,6 +164,8 @@ type sources map[Actor]map[string]source
 
 var karPublisher rpc.Publisher
 
+var eventsLog = logger.New("events")
+
 func init() {
 	pairs["subscriptions"] = pair{bindings: sources{}, mu: &sync.Mutex{}}
 }
@@ -88,10 +177,19 @@ func (c sources) add(ctx context.Context, b binding) (int, error) {
 		c[s.Actor] = map[string]source{}
 	}
 	context, cancel := context.WithCancel(ctx)
-	closed, code, err := subscribe(context, s)
-	if err != nil {
-		cancel()
-		return code, err
+	var closed <-chan struct{}
+	if s.Paused {
+		ch := make(chan struct{})
+		close(ch)
+		closed = ch
+	} else {
+		var code int
+		var err error
+		closed, code, err = subscribe(context, s)
+		if err != nil {
+			cancel()
+			return code, err
+		}
 	}
 	s.cancel = cancel
 	s.closed = closed
@@ -114,6 +212,35 @@ func (c sources) find(actor Actor, id string) []binding {
 	return a
 }
 
+// find bindings of any actor matching filter
+func (c sources) list(f bindingFilter) []binding {
+	a := []binding{}
+	for actor, m := range c {
+		if f.ActorType != "" && actor.Type != f.ActorType {
+			continue
+		}
+		for _, b := range m {
+			if (f.Path == "" || b.Path == f.Path) && (f.Topic == "" || b.Topic == f.Topic) {
+				a = append(a, b)
+			}
+		}
+	}
+	return a
+}
+
+// parse serialized list of bindings
+func (c sources) unmarshal(data []byte) ([]binding, error) {
+	var ss []source
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return nil, err
+	}
+	a := make([]binding, len(ss))
+	for i, s := range ss {
+		a[i] = s
+	}
+	return a, nil
+}
+
 // remove bindings from collection
 func (c sources) cancel(actor Actor, id string) []binding {
 	if id != "" {
@@ -135,60 +262,397 @@ func (c sources) cancel(actor Actor, id string) []binding {
 	return a
 }
 
-func (c sources) parse(actor Actor, id, key, payload string) (binding, map[string]string, error) {
-	var m map[string]string
-	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+func (c sources) parse(ctx context.Context, actor Actor, id, key, payload string) (binding, map[string]string, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &raw); err != nil {
+		return nil, nil, err
+	}
+	// serialize options as strings, encoding non-string values as json
+	m := make(map[string]string, len(raw))
+	for k, v := range raw {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			m[k] = v
+		default:
+			buf, _ := json.Marshal(v)
+			m[k] = string(buf)
+		}
+	}
+	b, err := c.load(actor, id, key, m)
+	if err != nil {
 		return nil, nil, err
 	}
-	b, _ := c.load(actor, id, key, m)
 	return b, m, nil
 }
 
 func (c sources) load(actor Actor, id, key string, m map[string]string) (binding, error) {
-	return source{
-		Actor:        actor,
-		ID:           id,
-		key:          key,
-		Path:         m["path"],
-		Topic:        m["topic"],
-		Group:        m["group"],
-		ContentType:  m["contentType"],
-		OffsetOldest: m["offsetOldest"] == "true",
-	}, nil
+	s := source{
+		Actor:           actor,
+		ID:              id,
+		key:             key,
+		Path:            m["path"],
+		Topic:           m["topic"],
+		Group:           m["group"],
+		ContentType:     m["contentType"],
+		OffsetOldest:    m["offsetOldest"] == "true",
+		DeadLetterTopic: m["deadLetterTopic"],
+		Filter:          m["filter"],
+		Projection:      m["projection"],
+		ExactlyOnce:     m["exactlyOnce"] == "true",
+		Envelope:        m["envelope"] == "true",
+		Paused:          m["paused"] == "true",
+	}
+	var err error
+	if s.Filter != "" {
+		if s.filter, err = parseEventFilter(s.Filter); err != nil {
+			return nil, err
+		}
+	}
+	if s.Projection != "" {
+		if s.projection, err = parseEventProjection(s.Projection); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := m["batchSize"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid batchSize %q", v)
+		}
+		s.BatchSize = n
+	}
+	if v, ok := m["batchLinger"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid batchLinger %q", v)
+		}
+		s.BatchLinger = d
+	}
+	if v, ok := m["maxRedelivery"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid maxRedelivery %q", v)
+		}
+		s.MaxRedelivery = n
+	}
+	return s, nil
 }
 
-func subscribe(ctx context.Context, s source) (<-chan struct{}, int, error) {
-	jsonType := s.ContentType == "" || // default is "application/cloudevents+json"
-		s.ContentType == "text/json" ||
-		s.ContentType == "application/json" ||
-		strings.HasSuffix(s.ContentType, "+json")
-	group := s.Group
-	if group == "" {
-		group = s.ID
+// getAllSubscriptions returns the subscriptions matching filter for all sidecars in the app ordered by actor and id
+func getAllSubscriptions(ctx context.Context, f bindingFilter) ([]source, error) {
+	found, err := getAllBindings(ctx, "subscriptions", f)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions := make([]source, len(found))
+	for i, b := range found {
+		subscriptions[i] = b.(source)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		a, b := subscriptions[i], subscriptions[j]
+		if a.Actor.Type != b.Actor.Type {
+			return a.Actor.Type < b.Actor.Type
+		}
+		if a.Actor.ID != b.Actor.ID {
+			return a.Actor.ID < b.Actor.ID
+		}
+		return a.ID < b.ID
+	})
+	return subscriptions, nil
+}
+
+// redis key for the offsets of the events processed by an actor subscription with deduplication
+// the fields of the hash are topic and partition pairs
+func eventOffsetsKey(actor Actor, id string) string {
+	return actorKey(actor.Type, actor.ID, "pubsub"+config.Separator+"offsets"+config.Separator+actor.Type+config.Separator+actor.ID+config.Separator+id)
+}
+
+// dedupEvents removes the events already processed by the actor from a deduplicated delivery
+// and returns false if there is nothing left to deliver
+func dedupEvents(ctx context.Context, actor Actor, msg map[string]string) (bool, error) {
+	key := eventOffsetsKey(actor, msg["eventSubscription"])
+	field := msg["eventTopic"] + config.Separator + msg["eventPartition"]
+	last, err := strconv.ParseInt(msg["eventLastOffset"], 10, 64)
+	if err != nil {
+		return false, err
+	}
+	processed := int64(-1)
+	v, err := store.HGet(ctx, key, field)
+	if err == nil {
+		if processed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return false, err
+		}
+	} else if err != store.ErrNil {
+		return false, err
+	}
+	if last <= processed {
+		eventsLog.Debug("skipping duplicate delivery of events up to offset %v of %v to %v", last, field, actor)
+		return false, nil
+	}
+	var offsets []int64
+	if err := json.Unmarshal([]byte(msg["eventOffsets"]), &offsets); err != nil {
+		return false, err
+	}
+	if len(offsets) == 0 || offsets[0] > processed {
+		return true, nil
+	}
+
+	// a batch redelivered after a failure may start with events already processed
+	var batch [][]json.RawMessage
+	if err := json.Unmarshal([]byte(msg["payload"]), &batch); err != nil || len(batch) != 1 || len(batch[0]) != len(offsets) {
+		return false, fmt.Errorf("malformed batch of events for %v", actor)
+	}
+	remaining := []json.RawMessage{}
+	for i, offset := range offsets {
+		if offset > processed {
+			remaining = append(remaining, batch[0][i])
+		}
+	}
+	if len(remaining) == 0 {
+		recordEvents(ctx, actor, msg)
+		return false, nil
+	}
+	buf, err := json.Marshal([][]json.RawMessage{remaining})
+	if err != nil {
+		return false, err
+	}
+	msg["payload"] = string(buf)
+	return true, nil
+}
+
+// recordEvents records the offset of the last event of a deduplicated delivery once the actor method succeeded
+func recordEvents(ctx context.Context, actor Actor, msg map[string]string) {
+	key := eventOffsetsKey(actor, msg["eventSubscription"])
+	field := msg["eventTopic"] + config.Separator + msg["eventPartition"]
+	if _, err := store.HSet(ctx, key, field, msg["eventLastOffset"]); err != nil {
+		eventsLog.Error("failed to record the offset of the events delivered to %v: %v", actor, err)
+	}
+}
+
+// consumer group of a subscription
+func (s source) group() string {
+	if s.Group != "" {
+		return s.Group
+	}
+	return s.ID
+}
+
+// parseSeekPosition parses the request body of a seek operation
+// {"offset": <offset>|"oldest"|"newest", "time": <RFC3339 time>|<duration before now>, "partition": <partition>}
+func parseSeekPosition(payload string) (rpc.SeekPosition, error) {
+	var position rpc.SeekPosition
+	var body struct {
+		Offset    interface{} `json:"offset"`
+		Time      string      `json:"time"`
+		Partition *int32      `json:"partition"`
+	}
+	if err := json.Unmarshal([]byte(payload), &body); err != nil {
+		return position, err
+	}
+	position.Partition = body.Partition
+	if (body.Offset == nil) == (body.Time == "") {
+		return position, fmt.Errorf("exactly one of offset and time must be specified")
+	}
+	switch offset := body.Offset.(type) {
+	case nil:
+		if t, err := time.Parse(time.RFC3339Nano, body.Time); err == nil {
+			position.Time = t
+		} else if d, err := time.ParseDuration(body.Time); err == nil && d >= 0 {
+			position.Time = time.Now().Add(-d)
+		} else {
+			return position, fmt.Errorf("invalid time %q, expected an RFC3339 time or a duration", body.Time)
+		}
+	case float64:
+		if offset < 0 || offset != float64(int64(offset)) {
+			return position, fmt.Errorf("invalid offset %v", offset)
+		}
+		n := int64(offset)
+		position.Offset = &n
+	case string:
+		n := rpc.OffsetOldest
+		if offset == "newest" {
+			n = rpc.OffsetNewest
+		} else if offset != "oldest" {
+			return position, fmt.Errorf("invalid offset %q, expected a number, oldest, or newest", offset)
+		}
+		position.Offset = &n
+	default:
+		return position, fmt.Errorf("invalid offset %v", offset)
+	}
+	return position, nil
+}
+
+// subscriptionControl pauses, resumes, or seeks a subscription, or reports its lag
+func subscriptionControl(ctx context.Context, actor Actor, msg map[string]string) ([]byte, error) {
+	pair := pairs["subscriptions"]
+	pair.mu.Lock()
+	defer pair.mu.Unlock()
+	c := pair.bindings.(sources)
+	id := msg["bindingId"]
+	s, ok := c[actor][id]
+	if !ok {
+		return json.Marshal(Reply{StatusCode: http.StatusNotFound, Payload: fmt.Sprintf("subscription %v not found", id), ContentType: "text/plain"})
+	}
+
+	// restart the subscription after applying f to the stopped subscription
+	restart := func(f func() error) Reply {
+		c.cancel(actor, id)
+		err := f()
+		if code, err := c.add(ctx, s); err != nil {
+			eventsLog.Error("failed to restart subscription %v of %v: %v", id, actor, err)
+			return Reply{StatusCode: code, Payload: err.Error(), ContentType: "text/plain"}
+		}
+		if err != nil {
+			if invalidPartition(err) {
+				return Reply{StatusCode: http.StatusBadRequest, Payload: err.Error(), ContentType: "text/plain"}
+			}
+			return Reply{StatusCode: http.StatusInternalServerError, Payload: err.Error(), ContentType: "text/plain"}
+		}
+		return Reply{StatusCode: http.StatusOK, Payload: "OK", ContentType: "text/plain"}
 	}
 
-	rawEventToActorTellMsg := func(ctx context.Context, value []byte) ([]byte, error) {
+	var reply Reply
+	switch msg["command"] {
+	case "pause", "resume":
+		paused := msg["command"] == "pause"
+		reply = Reply{StatusCode: http.StatusOK, Payload: "OK", ContentType: "text/plain"}
+		if s.Paused != paused {
+			reply = restart(func() error {
+				s.Paused = paused
+				_, err := store.HSet(ctx, s.key, "paused", strconv.FormatBool(paused))
+				return err
+			})
+		}
+	case "seek":
+		position, err := parseSeekPosition(msg["payload"])
+		if err != nil {
+			reply = Reply{StatusCode: http.StatusBadRequest, Payload: err.Error(), ContentType: "text/plain"}
+			break
+		}
+		reply = restart(func() error {
+			if err := rpc.Seek(&config.KafkaConfig, s.Topic, s.group(), position); err != nil {
+				return err
+			}
+			if s.ExactlyOnce { // forget processed events to permit replay
+				if _, err := store.Del(ctx, eventOffsetsKey(actor, id)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case "lag":
+		lag, err := rpc.Lag(&config.KafkaConfig, s.Topic, s.group(), s.OffsetOldest)
+		if err != nil {
+			reply = Reply{StatusCode: http.StatusInternalServerError, Payload: err.Error(), ContentType: "text/plain"}
+			break
+		}
+		buf, _ := json.Marshal(lag)
+		reply = Reply{StatusCode: http.StatusOK, Payload: string(buf), ContentType: "application/json"}
+	}
+	return json.Marshal(reply)
+}
+
+func subscribe(ctx context.Context, s source) (<-chan struct{}, int, error) {
+	jsonType := s.ContentType == "" || isJSONContentType(s.ContentType) // default is "application/cloudevents+json"
+	cloudEvents := s.ContentType == "" || isCloudEventsContentType(s.ContentType)
+	group := s.group()
+
+	rawEventToArg := func(event rpc.Event) (string, bool, error) {
+		value := event.Value
 		arg := string(value)
 
-		// If the event is not already encoded as json, encode it as a json string
-		if !jsonType {
+		env := &eventEnv{event: event, jsonBody: jsonType}
+		// the body must be valid JSON unless it is the data of a CloudEvent in binary mode
+		if jsonType && !json.Valid(value) && !(cloudEvents && env.cloudEvent() != nil) {
+			return "", false, errors.New("malformed JSON event")
+		}
+		if s.filter != nil && !truthy(s.filter.eval(env)) {
+			return "", false, nil // skip event
+		}
+
+		if s.projection != nil {
+			buf, err := json.Marshal(s.projection.eval(env))
+			if err != nil {
+				return "", false, err
+			}
+			arg = string(buf)
+		} else if ce := env.cloudEvent(); cloudEvents && ce != nil {
+			// deliver CloudEvents in structured mode
+			addCloudEventExtensions(ce, event)
+			buf, err := json.Marshal(ce)
+			if err != nil {
+				return "", false, err
+			}
+			arg = string(buf)
+		} else if !jsonType {
+			// If the event is not already encoded as json, encode it as a json string
 			buf, err := json.Marshal(string(value))
 			if err != nil {
-				return nil, err
+				return "", false, err
 			}
 			arg = string(buf)
 		}
+		if s.Envelope {
+			envelope := eventEnvelope{Topic: event.Topic, Partition: event.Partition, Offset: event.Offset, Headers: event.Headers, Event: json.RawMessage(arg)}
+			if event.Key != nil {
+				key := string(event.Key)
+				envelope.Key = &key
+			}
+			buf, err := json.Marshal(envelope)
+			if err != nil {
+				return "", false, err
+			}
+			arg = string(buf)
+		}
+		return arg, true, nil
+	}
+
+	rawEventToActorTellMsg := func(ctx context.Context, events []rpc.Event) ([]byte, error) {
+		args := make([]string, 0, len(events))
+		offsets := make([]int64, 0, len(events)) // offsets of the delivered events
+		for _, event := range events {
+			arg, ok, err := rawEventToArg(event)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				args = append(args, arg)
+				offsets = append(offsets, event.Offset)
+			}
+		}
+		if len(args) == 0 {
+			return nil, nil // skip events
+		}
+
+		// a batch of events is delivered as a single array argument
+		payload := "[" + args[0] + "]"
+		if s.BatchSize > 0 {
+			payload = "[[" + strings.Join(args, ",") + "]]"
+		}
 
 		// mirror command encoding from TellActor from commands.go
 		msg := map[string]string{
 			"command": "tell", // post with no callback expected
 			"path":    s.Path,
-			"payload": "[" + arg + "]"}
+			"payload": payload}
+
+		if s.ExactlyOnce {
+			// events of a batch share the same topic and partition
+			last := events[len(events)-1]
+			buf, _ := json.Marshal(offsets)
+			msg["eventSubscription"] = s.ID
+			msg["eventTopic"] = last.Topic
+			msg["eventPartition"] = strconv.Itoa(int(last.Partition))
+			msg["eventOffsets"] = string(buf)
+			msg["eventLastOffset"] = strconv.FormatInt(last.Offset, 10)
+		}
 
 		return json.Marshal(msg)
 	}
 
-	ch, err := rpc.Subscribe(ctx, &config.KafkaConfig, s.Topic, group, s.OffsetOldest,
+	options := rpc.SubscribeOptions{OffsetOldest: s.OffsetOldest, DeadLetterTopic: s.DeadLetterTopic,
+		MaxRedelivery: s.MaxRedelivery, BatchSize: s.BatchSize, BatchLinger: s.BatchLinger, ExactlyOnce: s.ExactlyOnce}
+	ch, err := rpc.Subscribe(ctx, &config.KafkaConfig, s.Topic, group, options,
 		rpc.Destination{Target: rpc.Session{Name: s.Actor.Type, ID: s.Actor.ID, Flow: newFlowId()}, Method: actorEndpoint}, rawEventToActorTellMsg)
 
 	if err == nil {
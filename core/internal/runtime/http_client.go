@@ -33,6 +33,9 @@ import (
 	"github.com/IBM/kar/core/pkg/logger"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/http2"
 )
 
@@ -81,6 +84,13 @@ func invoke(ctx context.Context, method string, msg map[string]string, metricLab
 	default:
 	}
 
+	var span trace.Span
+	if metricLabel != "" { // do not trace probes
+		ctx, span = tracer().Start(ctx, "kar.invoke "+metricLabel, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("http.method", method), attribute.String("http.target", msg["path"])))
+		defer span.End()
+	}
+
 	req, err := http.NewRequestWithContext(ctx, method, url+msg["path"], strings.NewReader(msg["payload"]))
 
 	if err != nil {
@@ -105,6 +115,7 @@ func invoke(ctx context.Context, method string, msg map[string]string, metricLab
 			req.Header.Set("Accept", msg["accept"])
 		}
 	}
+	setTraceHeaders(ctx, req.Header) // replace the trace context of the original caller if any
 	var reply *Reply
 	b := backoff.NewExponentialBackOff()
 	if config.RequestRetryLimit >= 0 {
@@ -160,6 +171,17 @@ func invoke(ctx context.Context, method string, msg map[string]string, metricLab
 	if err != nil && err != ctx.Err() {
 		logger.Warning("failed to invoke %s: %v", msg["path"], err)
 	}
+	if span != nil {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetAttributes(attribute.Int("http.status_code", reply.StatusCode))
+			if reply.StatusCode >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(reply.StatusCode))
+			}
+		}
+	}
 	return reply, err
 }
 
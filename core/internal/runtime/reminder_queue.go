@@ -19,6 +19,7 @@ package runtime
 import (
 	"container/heap"
 	"context"
+	"encoding/json"
 	"net/http"
 	"time"
 )
@@ -89,6 +90,33 @@ func (rq *reminderQueue) find(actor Actor, ID string) []binding {
 	return result
 }
 
+func (rq *reminderQueue) list(f bindingFilter) []binding {
+	result := make([]binding, 0)
+	for _, elem := range *rq {
+		r := elem.r
+		if !elem.cancelled &&
+			(f.ActorType == "" || r.Actor.Type == f.ActorType) &&
+			(f.Path == "" || r.Path == f.Path) &&
+			(f.Before.IsZero() || r.TargetTime.Before(f.Before)) &&
+			(f.After.IsZero() || r.TargetTime.After(f.After)) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+func (rq *reminderQueue) unmarshal(data []byte) ([]binding, error) {
+	var reminders []Reminder
+	if err := json.Unmarshal(data, &reminders); err != nil {
+		return nil, err
+	}
+	result := make([]binding, len(reminders))
+	for i, r := range reminders {
+		result[i] = r
+	}
+	return result, nil
+}
+
 func (rq *reminderQueue) nextReminderBefore(t time.Time) (Reminder, bool) {
 	for len(*rq) > 0 && (*rq)[0].r.TargetTime.Before(t) {
 		re := heap.Pop(rq).(*reminderEntry)
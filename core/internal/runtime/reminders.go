@@ -20,11 +20,17 @@ import (
 	"container/heap"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/IBM/kar/core/internal/config"
 	"github.com/IBM/kar/core/pkg/logger"
+	"github.com/IBM/kar/core/pkg/rpc"
 	"github.com/IBM/kar/core/pkg/store"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -40,6 +46,21 @@ var (
 		Name: "kar_actors_cancelled_reminders_gauge",
 		Help: "KAR number of cancelled reminders whose deadline has not passed.",
 	})
+	deadLetterRemindersCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kar_actors_dead_letter_reminders_total",
+		Help: "KAR number of reminder firings that exhausted their delivery attempts.",
+	})
+	remindersLog = logger.New("reminders")
+)
+
+// default upper bound on the delay between delivery attempts of a reminder
+const defaultMaxRetryBackoff = time.Minute
+
+// misfire policies of periodic and cron reminders
+const (
+	misfireFireOnce      = "fire-once"       // fire late reminder once and resume with the next firing after now
+	misfireFireAllMissed = "fire-all-missed" // fire late reminder once for each missed firing
+	misfireSkip          = "skip"            // do not fire late reminder and resume with the next firing after now
 )
 
 func init() {
@@ -47,6 +68,7 @@ func init() {
 	pairs["reminders"] = pair{bindings: activeReminders, mu: arMutex}
 	prometheus.MustRegister(activeRemindersGauge)
 	prometheus.MustRegister(cancelledRemindersGauge)
+	prometheus.MustRegister(deadLetterRemindersCounter)
 }
 
 // Reminder describes a time-triggered asynchronous invocation of a Path on an Actor
@@ -57,7 +79,68 @@ type Reminder struct {
 	Path        string        `json:"path"`
 	TargetTime  time.Time     `json:"targetTime"`
 	Period      time.Duration `json:"period,omitempty"` // 0 for one-shot reminders
+	Cron        string        `json:"cron,omitempty"`   // "" for reminders without a cron schedule
+	TimeZone    string        `json:"timeZone,omitempty"`
 	EncodedData string        `json:"encodedData,omitempty"`
+	schedule    *cronSchedule // parsed Cron, do not serialize
+
+	MisfirePolicy string    `json:"misfirePolicy,omitempty"` // "" for fire-once
+	scheduledTime time.Time // original target time of a firing being retried, zero if not retrying
+
+	MaxAttempts     int           `json:"maxAttempts,omitempty"`     // 0 for unlimited attempts
+	RetryBackoff    time.Duration `json:"retryBackoff,omitempty"`    // 0 for the default backoff
+	MaxRetryBackoff time.Duration `json:"maxRetryBackoff,omitempty"` // 0 for the default bound
+	Attempts        int           `json:"attempts,omitempty"`        // failed attempts to deliver the current firing
+
+	TraceParent string `json:"traceparent,omitempty"` // W3C trace context of the request that scheduled the reminder
+	TraceState  string `json:"tracestate,omitempty"`
+}
+
+// a reminder firing that exhausted its delivery attempts
+type deadLetterReminder struct {
+	Reminder
+	FailureTime time.Time `json:"failureTime"`
+	Error       string    `json:"error"`
+}
+
+// retryDelay computes the delay before the next attempt to deliver a reminder
+func (r Reminder) retryDelay() time.Duration {
+	delay := r.RetryBackoff
+	if delay <= 0 {
+		delay = config.ActorReminderInterval
+	}
+	bound := r.MaxRetryBackoff
+	if bound <= 0 {
+		bound = defaultMaxRetryBackoff
+	}
+	for i := 1; i < r.Attempts && delay < bound; i++ {
+		delay *= 2
+	}
+	if delay > bound {
+		delay = bound
+	}
+	return delay
+}
+
+// nextTargetTime computes the target time of the firing following the firing
+// scheduled at time t or the zero time if the reminder does not fire again.
+// Unless the policy is to fire all missed firings, the result is after fireTime.
+func (r Reminder) nextTargetTime(t, fireTime time.Time) time.Time {
+	catchUp := r.MisfirePolicy == misfireFireAllMissed
+	if r.Period > 0 {
+		next := t.Add(r.Period) // anchored to t to avoid drift
+		if !catchUp && !next.After(fireTime) {
+			next = next.Add(fireTime.Sub(next).Truncate(r.Period) + r.Period)
+		}
+		return next
+	}
+	if r.schedule != nil {
+		if catchUp {
+			return r.schedule.next(t)
+		}
+		return r.schedule.next(fireTime)
+	}
+	return time.Time{}
 }
 
 func (r Reminder) k() string {
@@ -72,10 +155,43 @@ type scheduleReminderPayload struct {
 	// The time at which the reminder should first fire, specified as a string in an ISO-8601 compliant format
 	TargetTime time.Time `json:"targetTime"`
 	// The optional period parameter is a string encoding a GoLang Duration that is used to create a periodic reminder.
-	// If a period is provided, then the reminder will be fired repeatedly by adding the period to the last fire time
-	// to compute a new TargetTime for the next invocation of the reminder.
+	// If a period is provided, then the reminder will be fired repeatedly by adding the period to the previous
+	// TargetTime to compute a new TargetTime for the next invocation of the reminder.
 	// Example: 30s
 	Period string `json:"period,omitempty"`
+	// The optional cron parameter is a cron expression that is used to create a recurring reminder.
+	// The expression has 5 fields (minute hour day-of-month month day-of-week) or 6 fields (second first).
+	// If a cron expression is provided, the reminder fires at every time matching the expression
+	// starting at the targetTime if provided or now if not. The period and cron parameters are exclusive.
+	// Example: 0 2 1 * *
+	Cron string `json:"cron,omitempty"`
+	// The optional time zone in which to evaluate the cron expression, specified as an IANA time zone name.
+	// Defaults to UTC.
+	// Example: Europe/Paris
+	TimeZone string `json:"timeZone,omitempty"`
+	// The optional policy for periodic and cron reminders that could not fire on time, for instance
+	// because the application or KAR was down. The supported policies are:
+	// `fire-once` to fire once and resume with the first firing after the current time,
+	// `fire-all-missed` to fire once for each missed firing, and
+	// `skip` to not fire and resume with the first firing after the current time.
+	// In all cases the subsequent firings are computed from the original targetTime.
+	// Defaults to fire-once.
+	// Example: fire-all-missed
+	MisfirePolicy string `json:"misfirePolicy,omitempty"`
+	// The optional maximum number of attempts to deliver each firing of the reminder.
+	// A firing that exhausts its attempts is recorded in the reminder dead-letter collection.
+	// One-shot reminders are then cancelled; periodic and cron reminders move on to their next firing.
+	// Defaults to 0 (unlimited attempts).
+	// Example: 5
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// The optional delay before the first retry of a failed delivery, specified as a GoLang Duration.
+	// The delay doubles after every failed attempt. Defaults to the reminder processing interval.
+	// Example: 1s
+	RetryBackoff string `json:"retryBackoff,omitempty"`
+	// The optional upper bound on the delay between attempts, specified as a GoLang Duration.
+	// Defaults to 1m.
+	// Example: 30s
+	MaxRetryBackoff string `json:"maxRetryBackoff,omitempty"`
 	// An optional parameter containing an arbitrary JSON value that will be provided as the
 	// payload when the `path` is invoked on the actor instance.
 	// Example: { msg: "Hello Friend!" }
@@ -93,15 +209,142 @@ func persistReminder(r Reminder) map[string]string {
 	if r.Period > 0 {
 		rMap["period"] = r.Period.String()
 	}
+	if r.Cron != "" {
+		rMap["cron"] = r.Cron
+		rMap["timeZone"] = r.TimeZone
+	}
+	if r.MisfirePolicy != "" {
+		rMap["misfirePolicy"] = r.MisfirePolicy
+	}
+	if r.MaxAttempts > 0 {
+		rMap["maxAttempts"] = strconv.Itoa(r.MaxAttempts)
+	}
+	if r.RetryBackoff > 0 {
+		rMap["retryBackoff"] = r.RetryBackoff.String()
+	}
+	if r.MaxRetryBackoff > 0 {
+		rMap["maxRetryBackoff"] = r.MaxRetryBackoff.String()
+	}
+	if r.Attempts > 0 {
+		rMap["attempts"] = strconv.Itoa(r.Attempts)
+	}
+	if !r.scheduledTime.IsZero() {
+		st, _ := r.scheduledTime.MarshalText()
+		rMap["scheduledTime"] = string(st)
+	}
 	if r.EncodedData != "" {
 		rMap["encodedData"] = r.EncodedData
 	}
+	if r.TraceParent != "" {
+		rMap["traceparent"] = r.TraceParent
+		rMap["tracestate"] = r.TraceState
+	}
 	return rMap
 }
 
-func persistTargetTime(ctx context.Context, key string, targetTime time.Time) {
-	ts, _ := targetTime.MarshalText()
-	store.HSet(ctx, key, "targetTime", string(ts))
+func persistTargetTime(ctx context.Context, r Reminder) {
+	ts, _ := r.TargetTime.MarshalText()
+	st := []byte{}
+	if !r.scheduledTime.IsZero() {
+		st, _ = r.scheduledTime.MarshalText()
+	}
+	store.HSet3(ctx, r.key, "targetTime", string(ts), "attempts", strconv.Itoa(r.Attempts), "scheduledTime", string(st))
+}
+
+// the maximum number of firings retained in the dead-letter collection of reminders
+const deadLetterRemindersLimit = 1000
+
+// redis key for the dead-letter collection of reminders
+func deadLetterRemindersKey() string {
+	return "deadletter" + config.Separator + "reminders"
+}
+
+// failure time in nanoseconds encoded in a field of the dead-letter collection
+func deadLetterFailureTime(field string) int64 {
+	n, _ := strconv.ParseInt(field[strings.LastIndex(field, config.Separator)+1:], 10, 64)
+	return n
+}
+
+// record a reminder firing that exhausted its delivery attempts
+func persistDeadLetterReminder(ctx context.Context, r Reminder, failureTime time.Time, err error) {
+	buf, _ := json.Marshal(deadLetterReminder{Reminder: r, FailureTime: failureTime, Error: err.Error()})
+	field := r.key + config.Separator + strconv.FormatInt(failureTime.UnixNano(), 10)
+	if _, err := store.HSet(ctx, deadLetterRemindersKey(), field, string(buf)); err != nil {
+		remindersLog.Error("failed to record dead-letter reminder %v: %v", r.ID, err)
+	}
+	deadLetterRemindersCounter.Inc()
+	trimDeadLetterReminders(ctx)
+}
+
+// trimDeadLetterReminders removes the oldest firings in excess of deadLetterRemindersLimit
+func trimDeadLetterReminders(ctx context.Context) {
+	fields, err := store.HKeys(ctx, deadLetterRemindersKey())
+	if err != nil {
+		remindersLog.Error("failed to trim dead-letter reminders: %v", err)
+		return
+	}
+	if len(fields) <= deadLetterRemindersLimit {
+		return
+	}
+	sort.Slice(fields, func(i, j int) bool { return deadLetterFailureTime(fields[i]) < deadLetterFailureTime(fields[j]) })
+	if _, err := store.HDelMultiple(ctx, deadLetterRemindersKey(), fields[:len(fields)-deadLetterRemindersLimit]); err != nil {
+		remindersLog.Error("failed to trim dead-letter reminders: %v", err)
+	}
+}
+
+// deleteDeadLetterReminders removes the firings that failed before the given time
+// or all the firings if the time is zero and returns the number of removed firings
+func deleteDeadLetterReminders(ctx context.Context, before time.Time) (int, error) {
+	fields, err := store.HKeys(ctx, deadLetterRemindersKey())
+	if err != nil {
+		return 0, err
+	}
+	if !before.IsZero() {
+		selected := []string{}
+		for _, field := range fields {
+			if deadLetterFailureTime(field) < before.UnixNano() {
+				selected = append(selected, field)
+			}
+		}
+		fields = selected
+	}
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	return store.HDelMultiple(ctx, deadLetterRemindersKey(), fields)
+}
+
+// getDeadLetterReminders returns the dead-letter collection of reminders ordered by failure time
+func getDeadLetterReminders(ctx context.Context) ([]deadLetterReminder, error) {
+	entries, err := store.HGetAll(ctx, deadLetterRemindersKey())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]deadLetterReminder, 0, len(entries))
+	for _, entry := range entries {
+		var d deadLetterReminder
+		if err := json.Unmarshal([]byte(entry), &d); err != nil {
+			remindersLog.Error("ignoring malformed dead-letter reminder: %v", err)
+			continue
+		}
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].FailureTime.Before(result[j].FailureTime) })
+	return result, nil
+}
+
+// getAllReminders returns the reminders matching filter for all sidecars in the app ordered by next fire time
+func getAllReminders(ctx context.Context, f bindingFilter) ([]Reminder, error) {
+	found, err := getAllBindings(ctx, "reminders", f)
+	if err != nil {
+		return nil, err
+	}
+	reminders := make([]Reminder, len(found))
+	for i, b := range found {
+		reminders[i] = b.(Reminder)
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].TargetTime.Before(reminders[j].TargetTime) })
+	return reminders, nil
 }
 
 func (rq *reminderQueue) load(actor Actor, id, key string, rMap map[string]string) (binding, error) {
@@ -123,12 +366,50 @@ func (rq *reminderQueue) load(actor Actor, id, key string, rMap map[string]strin
 		Path:        rMap["path"],
 		TargetTime:  targetTime,
 		Period:      period,
+		Cron:        rMap["cron"],
+		TimeZone:    rMap["timeZone"],
 		EncodedData: rMap["encodedData"],
+
+		MisfirePolicy: rMap["misfirePolicy"],
+
+		TraceParent: rMap["traceparent"],
+		TraceState:  rMap["tracestate"],
+	}
+	if s := rMap["scheduledTime"]; s != "" {
+		if err = r.scheduledTime.UnmarshalText([]byte(s)); err != nil {
+			return nil, err
+		}
+	}
+	if s, present := rMap["maxAttempts"]; present {
+		if r.MaxAttempts, err = strconv.Atoi(s); err != nil {
+			return nil, err
+		}
+	}
+	if s, present := rMap["attempts"]; present {
+		if r.Attempts, err = strconv.Atoi(s); err != nil {
+			return nil, err
+		}
+	}
+	if s, present := rMap["retryBackoff"]; present {
+		if r.RetryBackoff, err = time.ParseDuration(s); err != nil {
+			return nil, err
+		}
+	}
+	if s, present := rMap["maxRetryBackoff"]; present {
+		if r.MaxRetryBackoff, err = time.ParseDuration(s); err != nil {
+			return nil, err
+		}
+	}
+	if r.Cron != "" {
+		r.schedule, err = parseCron(r.Cron, r.TimeZone)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return r, nil
 }
 
-func (rq *reminderQueue) parse(actor Actor, id, key, payload string) (binding, map[string]string, error) {
+func (rq *reminderQueue) parse(ctx context.Context, actor Actor, id, key, payload string) (binding, map[string]string, error) {
 	var data scheduleReminderPayload
 	if err := json.Unmarshal([]byte(payload), &data); err != nil {
 		return nil, nil, err
@@ -141,6 +422,50 @@ func (rq *reminderQueue) parse(actor Actor, id, key, payload string) (binding, m
 		}
 		r.Period = period
 	}
+	switch data.MisfirePolicy {
+	case "", misfireFireOnce, misfireFireAllMissed, misfireSkip:
+		r.MisfirePolicy = data.MisfirePolicy
+	default:
+		return nil, nil, fmt.Errorf("invalid misfirePolicy %q", data.MisfirePolicy)
+	}
+	if data.MaxAttempts < 0 {
+		return nil, nil, errors.New("maxAttempts must not be negative")
+	}
+	r.MaxAttempts = data.MaxAttempts
+	if data.RetryBackoff != "" {
+		backoff, err := time.ParseDuration(data.RetryBackoff)
+		if err != nil {
+			return nil, nil, err
+		}
+		r.RetryBackoff = backoff
+	}
+	if data.MaxRetryBackoff != "" {
+		backoff, err := time.ParseDuration(data.MaxRetryBackoff)
+		if err != nil {
+			return nil, nil, err
+		}
+		r.MaxRetryBackoff = backoff
+	}
+	if data.Cron != "" {
+		if r.Period > 0 {
+			return nil, nil, errors.New("period and cron are exclusive")
+		}
+		schedule, err := parseCron(data.Cron, data.TimeZone)
+		if err != nil {
+			return nil, nil, err
+		}
+		r.Cron = data.Cron
+		r.TimeZone = data.TimeZone
+		r.schedule = schedule
+		start := r.TargetTime
+		if start.IsZero() {
+			start = time.Now()
+		}
+		r.TargetTime = schedule.next(start.Add(-time.Second)) // first matching time at or after start
+		if r.TargetTime.IsZero() {
+			return nil, nil, errors.New("cron expression never fires after targetTime")
+		}
+	}
 	if data.Data != nil {
 		buf, err := json.Marshal(data.Data)
 		if err != nil {
@@ -148,6 +473,7 @@ func (rq *reminderQueue) parse(actor Actor, id, key, payload string) (binding, m
 		}
 		r.EncodedData = string(buf)
 	}
+	r.TraceParent, r.TraceState = rpc.InjectTrace(ctx)
 	return r, persistReminder(r), nil
 }
 
@@ -160,7 +486,7 @@ func migrateReminders(ctx context.Context, actor Actor) {
 		err := tellReminder(ctx, r.Actor, r.key)
 		if err != nil {
 			if err != ctx.Err() {
-				logger.Error("tell reminder %s failed: %v", r.key, err)
+				remindersLog.Error("tell reminder %s failed: %v", r.key, err)
 			}
 			break
 		}
@@ -178,23 +504,57 @@ func processReminders(ctx context.Context, fireTime time.Time) {
 			break
 		}
 		if fireTime.After(r.TargetTime.Add(config.ActorReminderAcceptableDelay)) {
-			logger.Warning("ProcessReminders: LATE by %v in firing %v to %v[%v]%v", fireTime.Sub(r.TargetTime), r.ID, r.Actor.Type, r.Actor.ID, r.Path)
+			remindersLog.Warning("ProcessReminders: LATE by %v in firing %v to %v[%v]%v", fireTime.Sub(r.TargetTime), r.ID, r.Actor.Type, r.Actor.ID, r.Path)
 		}
 
-		logger.Debug("ProcessReminders: firing %v to %v[%v]%v (targetTime %v)", r.ID, r.Actor.Type, r.Actor.ID, r.Path, r.TargetTime)
-		if err := TellActor(ctx, r.Actor, r.Path, r.EncodedData, ""); err != nil {
-			logger.Debug("ProcessReminders: firing %v raised error %v", r, err)
-			logger.Debug("ProcessReminders: ending this round; putting reminder back in queue to retry in next round")
+		if r.MisfirePolicy == misfireSkip && r.Attempts == 0 && (r.Period > 0 || r.schedule != nil) &&
+			fireTime.After(r.TargetTime.Add(config.ActorReminderAcceptableDelay)) {
+			remindersLog.Info("ProcessReminders: skipping late firing %v to %v[%v]%v (targetTime %v)", r.ID, r.Actor.Type, r.Actor.ID, r.Path, r.TargetTime)
+			r.TargetTime = r.nextTargetTime(r.TargetTime, fireTime)
 			activeReminders.add(ctx, r)
-			break
+			persistTargetTime(ctx, r)
+			continue
 		}
 
-		if r.Period > 0 {
-			r.TargetTime = fireTime.Add(r.Period)
+		remindersLog.Debug("ProcessReminders: firing %v to %v[%v]%v (targetTime %v)", r.ID, r.Actor.Type, r.Actor.ID, r.Path, r.TargetTime)
+		rctx, span := startReminderSpan(ctx, r)
+		err := TellActor(rctx, r.Actor, r.Path, r.EncodedData, "")
+		span.End()
+		if err != nil {
+			remindersLog.Debug("ProcessReminders: firing %v raised error %v", r, err)
+			if ctx.Err() != nil {
+				remindersLog.Debug("ProcessReminders: ending this round; putting reminder back in queue")
+				activeReminders.add(ctx, r)
+				break
+			}
+			r.Attempts++
+			if r.MaxAttempts == 0 || r.Attempts < r.MaxAttempts {
+				// retry this reminder after a delay without blocking the reminders behind it
+				if r.scheduledTime.IsZero() {
+					r.scheduledTime = r.TargetTime
+				}
+				r.TargetTime = fireTime.Add(r.retryDelay())
+				remindersLog.Debug("ProcessReminders: attempt %v failed; retrying %v at %v", r.Attempts, r.ID, r.TargetTime)
+				activeReminders.add(ctx, r)
+				persistTargetTime(ctx, r)
+				continue
+			}
+			remindersLog.Warning("ProcessReminders: giving up on firing %v to %v[%v]%v after %v attempts: %v", r.ID, r.Actor.Type, r.Actor.ID, r.Path, r.Attempts, err)
+			persistDeadLetterReminder(ctx, r, fireTime, err)
+		}
+		scheduled := r.TargetTime
+		if !r.scheduledTime.IsZero() {
+			scheduled = r.scheduledTime
+		}
+		r.Attempts = 0
+		r.scheduledTime = time.Time{}
+
+		if next := r.nextTargetTime(scheduled, fireTime); !next.IsZero() {
+			r.TargetTime = next
 			activeReminders.add(ctx, r)
-			persistTargetTime(ctx, r.key, r.TargetTime)
+			persistTargetTime(ctx, r)
 		} else {
-			store.Del(ctx, r.key)
+			deleteBinding(ctx, r.key)
 		}
 	}
 
@@ -22,8 +22,9 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
-	//"time"
+	"time"
 
 	"github.com/IBM/kar/core/internal/config"
 	"github.com/IBM/kar/core/pkg/logger"
@@ -107,7 +108,70 @@ func invokeServiceEndpoint(ctx context.Context, args []string) (exitCode int) {
 	return
 }
 
+// logLevel gets or sets the log verbosity of the sidecars of the application
+func logLevel(ctx context.Context, args []string) (exitCode int) {
+	msg := map[string]string{"command": "logLevels"}
+	if len(args) > 0 {
+		levels := logger.Levels{Level: args[0]}
+		if config.LogLevelComponent != "" {
+			level := args[0]
+			if level == "default" {
+				level = ""
+			}
+			levels = logger.Levels{Components: map[string]string{config.LogLevelComponent: level}}
+		}
+		bytes, _ := json.Marshal(levels)
+		msg["levels"] = string(bytes)
+	}
+	bytes, _ := json.Marshal(msg)
 
+	sidecars := []string{config.LogLevelSidecar}
+	if config.LogLevelSidecar == "" {
+		sidecars, _ = rpc.GetNodeIDs()
+	}
+	result := map[string]logger.Levels{}
+	for _, sidecar := range sidecars {
+		if sidecar == rpc.GetNodeID() {
+			continue // skip this cli process
+		}
+		reply, err := rpc.Call(ctx, rpc.Destination{Target: rpc.Node{ID: sidecar}, Method: sidecarEndpoint}, time.Time{}, "", bytes)
+		var levelsReply Reply
+		if err == nil {
+			err = json.Unmarshal(reply, &levelsReply)
+		}
+		if err == nil && levelsReply.StatusCode != http.StatusOK {
+			err = fmt.Errorf("%v", levelsReply.Payload)
+		}
+		var levels logger.Levels
+		if err == nil {
+			err = json.Unmarshal([]byte(levelsReply.Payload), &levels)
+		}
+		if err != nil {
+			logger.Error("error in loglevel on sidecar %v: %v", sidecar, err)
+			exitCode = 1
+			continue
+		}
+		result[sidecar] = levels
+	}
+
+	if config.GetOutputStyle == "json" || config.GetOutputStyle == "application/json" {
+		m, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(m))
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprint(&sb, "Sidecar : level : component levels")
+	for sidecar, levels := range result {
+		components := []string{}
+		for component, level := range levels.Components {
+			components = append(components, component+"="+level)
+		}
+		sort.Strings(components)
+		fmt.Fprintf(&sb, "\n%v : %v : %v", sidecar, levels.Level, strings.Join(components, ","))
+	}
+	fmt.Println(sb.String())
+	return
+}
 
 type addrTuple_t struct {
 	Host string `json:"host"`
@@ -206,6 +270,24 @@ func getInformation(ctx context.Context, args []string) (exitCode int) {
 				str = prefix + str
 			}
 		}
+	case "reminder", "reminders":
+		f := bindingFilter{ActorType: config.GetActorType, Path: config.GetPath}
+		if f.Before, err = parseFireTime(config.GetBefore); err != nil {
+			break
+		}
+		if f.After, err = parseFireTime(config.GetAfter); err != nil {
+			break
+		}
+		var reminders []Reminder
+		if reminders, err = getAllReminders(ctx, f); err == nil {
+			str, err = formatReminders(reminders, config.GetOutputStyle)
+		}
+	case "subscription", "subscriptions":
+		f := bindingFilter{ActorType: config.GetActorType, Path: config.GetPath, Topic: config.GetTopic}
+		var subscriptions []source
+		if subscriptions, err = getAllSubscriptions(ctx, f); err == nil {
+			str, err = formatSubscriptions(subscriptions, config.GetOutputStyle)
+		}
 	default:
 		logger.Error("invalid argument <%v> to call Inform", option)
 		exitCode = 1
@@ -219,3 +301,34 @@ func getInformation(ctx context.Context, args []string) (exitCode int) {
 	fmt.Println(str)
 	return
 }
+
+func formatReminders(reminders []Reminder, format string) (string, error) {
+	if format == "json" || format == "application/json" {
+		m, err := json.MarshalIndent(reminders, "", "  ")
+		return string(m), err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Listing %v reminders by next fire time:", len(reminders))
+	for _, r := range reminders {
+		fmt.Fprintf(&sb, "\n%v : %v[%v] : %v : %v", r.TargetTime.Format(time.RFC3339), r.Actor.Type, r.Actor.ID, r.ID, r.Path)
+		if r.Period > 0 {
+			fmt.Fprintf(&sb, " : every %v", r.Period)
+		} else if r.Cron != "" {
+			fmt.Fprintf(&sb, " : cron %q", r.Cron)
+		}
+	}
+	return sb.String(), nil
+}
+
+func formatSubscriptions(subscriptions []source, format string) (string, error) {
+	if format == "json" || format == "application/json" {
+		m, err := json.MarshalIndent(subscriptions, "", "  ")
+		return string(m), err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Listing %v subscriptions:", len(subscriptions))
+	for _, s := range subscriptions {
+		fmt.Fprintf(&sb, "\n%v[%v] : %v : %v -> %v", s.Actor.Type, s.Actor.ID, s.ID, s.Topic, s.Path)
+	}
+	return sb.String(), nil
+}
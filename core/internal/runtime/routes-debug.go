@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/IBM/kar/core/pkg/rpc"
+	"github.com/IBM/kar/core/pkg/logger"
 	"github.com/IBM/kar/core/internal/config"
 
 	"github.com/google/uuid"
@@ -27,6 +28,9 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+// the logger of the actor debugger
+var debuggerLog = logger.New("debug")
+
 func sendAll(bytes []byte, curConnId string) error {
 	debugConnsLock.Lock()
 	defer debugConnsLock.Unlock()
@@ -456,7 +460,7 @@ func debugServe(debugConn *websocket.Conn, debuggerId string){
 					if err == nil {
 						//successful = true 
 					} else {
-						fmt.Printf("edit response error: %v\n", err)
+						debuggerLog.Error("edit response error: %v", err)
 					}
 				}
 			}
@@ -620,7 +624,7 @@ func debugServe(debugConn *websocket.Conn, debuggerId string){
 				retBytes, err := json.Marshal(retMsg)
 				if err != nil {
 					err = sendErrorBytes(err, cmdId)
-					fmt.Printf("error: %v\n", err)
+					debuggerLog.Error("error: %v", err)
 					if err != nil { return }
 					continue
 				}
@@ -171,6 +171,10 @@ func dummy3() {}
 // swagger:parameters idActorSubscriptionSchedule
 // swagger:parameters idActorSubscriptionCancel
 // swagger:parameters idActorSubscriptionCancelAll
+// swagger:parameters idActorSubscriptionPause
+// swagger:parameters idActorSubscriptionResume
+// swagger:parameters idActorSubscriptionSeek
+// swagger:parameters idActorSubscriptionLag
 // swagger:parameters idActorStateDelete
 // swagger:parameters idActorStateExists
 // swagger:parameters idActorStateGet
@@ -227,6 +231,21 @@ type subkeyParam struct {
 	Subkey string `json:"subkey"`
 }
 
+// swagger:parameters idActorStateDelete
+// swagger:parameters idActorStateDeleteAll
+// swagger:parameters idActorStateSet
+// swagger:parameters idActorStateUpdate
+// swagger:parameters idActorStateSubmapOps
+// swagger:parameters idActorStateSubkeyDelete
+// swagger:parameters idActorStateSubkeySet
+type ifMatchParam struct {
+	// The expected version of the actor's state as returned in the ETag header of a previous response,
+	// or * to require the actor's state to exist
+	// in:header
+	// Example: "3"
+	IfMatch string `json:"If-Match"`
+}
+
 // swagger:parameters idServiceDelete
 // swagger:parameters idServiceGet
 // swagger:parameters idServiceHead
@@ -258,6 +277,7 @@ type asyncParam struct {
 }
 
 // swagger:parameters idEventPublish
+// swagger:parameters idEventPublishBatch
 type topicParam struct {
 	// The topic name
 	// in:path
@@ -331,6 +351,10 @@ type reminderScheduleParamWrapper struct {
 // swagger:parameters idActorSubscribe
 // swagger:parameters idActorSubscriptionGet
 // swagger:parameters idActorSubscriptionCancel
+// swagger:parameters idActorSubscriptionPause
+// swagger:parameters idActorSubscriptionResume
+// swagger:parameters idActorSubscriptionSeek
+// swagger:parameters idActorSubscriptionLag
 type subscriptionIDParam struct {
 	// The id of the specific subscription being targeted
 	// in:path
@@ -344,6 +368,21 @@ type subscriptionParamWrapper struct {
 	Body EventSubscribeOptions
 }
 
+// swagger:parameters idActorSubscriptionSeek
+type subscriptionSeekParamWrapper struct {
+	// The request body describes the position to seek to
+	// in:body
+	// Example: { "time": "6h" }
+	Body struct {
+		// An offset, oldest, or newest
+		Offset interface{} `json:"offset,omitempty"`
+		// An RFC3339 time or a duration before the current time
+		Time string `json:"time,omitempty"`
+		// The partition to seek, all partitions if omitted
+		Partition int32 `json:"partition,omitempty"`
+	}
+}
+
 // swagger:parameters idTopicCreate
 type topicCreateParamWrapper struct {
 	// The request body describes the topic to be created
@@ -389,6 +428,50 @@ type actorStateGetParamWrapper struct {
 	ErrorOnAbsent bool `json:"nilOnAbsent"`
 }
 
+// swagger:parameters idReminderList
+// swagger:parameters idSubscriptionList
+type bindingFilterParam struct {
+	// Only list the bindings of actors of this type
+	// in:query
+	// required: false
+	ActorType string `json:"actorType"`
+	// Only list the bindings invoking this actor method
+	// in:query
+	// required: false
+	Path string `json:"path"`
+}
+
+// swagger:parameters idReminderList
+type reminderFilterParam struct {
+	// Only list the reminders whose next fire time is before this time or duration from now
+	// in:query
+	// required: false
+	// Example: 1h
+	Before string `json:"before"`
+	// Only list the reminders whose next fire time is after this time or duration from now
+	// in:query
+	// required: false
+	// Example: 2020-04-14T14:20:00Z
+	After string `json:"after"`
+}
+
+// swagger:parameters idReminderDeadLetterDelete
+type reminderDeadLetterDeleteParam struct {
+	// Only remove the firings that failed before this time or duration from now
+	// in:query
+	// required: false
+	// Example: -24h
+	Before string `json:"before"`
+}
+
+// swagger:parameters idSubscriptionList
+type subscriptionFilterParam struct {
+	// Only list the subscriptions to this topic
+	// in:query
+	// required: false
+	Topic string `json:"topic"`
+}
+
 // swagger:parameters idEventPublish
 type eventPublishRequestBody struct {
 	// An arbitrary request body to publish unchanged to the topic
@@ -396,6 +479,52 @@ type eventPublishRequestBody struct {
 	Event interface{}
 }
 
+// swagger:parameters idEventPublish
+type eventPublishParams struct {
+	// The key of the event; events with the same key are published to the same partition
+	// in:query
+	// required: false
+	// Example: customer-42
+	Key string `json:"key"`
+	// The partition to publish the event to, overriding the key
+	// in:query
+	// required: false
+	Partition int32 `json:"partition"`
+	// A header of the event specified as name:value; may be repeated
+	// in:query
+	// required: false
+	// Example: region:eu
+	Header []string `json:"header"`
+	// The CloudEvents mode (binary or structured) to publish a CloudEvent in, defaults to the mode of the request
+	// in:query
+	// required: false
+	// Example: binary
+	Mode string `json:"mode"`
+}
+
+// swagger:parameters idEventPublishBatch
+type eventPublishBatchParams struct {
+	// Publish the events atomically in a Kafka transaction
+	// in:query
+	// required: false
+	Transactional bool `json:"transactional"`
+	// The CloudEvents mode (binary or structured) to publish CloudEvents in, defaults to structured
+	// in:query
+	// required: false
+	// Example: binary
+	Mode string `json:"mode"`
+	// An array of events to publish with their optional key, headers, partition, and content type
+	// in:body
+	// Example: [{ "event": { "id": 1 }, "key": "customer-42", "headers": { "region": "eu" } }, { "event": { "id": 2 }, "partition": 0 }]
+	Body []struct {
+		Event       interface{}       `json:"event"`
+		Key         *string           `json:"key,omitempty"`
+		Headers     map[string]string `json:"headers,omitempty"`
+		Partition   *int32            `json:"partition,omitempty"`
+		ContentType string            `json:"contentType,omitempty"`
+	}
+}
+
 // swagger:parameters idActorStateSetMultiple
 type actorStateSetMultipleWrapper struct {
 	// A map containing the state updates to perform
@@ -403,6 +532,19 @@ type actorStateSetMultipleWrapper struct {
 	Body map[string]interface{}
 }
 
+// swagger:parameters idSystemSetLogLevel
+type logLevelParamWrapper struct {
+	// The verbosity of the log and of the components to update
+	// in:body
+	// Example: { "components": { "rpc": "debug", "store": "" } }
+	Body struct {
+		// The verbosity of the log (fatal, error, warning, info, or debug), unchanged if omitted
+		Level string `json:"level,omitempty"`
+		// The verbosity of the components (rpc, store, reminders, events, or debug); an empty level restores the verbosity of the log
+		Components map[string]string `json:"components,omitempty"`
+	}
+}
+
 /*******************************************************************
  * Response documentation
  *******************************************************************/
@@ -468,10 +610,46 @@ type response200ReminderGetResult struct {
 // swagger:response response200ReminderGetAllResult
 type response200ReminderGetAllResult struct {
 	// An array containing all matching reminders
-	// Example: [{ Actor: { Type: 'Foo', ID: '22' }, id: 'ticker', path: '/echo', targetTime: '2020-04-14T14:17:51.073Z', period: 5000000000, encodedData: '{"msg":"hello"}' }, { Actor: { Type: 'Foo', ID: '22' }, id: 'once', path: '/echo', targetTime: '2020-04-14T14:20:00Z', encodedData: '{"msg":"carpe diem"}' }]
+	// Example: [{ Actor: { Type: 'Foo', ID: '22' }, id: 'ticker', path: '/echo', targetTime: '2020-04-14T14:17:51.073Z', period: 5000000000, encodedData: '{"msg":"hello"}' }, { Actor: { Type: 'Foo', ID: '22' }, id: 'once', path: '/echo', targetTime: '2020-04-14T14:20:00Z', encodedData: '{"msg":"carpe diem"}' }, { Actor: { Type: 'Foo', ID: '22' }, id: 'billing', path: '/bill', targetTime: '2020-05-01T00:00:00Z', cron: '0 2 1 * *', timeZone: 'Europe/Paris' }]
 	Body []Reminder
 }
 
+// swagger:response response200EventPublishResult
+type response200EventPublishResult struct {
+	// The location of the published event if the request accepts application/json, OK otherwise
+	// Example: { "topic": "orders", "partition": 2, "offset": 1234 }
+	Body struct {
+		Topic     string `json:"topic"`
+		Partition int32  `json:"partition"`
+		Offset    int64  `json:"offset"`
+	}
+}
+
+// swagger:response response200EventPublishBatchResult
+type response200EventPublishBatchResult struct {
+	// The locations of the published events in the order of the request
+	// Example: [{ "topic": "orders", "partition": 2, "offset": 1234 }, { "topic": "orders", "partition": 0, "offset": 567 }]
+	Body []struct {
+		Topic     string `json:"topic"`
+		Partition int32  `json:"partition"`
+		Offset    int64  `json:"offset"`
+	}
+}
+
+// swagger:response response200ReminderDeadLetterResult
+type response200ReminderDeadLetterResult struct {
+	// An array containing the reminder firings that exhausted their delivery attempts
+	// Example: [{ Actor: { Type: 'Foo', ID: '22' }, id: 'once', path: '/echo', targetTime: '2020-04-14T14:20:00Z', maxAttempts: 3, attempts: 3, failureTime: '2020-04-14T14:20:01Z', error: 'unavailable' }]
+	Body []deadLetterReminder
+}
+
+// swagger:response response200ReminderDeadLetterDeleteResult
+type response200ReminderDeadLetterDeleteResult struct {
+	// The number of firings removed from the dead-letter collection
+	// Example: 3
+	NumberRemoved int
+}
+
 // swagger:response response200SubscriptionCancelResult
 type response200SubscriptionCancelResult struct {
 	// Returns 1 if a subscription was cancelled, 0 if not found and `nilOnError` was true
@@ -491,6 +669,18 @@ type response200SubscriptionGetResult struct {
 	Body source
 }
 
+// swagger:response response200SubscriptionLagResult
+type response200SubscriptionLagResult struct {
+	// The committed offset, end offset, and lag of each partition
+	// Example: [{ "partition": 0, "offset": 1200, "end": 1234, "lag": 34 }]
+	Body []struct {
+		Partition int32 `json:"partition"`
+		Offset    int64 `json:"offset"`
+		End       int64 `json:"end"`
+		Lag       int64 `json:"lag"`
+	}
+}
+
 // swagger:response response200SubscriptionGetAllResult
 type response200SubscriptionGetAllResult struct {
 	// An array containing all matching subscriptions
@@ -509,6 +699,8 @@ type response200StateGetResult struct {
 
 // swagger:response response200StateGetAllResult
 type response200StateGetAllResult struct {
+	// The version of the actor's state
+	ETag string
 	// A map containing the requested state
 	Response map[string]interface{}
 }
@@ -539,6 +731,36 @@ type response200SystemInfoResult struct {
 	ComponentInfo interface{}
 }
 
+// swagger:response response200LogLevelResult
+type response200LogLevelResult struct {
+	// The verbosity of the log and of the components with a verbosity of their own
+	// Example: { "level": "error", "components": { "rpc": "debug" } }
+	Body struct {
+		Level      string            `json:"level"`
+		Components map[string]string `json:"components,omitempty"`
+	}
+}
+
+// swagger:response response200HealthResult
+type response200HealthResult struct {
+	// The outcome of the health checks
+	// Example: { "status": "ok", "checks": { "kafka": { "ok": true }, "redis": { "ok": true } } }
+	Body struct {
+		Status string                 `json:"status"`
+		Checks map[string]interface{} `json:"checks"`
+	}
+}
+
+// swagger:response response503HealthResult
+type response503HealthResult struct {
+	// The outcome of the health checks
+	// Example: { "status": "unavailable", "checks": { "kafka": { "ok": false, "detail": "rebalance or recovery in progress" }, "redis": { "ok": true } } }
+	Body struct {
+		Status string                 `json:"status"`
+		Checks map[string]interface{} `json:"checks"`
+	}
+}
+
 // swagger:response response201
 type success201 struct {
 }
@@ -572,6 +794,16 @@ type error404 struct {
 	Body string `json:"body"`
 }
 
+// Response indicating that the version of the actor's state does not match the If-Match header
+// swagger:response response412
+type error412 struct {
+	// The current version of the actor's state
+	ETag string
+	// A message describing the problem with the request
+	// Example: Precondition Failed
+	Body string `json:"body"`
+}
+
 // A message describing the error
 // swagger:response response500
 type error500 struct {
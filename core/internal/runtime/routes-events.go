@@ -22,9 +22,13 @@ package runtime
  */
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/IBM/kar/core/internal/config"
 	"github.com/IBM/kar/core/pkg/rpc"
@@ -166,6 +170,141 @@ func routeImplSubscription(w http.ResponseWriter, r *http.Request, ps httprouter
 	}
 }
 
+// swagger:route POST /v1/actor/{actorType}/{actorId}/events/{subscriptionId}/pause events idActorSubscriptionPause
+//
+// subscriptions/id/pause
+//
+// ### Pause a subscription
+//
+// This operation stops the delivery of events to the actor instance until the subscription is resumed.
+// Events published in the meantime are delivered once the subscription is resumed.
+// The paused state of the subscription is persisted.
+//
+//     Produces:
+//     - text/plain
+//     Schemes: http
+//     Responses:
+//       200: response200
+//       404: response404
+//       500: response500
+//       503: response503
+//
+
+// swagger:route POST /v1/actor/{actorType}/{actorId}/events/{subscriptionId}/resume events idActorSubscriptionResume
+//
+// subscriptions/id/resume
+//
+// ### Resume a subscription
+//
+// This operation resumes the delivery of events to the actor instance.
+//
+//     Produces:
+//     - text/plain
+//     Schemes: http
+//     Responses:
+//       200: response200
+//       404: response404
+//       500: response500
+//       503: response503
+//
+
+// swagger:route POST /v1/actor/{actorType}/{actorId}/events/{subscriptionId}/seek events idActorSubscriptionSeek
+//
+// subscriptions/id/seek
+//
+// ### Seek a subscription
+//
+// This operation moves the consumer group of the subscription to a new position in the topic.
+// The request body specifies either an `offset` (a number, `oldest`, or `newest`)
+// or a `time` (an RFC3339 time or a duration before the current time such as `6h`).
+// The subscription resumes from the offset of the first event published at or after this time.
+// The optional `partition` restricts the operation to one partition of the topic.
+// The consumer group must not be shared with active subscriptions.
+// For subscriptions with `exactlyOnce` deduplication, the record of the processed events is reset
+// so that the events are delivered again.
+//
+//     Consumes:
+//     - application/json
+//     Produces:
+//     - text/plain
+//     Schemes: http
+//     Responses:
+//       200: response200
+//       400: response400
+//       404: response404
+//       500: response500
+//       503: response503
+//
+
+// swagger:route GET /v1/actor/{actorType}/{actorId}/events/{subscriptionId}/lag events idActorSubscriptionLag
+//
+// subscriptions/id/lag
+//
+// ### Get the lag of a subscription
+//
+// This operation returns for each partition of the topic the offset committed by the
+// consumer group of the subscription (-1 if none), the offset of the next event to be
+// published, and the number of events not yet consumed.
+//
+//     Produces:
+//     - application/json
+//     Schemes: http
+//     Responses:
+//       200: response200SubscriptionLagResult
+//       404: response404
+//       500: response500
+//       503: response503
+//
+func routeImplSubscriptionControl(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	action := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	body := ""
+	if action == "seek" {
+		body = ReadAll(r)
+	}
+	reply, err := Bindings(ctx, "subscriptions", Actor{Type: ps.ByName("type"), ID: ps.ByName("id")}, ps.ByName("subscriptionId"), "false", action, body, r.Header.Get("Content-Type"), r.Header.Get("Accept"))
+	if err != nil {
+		if err == ctx.Err() {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		} else {
+			http.Error(w, fmt.Sprintf("failed to send message: %v", err), http.StatusInternalServerError)
+		}
+	} else {
+		w.Header().Add("Content-Type", reply.ContentType)
+		w.WriteHeader(reply.StatusCode)
+		fmt.Fprint(w, reply.Payload)
+	}
+}
+
+// swagger:route GET /v1/subscriptions events idSubscriptionList
+//
+// subscriptions
+//
+// ### List subscriptions
+//
+// This operation returns the subscriptions of all actor instances ordered by actor and subscription id.
+// The optional query parameters `actorType`, `path`, and `topic` restrict the result to the
+// subscriptions of actors of the given type, invoking the given actor method, and
+// consuming the given topic.
+//
+//     Produces:
+//     - application/json
+//     Schemes: http
+//     Responses:
+//       200: response200SubscriptionGetAllResult
+//       500: response500
+//
+func routeImplSubscriptionList(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	f := bindingFilter{ActorType: r.FormValue("actorType"), Path: r.FormValue("path"), Topic: r.FormValue("topic")}
+	subscriptions, err := getAllSubscriptions(ctx, f)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list subscriptions: %v", err), http.StatusInternalServerError)
+		return
+	}
+	buf, _ := json.Marshal(subscriptions)
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprint(w, string(buf))
+}
+
 // swagger:route POST /v1/event/{topic}/publish events idEventPublish
 //
 // publish
@@ -173,24 +312,219 @@ func routeImplSubscription(w http.ResponseWriter, r *http.Request, ps httprouter
 // ### Publish an event to a topic
 //
 // The event provided as the request body will be published on `topic`.
+// The optional query parameters `key`, `partition`, and `header` specify
+// the key of the event, the partition of the topic to publish to, and the
+// headers of the event. Events with the same key are published to the same partition.
+// Headers are specified as `name:value` and the `header` parameter may be repeated.
+// CloudEvents are published using the Kafka protocol binding of CloudEvents 1.0.
+// A CloudEvent in binary mode (`ce-` HTTP headers) is published with `ce_` Kafka headers
+// and a CloudEvent in structured mode (content type `application/cloudevents+json`)
+// is published as is. The optional query parameter `mode` (`binary` or `structured`)
+// converts the CloudEvent to the requested mode. The required attributes of CloudEvents
+// (`specversion`, `id`, `source`, `type`) are validated.
 // When the operation returns successfully, the event is guaranteed to
-// eventually be published to the targeted topic.
+// eventually be published to the targeted topic. The response body is `OK`
+// unless the `Accept` header of the request lists `application/json`, in which case
+// the response body contains the topic, partition, and offset of the published event.
 //
 //     Schemes: http
 //     Consumes:
 //     - application/*
+//     Produces:
+//     - text/plain
+//     - application/json
 //     Responses:
-//       200: response200
+//       200: response200EventPublishResult
 //       400: response400
+//       500: response500
 //
 func routeImplPublish(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	options, err := publishOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	buf, _ := ioutil.ReadAll(r.Body)
-	err := karPublisher.Publish(ps.ByName("topic"), buf)
+	buf, headers, err := encodeCloudEvent(r.Header, buf, r.FormValue("mode"))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("publish error: %v", err), http.StatusBadRequest)
-	} else {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for k, v := range headers {
+		if options.Headers == nil {
+			options.Headers = map[string]string{}
+		}
+		options.Headers[k] = v
+	}
+	options.Headers = eventTraceHeaders(r, options.Headers)
+	result, err := karPublisher.Publish(ps.ByName("topic"), buf, options)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if invalidPartition(err) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("publish error: %v", err), status)
+	} else if !acceptsJSON(r) {
 		fmt.Fprint(w, "OK")
+	} else {
+		reply, _ := json.Marshal(result)
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, string(reply))
+	}
+}
+
+// swagger:route POST /v1/event/{topic}/publishBatch events idEventPublishBatch
+//
+// publishBatch
+//
+// ### Publish a batch of events to a topic
+//
+// The request body is an array of events to publish on `topic` in one round trip.
+// Each element of the array specifies the `event` to publish and optionally
+// its `key`, `headers`, `partition`, and `contentType`.
+// An event with content type `application/cloudevents+json` is a structured
+// CloudEvent published in the CloudEvents mode specified by the query parameter
+// `mode` as for `publish`. Other events are published unchanged.
+// If the query parameter `transactional` is true, the events are published
+// in a Kafka transaction and either all or none of the events are published.
+// Otherwise, a failure may leave some of the events published.
+// The response body contains the topic, partition, and offset of each
+// published event in the order of the request.
+//
+//     Schemes: http
+//     Consumes:
+//     - application/json
+//     Produces:
+//     - application/json
+//     Responses:
+//       200: response200EventPublishBatchResult
+//       400: response400
+//       500: response500
+//
+func routeImplPublishBatch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var batch []struct {
+		Event       json.RawMessage   `json:"event"`
+		Key         *string           `json:"key,omitempty"`
+		Headers     map[string]string `json:"headers,omitempty"`
+		Partition   *int32            `json:"partition,omitempty"`
+		ContentType string            `json:"contentType,omitempty"`
+	}
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(buf, &batch); err != nil {
+		http.Error(w, fmt.Sprintf("failed to unmarshal events: %v", err), http.StatusBadRequest)
+		return
+	}
+	mode := r.FormValue("mode")
+	if mode != "" && mode != cloudEventsModeBinary && mode != cloudEventsModeStructured {
+		http.Error(w, fmt.Sprintf("invalid CloudEvents mode %q, expected %s or %s", mode, cloudEventsModeBinary, cloudEventsModeStructured), http.StatusBadRequest)
+		return
+	}
+	events := make([]rpc.PublishEvent, len(batch))
+	for i, e := range batch {
+		if len(e.Event) == 0 {
+			http.Error(w, fmt.Sprintf("missing event at index %v", i), http.StatusBadRequest)
+			return
+		}
+		header := http.Header{}
+		eventMode := "" // other events are published unchanged irrespective of the mode
+		if e.ContentType != "" {
+			header.Set("Content-Type", e.ContentType)
+			if isCloudEventsContentType(e.ContentType) {
+				eventMode = mode
+			}
+		}
+		value, ceHeaders, err := encodeCloudEvent(header, e.Event, eventMode)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid event at index %v: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		headers := e.Headers
+		for k, v := range ceHeaders {
+			if headers == nil {
+				headers = map[string]string{}
+			}
+			headers[k] = v
+		}
+		events[i] = rpc.PublishEvent{Value: value, PublishOptions: rpc.PublishOptions{Headers: eventTraceHeaders(r, headers), Partition: e.Partition}}
+		if e.Key != nil {
+			events[i].Key = []byte(*e.Key)
+		}
+	}
+	results, err := karPublisher.PublishBatch(ps.ByName("topic"), events, r.FormValue("transactional") == "true")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if invalidPartition(err) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("publish error: %v", err), status)
+	} else {
+		reply, _ := json.Marshal(results)
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, string(reply))
+	}
+}
+
+// invalidPartition returns true if publishing failed only because of invalid explicit partitions
+func invalidPartition(err error) bool {
+	if errs, ok := err.(sarama.ProducerErrors); ok {
+		for _, e := range errs {
+			if e.Err != sarama.ErrInvalidPartition {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+	return err == sarama.ErrInvalidPartition
+}
+
+// acceptsJSON returns true if the Accept header of the request lists application/json with a nonzero quality
+// wildcards do not match so that the response defaults to text/plain
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil || mediaType != "application/json" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// publishOptions decodes the key, partition, and headers of an event from the query parameters
+func publishOptions(r *http.Request) (rpc.PublishOptions, error) {
+	var options rpc.PublishOptions
+	query := r.URL.Query()
+	if _, ok := query["key"]; ok {
+		options.Key = []byte(query.Get("key"))
+	}
+	if p := query.Get("partition"); p != "" {
+		partition, err := strconv.ParseInt(p, 10, 32)
+		if err != nil || partition < 0 {
+			return options, fmt.Errorf("invalid partition %q", p)
+		}
+		options.Partition = new(int32)
+		*options.Partition = int32(partition)
+	}
+	for _, h := range query["header"] {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return options, fmt.Errorf("invalid header %q, expected name:value", h)
+		}
+		if options.Headers == nil {
+			options.Headers = map[string]string{}
+		}
+		options.Headers[kv[0]] = kv[1]
 	}
+	return options, nil
 }
 
 // swagger:route PUT /v1/event/{topic} events idTopicCreate
@@ -0,0 +1,50 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package runtime
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAcceptsJSON(t *testing.T) {
+	tests := []struct {
+		accept []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{"application/json"}, true},
+		{[]string{"application/json; charset=utf-8"}, true},
+		{[]string{"Application/JSON"}, true},
+		{[]string{"*/*, application/json"}, true},
+		{[]string{"text/plain", "application/json;q=0.5"}, true},
+		{[]string{"application/json;q=0"}, false},
+		{[]string{"*/*"}, false},
+		{[]string{"application/*"}, false},
+		{[]string{"text/plain"}, false},
+		{[]string{"application/jsonp"}, false},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", "/kar/v1/event/topic/publish", nil)
+		for _, accept := range test.accept {
+			r.Header.Add("Accept", accept)
+		}
+		if got := acceptsJSON(r); got != test.want {
+			t.Errorf("acceptsJSON(%q) = %v, want %v", test.accept, got, test.want)
+		}
+	}
+}
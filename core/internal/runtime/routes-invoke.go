@@ -41,7 +41,7 @@ func tellHelper(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if err != nil {
 			logger.Error("failed to marshal header: %v", err)
 		}
-		err = TellService(ctx, ps.ByName("service"), ps.ByName("path"), ReadAll(r), string(m), r.Method)
+		err = TellService(requestContext(r), ps.ByName("service"), ps.ByName("path"), ReadAll(r), string(m), r.Method)
 	} else {
 		s := r.FormValue("session")
 		parts := strings.Split(s, ":")
@@ -49,7 +49,7 @@ func tellHelper(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if len(parts) >= 2 {
 			parentID = parts[1]
 		}
-		err = TellActor(ctx, Actor{Type: ps.ByName("type"), ID: ps.ByName("id")}, ps.ByName("path"), ReadAll(r), parentID)
+		err = TellActor(requestContext(r), Actor{Type: ps.ByName("type"), ID: ps.ByName("id")}, ps.ByName("path"), ReadAll(r), parentID)
 	}
 	if err != nil {
 		if err == ctx.Err() {
@@ -72,9 +72,9 @@ func callPromise(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if err != nil {
 			logger.Error("failed to marshal header: %v", err)
 		}
-		request, err = CallPromiseService(ctx, ps.ByName("service"), ps.ByName("path"), ReadAll(r), string(m), r.Method)
+		request, err = CallPromiseService(requestContext(r), ps.ByName("service"), ps.ByName("path"), ReadAll(r), string(m), r.Method)
 	} else {
-		request, err = CallPromiseActor(ctx, Actor{Type: ps.ByName("type"), ID: ps.ByName("id")}, ps.ByName("path"), ReadAll(r))
+		request, err = CallPromiseActor(requestContext(r), Actor{Type: ps.ByName("type"), ID: ps.ByName("id")}, ps.ByName("path"), ReadAll(r))
 	}
 	if err != nil {
 		if err == ctx.Err() {
@@ -319,7 +319,7 @@ func routeImplCall(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		if err != nil {
 			logger.Error("failed to marshal header: %v", err)
 		}
-		reply, err = CallService(ctx, ps.ByName("service"), ps.ByName("path"), ReadAll(r), string(m), r.Method)
+		reply, err = CallService(requestContext(r), ps.ByName("service"), ps.ByName("path"), ReadAll(r), string(m), r.Method)
 	} else {
 		s := r.FormValue("session")
 		parts := strings.Split(s, ":")
@@ -328,7 +328,7 @@ func routeImplCall(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		if len(parts) >= 2 {
 			parentID = parts[1]
 		}
-		reply, err = CallActor(ctx, Actor{Type: ps.ByName("type"), ID: ps.ByName("id")}, ps.ByName("path"), ReadAll(r), flow, parentID)
+		reply, err = CallActor(requestContext(r), Actor{Type: ps.ByName("type"), ID: ps.ByName("id")}, ps.ByName("path"), ReadAll(r), flow, parentID)
 	}
 	if err != nil {
 		if err == context.DeadlineExceeded {
@@ -22,6 +22,7 @@ package runtime
  */
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -148,7 +149,7 @@ func routeImplReminder(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		http.Error(w, fmt.Sprintf("Unsupported method %v", r.Method), http.StatusMethodNotAllowed)
 		return
 	}
-	reply, err := Bindings(ctx, "reminders", Actor{Type: ps.ByName("type"), ID: ps.ByName("id")}, ps.ByName("reminderId"), noa, action, body, r.Header.Get("Content-Type"), r.Header.Get("Accept"))
+	reply, err := Bindings(requestContext(r), "reminders", Actor{Type: ps.ByName("type"), ID: ps.ByName("id")}, ps.ByName("reminderId"), noa, action, body, r.Header.Get("Content-Type"), r.Header.Get("Accept"))
 	if err != nil {
 		if err == ctx.Err() {
 			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
@@ -161,3 +162,112 @@ func routeImplReminder(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		fmt.Fprint(w, reply.Payload)
 	}
 }
+
+// swagger:route GET /v1/reminders reminders idReminderList
+//
+// reminders
+//
+// ### List reminders
+//
+// This operation returns the reminders of all actor instances ordered by next fire time.
+// The optional query parameters `actorType` and `path` restrict the result to the reminders
+// of actors of the given type and invoking the given actor method.
+// The optional query parameters `before` and `after` restrict the result to the reminders
+// whose next fire time is before or after the given time, specified either in an
+// ISO-8601 compliant format or as a GoLang Duration relative to the current time.
+// For instance, `before=1h` lists the reminders scheduled to fire in the next hour.
+//
+//     Produces:
+//     - application/json
+//     Schemes: http
+//     Responses:
+//       200: response200ReminderGetAllResult
+//       400: response400
+//       500: response500
+//
+func routeImplReminderList(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	f := bindingFilter{ActorType: r.FormValue("actorType"), Path: r.FormValue("path")}
+	var err error
+	if f.Before, err = parseFireTime(r.FormValue("before")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.After, err = parseFireTime(r.FormValue("after")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reminders, err := getAllReminders(ctx, f)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list reminders: %v", err), http.StatusInternalServerError)
+		return
+	}
+	buf, _ := json.Marshal(reminders)
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprint(w, string(buf))
+}
+
+// swagger:route GET /v1/reminders/deadletter reminders idReminderDeadLetterGet
+//
+// reminders/deadletter
+//
+// ### Get dead-letter reminders
+//
+// This operation returns the reminder firings of all actor instances that
+// exhausted their delivery attempts, ordered by failure time.
+// Each entry contains the reminder, the number of attempts,
+// the time of the last failure, and the last error.
+// Only the most recent 1000 firings are retained.
+//
+//     Produces:
+//     - application/json
+//     Schemes: http
+//     Responses:
+//       200: response200ReminderDeadLetterResult
+//       500: response500
+//
+func routeImplReminderDeadLetter(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	reminders, err := getDeadLetterReminders(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get dead-letter reminders: %v", err), http.StatusInternalServerError)
+		return
+	}
+	buf, _ := json.Marshal(reminders)
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprint(w, string(buf))
+}
+
+// swagger:route DELETE /v1/reminders/deadletter reminders idReminderDeadLetterDelete
+//
+// reminders/deadletter
+//
+// ### Remove dead-letter reminders
+//
+// This operation removes reminder firings from the dead-letter collection.
+// The optional query parameter `before` restricts the operation to the firings that
+// failed before the given time, specified either in an ISO-8601 compliant format or as
+// a GoLang Duration relative to the current time. For instance, `before=-24h` removes
+// the firings that failed more than a day ago. All the firings are removed otherwise.
+// The number of removed firings is returned.
+//
+//     Produces:
+//     - text/plain
+//     Schemes: http
+//     Responses:
+//       200: response200ReminderDeadLetterDeleteResult
+//       400: response400
+//       500: response500
+//
+func routeImplReminderDeadLetterDelete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	before, err := parseFireTime(r.FormValue("before"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n, err := deleteDeadLetterReminders(ctx, before)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to remove dead-letter reminders: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "text/plain")
+	fmt.Fprint(w, n)
+}
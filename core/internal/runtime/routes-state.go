@@ -25,6 +25,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/IBM/kar/core/internal/config"
@@ -33,7 +34,7 @@ import (
 )
 
 func stateKey(t, id string) string {
-	return "main" + config.Separator + "state" + config.Separator + t + config.Separator + id
+	return actorKey(t, id, "main"+config.Separator+"state"+config.Separator+t+config.Separator+id)
 }
 
 func flatEntryKey(key string) string {
@@ -48,6 +49,41 @@ func nestedEntryKeyPrefix(key string) string {
 	return key + config.Separator
 }
 
+// the version of an actor's state is stored in its state hash under a key
+// that cannot collide with flat or nested entry keys (they all contain a Separator)
+// the hash is removed together with its version when no other key is left
+const stateVersionKey = "version"
+
+// ifMatchVersion returns the state version expected by the If-Match header of the request, "" if none,
+// or * if the state must exist
+func ifMatchVersion(r *http.Request) string {
+	etag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if etag == "*" {
+		return etag
+	}
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), "\"")
+}
+
+// setVersionHeader returns the version of the actor's state as the ETag of the response
+func setVersionHeader(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", fmt.Sprintf("\"%v\"", version))
+}
+
+// updateState applies a versioned update to the state of an actor and reports version conflicts
+func updateState(w http.ResponseWriter, r *http.Request, stateKey string, removals []string, updates map[string]string) (int, int, bool) {
+	removed, added, version, err := store.HUpdateVersioned(ctx, stateKey, stateVersionKey, ifMatchVersion(r), removals, updates)
+	if err == store.ErrConflict {
+		setVersionHeader(w, version)
+		http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+		return 0, 0, false
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("state update failed: %v", err), http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	setVersionHeader(w, version)
+	return removed, added, true
+}
+
 // swagger:route HEAD /v1/actor/{actorType}/{actorId}/state/{key} state idActorStateExists
 //
 // state/key
@@ -111,6 +147,9 @@ func routeImplContainsKey(w http.ResponseWriter, r *http.Request, ps httprouter.
 // The state of the actor instance indicated by `actorType` and `actorId`
 // will be updated by setting `key` to contain the JSON request body.
 // The operation will not return until the state has been updated.
+// If the `If-Match` header is provided, the update is only performed if
+// the version of the actor's state matches, otherwise a `412` response is returned.
+// The version of the actor's state after the update is returned in the `ETag` header.
 //
 //     Consumes:
 //     - application/json
@@ -120,6 +159,7 @@ func routeImplContainsKey(w http.ResponseWriter, r *http.Request, ps httprouter.
 //     Responses:
 //       201: response201
 //       204: response204
+//       412: response412
 //       500: response500
 //
 
@@ -133,6 +173,9 @@ func routeImplContainsKey(w http.ResponseWriter, r *http.Request, ps httprouter.
 // will be updated by setting `key`/`subkey` to contain the JSON request body.
 // The operation will not return until the state has been updated.
 // The result of the operation is `1` if a new entry was created and `0` if an existing entry was updated.
+// If the `If-Match` header is provided, the update is only performed if
+// the version of the actor's state matches, otherwise a `412` response is returned.
+// The version of the actor's state after the update is returned in the `ETag` header.
 //
 //     Consumes:
 //     - application/json
@@ -142,6 +185,7 @@ func routeImplContainsKey(w http.ResponseWriter, r *http.Request, ps httprouter.
 //     Responses:
 //       201: response201
 //       204: response204
+//       412: response412
 //       500: response500
 //
 func routeImplSet(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -152,8 +196,8 @@ func routeImplSet(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		mangledEntryKey = flatEntryKey(ps.ByName("key"))
 	}
 
-	if reply, err := store.HSet(ctx, stateKey(ps.ByName("type"), ps.ByName("id")), mangledEntryKey, ReadAll(r)); err != nil {
-		http.Error(w, fmt.Sprintf("HSET failed: %v", err), http.StatusInternalServerError)
+	if _, reply, ok := updateState(w, r, stateKey(ps.ByName("type"), ps.ByName("id")), nil, map[string]string{mangledEntryKey: ReadAll(r)}); !ok {
+		return
 	} else if reply == 1 {
 		if subkey := ps.ByName("subkey"); subkey != "" {
 			w.Header().Set("Location", fmt.Sprintf("/kar/v1/actor/%v/%v/state/%v/%v", ps.ByName("type"), ps.ByName("id"), ps.ByName("key"), subkey))
@@ -241,6 +285,7 @@ func routeImplGet(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 // operation will be returned as the response body.
 // If there are no `key/subkey` entries in the actor instance, the operation
 // will be interpreted as being applied to an empty map.
+// The `clear` operation honors the `If-Match` header like other state updates.
 //
 // The valid values for `op` are:
 // <ul>
@@ -258,6 +303,7 @@ func routeImplGet(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 //     Responses:
 //       200: response200StateSubmapOps
 //       404: response404
+//       412: response412
 //       500: response500
 //
 func routeImplSubmapOps(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -282,9 +328,8 @@ func routeImplSubmapOps(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 			http.Error(w, fmt.Sprintf("submapOps:clear: subMapScan failed: %v", err), http.StatusInternalServerError)
 			return
 		}
-		numCleared, err := store.HDelMultiple(ctx, stateKey, mapKeys)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("submapOps: HDEL failed  %v", err), http.StatusInternalServerError)
+		numCleared, _, ok := updateState(w, r, stateKey, mapKeys, nil)
+		if !ok {
 			return
 		}
 		response = numCleared
@@ -382,12 +427,15 @@ func subMapScan(stateKey string, mapName string, op func(key string, value strin
 // The operation will not return until the state has been updated.
 // The result of the operation is `1` if an entry was actually removed and
 // `0` if there was no entry for `key`.
+// If the `If-Match` header is provided, the entry is only removed if
+// the version of the actor's state matches, otherwise a `412` response is returned.
 //
 //     Schemes: http
 //     Produces:
 //     - text/plain
 //     Responses:
 //       200: response200StateDeleteResult
+//       412: response412
 //       500: response500
 //
 
@@ -402,12 +450,15 @@ func subMapScan(stateKey string, mapName string, op func(key string, value strin
 // The operation will not return until the state has been updated.
 // The result of the operation is `1` if an entry was actually removed and
 // `0` if there was no entry for `key`.
+// If the `If-Match` header is provided, the entry is only removed if
+// the version of the actor's state matches, otherwise a `412` response is returned.
 //
 //     Schemes: http
 //     Produces:
 //     - text/plain
 //     Responses:
 //       200: response200StateDeleteResult
+//       412: response412
 //       500: response500
 //
 func routeImplDel(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -417,9 +468,7 @@ func routeImplDel(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 	} else {
 		mangledEntryKey = flatEntryKey(ps.ByName("key"))
 	}
-	if reply, err := store.HDel(ctx, stateKey(ps.ByName("type"), ps.ByName("id")), mangledEntryKey); err != nil {
-		http.Error(w, fmt.Sprintf("HDEL failed: %v", err), http.StatusInternalServerError)
-	} else {
+	if reply, _, ok := updateState(w, r, stateKey(ps.ByName("type"), ps.ByName("id")), []string{mangledEntryKey}, nil); ok {
 		fmt.Fprint(w, reply)
 	}
 }
@@ -432,6 +481,7 @@ func routeImplDel(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 //
 // The state of the actor instance indicated by `actorType` and `actorId`
 // will be returned as the response body.
+// The version of the actor's state is returned in the `ETag` header.
 //
 //     Produces:
 //     - application/json
@@ -441,25 +491,36 @@ func routeImplDel(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 //       500: response500
 //
 func routeImplGetAll(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	state, err := actorGetAllState(ps.ByName("type"), ps.ByName("id"))
+	state, version, err := actorGetAllStateVersioned(ps.ByName("type"), ps.ByName("id"))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("actorGetAllState failed: %v", err), http.StatusInternalServerError)
 	} else {
 		b, _ := json.Marshal(state)
+		setVersionHeader(w, version)
 		w.Header().Add("Content-Type", "application/json")
 		fmt.Fprint(w, string(b))
 	}
 }
 
 func actorGetAllState(actorType string, actorID string) (map[string]interface{}, error) {
+	m, _, err := actorGetAllStateVersioned(actorType, actorID)
+	return m, err
+}
+
+func actorGetAllStateVersioned(actorType string, actorID string) (map[string]interface{}, int, error) {
 	reply, err := store.HGetAll(ctx, stateKey(actorType, actorID))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	// reply has type map[string]string
 	// we unmarshal the values then marshal the map
 	m := map[string]interface{}{}
+	version := 0
 	for i, s := range reply {
+		if i == stateVersionKey {
+			version, _ = strconv.Atoi(s)
+			continue
+		}
 		var v interface{}
 		json.Unmarshal([]byte(s), &v)
 		splitKeys := strings.SplitN(i, config.Separator, 2)
@@ -474,7 +535,7 @@ func actorGetAllState(actorType string, actorID string) (map[string]interface{},
 			(m[key].(map[string]interface{}))[subkey] = v
 		}
 	}
-	return m, nil
+	return m, version, nil
 }
 
 // swagger:route POST /v1/actor/{actorType}/{actorId}/state state idActorStateUpdate
@@ -486,7 +547,11 @@ func actorGetAllState(actorType string, actorID string) (map[string]interface{},
 // The state updates contained in the request body will be performed on the
 // actor instance indicated by `actorType` and `actorId`.
 // All removal operations will be performed first, then all update
-// operations will be performed.
+// operations will be performed. The removals and updates are applied
+// atomically: either all of them are performed or none of them are.
+// If the `If-Match` header is provided, the operation is only performed if
+// the version of the actor's state matches, otherwise a `412` response is returned.
+// The version of the actor's state after the operation is returned in the `ETag` header.
 // The result of the operation will contain the number of state elements
 // removed and updated.
 //
@@ -498,6 +563,7 @@ func actorGetAllState(actorType string, actorID string) (map[string]interface{},
 //     Responses:
 //       200: response200StateUpdate
 //       404: response404
+//       412: response412
 //       500: response500
 //
 func routeImplStateUpdate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -543,22 +609,10 @@ func routeImplStateUpdate(w http.ResponseWriter, r *http.Request, ps httprouter.
 		}
 	}
 
-	// Third, apply the removals and then the updates.
-	numCleared := 0
-	numAdded := 0
-	if len(toClear) > 0 {
-		numCleared, err = store.HDelMultiple(ctx, stateKey, toClear)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("StateUpate: HDEL failed  %v", err), http.StatusInternalServerError)
-			return
-		}
-	}
-	if len(toUpdate) > 0 {
-		numAdded, err = store.HSetMultiple(ctx, stateKey, toUpdate)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("StateUpate: HSET failed  %v", err), http.StatusInternalServerError)
-			return
-		}
+	// Third, atomically apply the removals and then the updates.
+	numCleared, numAdded, ok := updateState(w, r, stateKey, toClear, toUpdate)
+	if !ok {
+		return
 	}
 
 	response = response200StateUpdateOp{Removed: numCleared, Added: numAdded}
@@ -579,20 +633,28 @@ func routeImplStateUpdate(w http.ResponseWriter, r *http.Request, ps httprouter.
 // ### Remove an actor's state
 //
 // The state of the actor instance indicated by `actorType` and `actorId`
-// will be deleted.
+// will be deleted. Deleting the state also resets its version to 0.
+// If the `If-Match` header is provided, the state is only deleted if
+// the version of the actor's state matches, otherwise a `412` response is returned.
 //
 //     Schemes: http
 //     Responses:
 //       200: response200StateDeleteResult
 //       404: response404
+//       412: response412
 //       500: response500
 //
 func routeImplDelAll(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	if reply, err := store.Del(ctx, stateKey(ps.ByName("type"), ps.ByName("id"))); err == store.ErrNil {
-		http.Error(w, "Not Found", http.StatusNotFound)
+	removed, version, err := store.HClearVersioned(ctx, stateKey(ps.ByName("type"), ps.ByName("id")), stateVersionKey, ifMatchVersion(r))
+	if err == store.ErrConflict {
+		setVersionHeader(w, version)
+		http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
 	} else if err != nil {
 		http.Error(w, fmt.Sprintf("DEL failed: %v", err), http.StatusInternalServerError)
+	} else if removed == 0 {
+		http.Error(w, "Not Found", http.StatusNotFound)
 	} else {
-		fmt.Fprint(w, reply)
+		setVersionHeader(w, version)
+		fmt.Fprint(w, 1)
 	}
 }
@@ -22,13 +22,16 @@ package runtime
  */
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/IBM/kar/core/pkg/logger"
 	"github.com/IBM/kar/core/pkg/rpc"
+	"github.com/IBM/kar/core/pkg/store"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -66,6 +69,189 @@ func routeImplHealth(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	fmt.Fprint(w, "OK")
 }
 
+// the outcome of a health check
+type healthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// the outcome of the health checks of the runtime process
+type healthReport struct {
+	Status string                 `json:"status"` // ok or unavailable
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// add a check to the report
+func (h *healthReport) add(name string, ok bool, detail string) {
+	h.Checks[name] = healthCheck{OK: ok, Detail: detail}
+	if !ok {
+		h.Status = "unavailable"
+	}
+}
+
+// write the report with a 200 status if all checks succeeded or a 503 status otherwise
+func (h *healthReport) write(w http.ResponseWriter) {
+	reply, _ := json.Marshal(h)
+	w.Header().Add("Content-Type", "application/json")
+	if h.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprint(w, string(reply))
+}
+
+// swagger:route GET /v1/system/readiness system idSystemReadiness
+//
+// readiness
+//
+// ### Readiness-check endpoint
+//
+// Returns a `200` response if the KAR runtime process is ready to accept requests:
+// the consumer group session is set up and no rebalance or recovery is in progress,
+// Redis is reachable, the application process answered for all its actor types,
+// and the last message sent to Kafka if any was sent successfully.
+// Returns a `503` response otherwise.
+// The body of the response details the outcome of each check.
+//
+//     Schemes: http
+//     Produces:
+//     - application/json
+//     Responses:
+//       200: response200HealthResult
+//       503: response503HealthResult
+//
+func routeImplReadiness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	report := healthReport{Status: "ok", Checks: map[string]healthCheck{}}
+	health := rpc.GetHealth()
+
+	if health.Closed {
+		report.add("kafka", false, "disconnected")
+	} else if !health.Processing {
+		report.add("kafka", false, "rebalance or recovery in progress")
+	} else {
+		report.add("kafka", true, "")
+	}
+
+	if health.ProducerError != nil {
+		report.add("producer", false, health.ProducerError.Error())
+	} else {
+		report.add("producer", true, "")
+	}
+
+	pingCtx, pingCancel := context.WithTimeout(r.Context(), time.Second)
+	err := store.Ping(pingCtx)
+	pingCancel()
+	if err != nil {
+		report.add("redis", false, err.Error())
+	} else {
+		report.add("redis", true, "")
+	}
+
+	appStatus.Lock()
+	if !appStatus.answered {
+		report.add("app", false, "waiting for the application process")
+	} else if len(appStatus.unrecognized) > 0 {
+		report.add("app", true, "actor types not recognized: "+strings.Join(appStatus.unrecognized, ", "))
+	} else {
+		report.add("app", true, "")
+	}
+	appStatus.Unlock()
+
+	report.write(w)
+}
+
+// swagger:route GET /v1/system/liveness system idSystemLiveness
+//
+// liveness
+//
+// ### Liveness-check endpoint
+//
+// Returns a `200` response if the KAR runtime process is alive.
+// Returns a `503` response if the process is shutting down
+// or if its connection to Kafka was closed and cannot recover without a restart.
+// Rebalances, recoveries, and transient failures of Redis or Kafka do not fail this check.
+//
+//     Schemes: http
+//     Produces:
+//     - application/json
+//     Responses:
+//       200: response200HealthResult
+//       503: response503HealthResult
+//
+func routeImplLiveness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	report := healthReport{Status: "ok", Checks: map[string]healthCheck{}}
+
+	if ctx.Err() != nil {
+		report.add("runtime", false, "shutting down")
+	} else {
+		report.add("runtime", true, "")
+	}
+
+	if rpc.GetHealth().Closed {
+		report.add("kafka", false, "disconnected")
+	} else {
+		report.add("kafka", true, "")
+	}
+
+	report.write(w)
+}
+
+// swagger:route GET /v1/system/loglevel system idSystemGetLogLevel
+//
+// loglevel
+//
+// ### Get the log verbosity
+//
+// Returns the verbosity of the log of the KAR runtime process
+// and of the components with a verbosity of their own.
+//
+//     Schemes: http
+//     Produces:
+//     - application/json
+//     Responses:
+//       200: response200LogLevelResult
+//
+func routeImplGetLogLevel(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	reply, _ := json.Marshal(logger.GetLevels())
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprint(w, string(reply))
+}
+
+// swagger:route PUT /v1/system/loglevel system idSystemSetLogLevel
+//
+// loglevel
+//
+// ### Set the log verbosity
+//
+// Sets the verbosity of the log of the KAR runtime process and of its components
+// (rpc, store, reminders, events, debug) without restarting the process.
+// The verbosity of the log is unchanged if `level` is omitted.
+// An empty component level restores the verbosity of the log for this component.
+//
+//     Schemes: http
+//     Consumes:
+//     - application/json
+//     Produces:
+//     - application/json
+//     Responses:
+//       200: response200LogLevelResult
+//       400: response400
+//
+func routeImplSetLogLevel(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var levels logger.Levels
+	if err := json.Unmarshal([]byte(ReadAll(r)), &levels); err != nil {
+		http.Error(w, fmt.Sprintf("invalid log levels: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := logger.SetLevels(levels); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reply, _ := json.Marshal(logger.GetLevels())
+	logger.Warning("log verbosity set to %s", reply)
+	w.Header().Add("Content-Type", "application/json")
+	fmt.Fprint(w, string(reply))
+}
+
 // swagger:route GET /v1/system/information/{component} system idSystemInfo
 //
 // information
@@ -81,12 +81,20 @@ func server(listener net.Listener) http.Server {
 	router.PUT(base+"/actor/:type/:id/reminders/:reminderId", routeImplReminder)
 	router.DELETE(base+"/actor/:type/:id/reminders/:reminderId", routeImplReminder)
 	router.DELETE(base+"/actor/:type/:id/reminders", routeImplReminder)
+	router.GET(base+"/reminders", routeImplReminderList)
+	router.GET(base+"/reminders/deadletter", routeImplReminderDeadLetter)
+	router.DELETE(base+"/reminders/deadletter", routeImplReminderDeadLetterDelete)
+	router.GET(base+"/subscriptions", routeImplSubscriptionList)
 
 	// events
 	router.GET(base+"/actor/:type/:id/events/:subscriptionId", routeImplSubscription)
 	router.GET(base+"/actor/:type/:id/events", routeImplSubscription)
 	router.PUT(base+"/actor/:type/:id/events/:subscriptionId", routeImplSubscription)
 	router.DELETE(base+"/actor/:type/:id/events/:subscriptionId", routeImplSubscription)
+	router.POST(base+"/actor/:type/:id/events/:subscriptionId/pause", routeImplSubscriptionControl)
+	router.POST(base+"/actor/:type/:id/events/:subscriptionId/resume", routeImplSubscriptionControl)
+	router.POST(base+"/actor/:type/:id/events/:subscriptionId/seek", routeImplSubscriptionControl)
+	router.GET(base+"/actor/:type/:id/events/:subscriptionId/lag", routeImplSubscriptionControl)
 	router.DELETE(base+"/actor/:type/:id/events", routeImplSubscription)
 
 	// actor state
@@ -106,11 +114,16 @@ func server(listener net.Listener) http.Server {
 
 	// kar system methods
 	router.GET(base+"/system/health", routeImplHealth)
+	router.GET(base+"/system/readiness", routeImplReadiness)
+	router.GET(base+"/system/liveness", routeImplLiveness)
 	router.POST(base+"/system/shutdown", routeImplShutdown)
 	router.GET(base+"/system/information/:component", routeImplGetInformation)
+	router.GET(base+"/system/loglevel", routeImplGetLogLevel)
+	router.PUT(base+"/system/loglevel", routeImplSetLogLevel)
 
 	// events
 	router.POST(base+"/event/:topic/publish", routeImplPublish)
+	router.POST(base+"/event/:topic/publishBatch", routeImplPublishBatch)
 	router.DELETE(base+"/event/:topic", routeImplDeleteTopic)
 	router.PUT(base+"/event/:topic", routeImplCreateTopic)
 
@@ -128,11 +141,23 @@ func handler2Handle(h http.Handler) httprouter.Handle {
 	}
 }
 
+// actorKey tags a redis key specific to an actor instance (actor state, bindings, and the offsets of deduplicated events)
+// with the type and id of the actor so these keys are stored in the same hash slot in Redis Cluster mode
+// the placement key of the actor instance in package rpc has the same tag
+func actorKey(actorType, actorID, key string) string {
+	return store.TaggedKey(actorType+config.Separator+actorID, key)
+}
+
 // Main is the main entrypoint for the KAR runtime
 func Main() {
+	logger.SetFields(logger.Fields{"app": config.AppName, "node": rpc.GetNodeID()})
 	logger.Warning("starting...")
-	logger.Info("redis: %v:%v", config.RedisConfig.Host, config.RedisConfig.Port)
-	logger.Info("kafka: %v", strings.Join(config.KafkaConfig.Brokers, ","))
+	if config.KafkaConfig.Local {
+		logger.Info("local mode: in-process transport and in-memory store")
+	} else {
+		logger.Info("redis: %v:%v", config.RedisConfig.Host, config.RedisConfig.Port)
+		logger.Info("kafka: %v", strings.Join(config.KafkaConfig.Brokers, ","))
+	}
 	exitCode := 0
 	defer func() { os.Exit(exitCode) }()
 
@@ -177,7 +202,7 @@ func Main() {
 	redisConfig.RequestRetryLimit = config.RequestRetryLimit
 
 	if err = store.Dial(ctx, &redisConfig); err != nil {
-		logger.Fatal("failed to connect to Redis: %v", err)
+		logger.Fatal("failed to connect to the store: %v", err)
 	}
 	defer store.Close()
 
@@ -198,6 +223,14 @@ func Main() {
 		return
 	}
 
+	if config.CmdName == config.RunCmd && config.TracingExporter != "" {
+		flush, err := startTracing()
+		if err != nil {
+			logger.Fatal("failed to start tracing: %v", err)
+		}
+		defer flush()
+	}
+
 	// Connect to Kafka
 	var closed <-chan struct{} = nil
 	if requiresPubSub {
@@ -224,6 +257,9 @@ func Main() {
 	} else if config.CmdName == config.GetCmd {
 		exitCode = getInformation(ctx9, args)
 		cancel()
+	} else if config.CmdName == config.LogLevelCmd {
+		exitCode = logLevel(ctx9, args)
+		cancel()
 	} else {
 		// start server and background tasks
 		srv := server(listener)
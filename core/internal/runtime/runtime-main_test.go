@@ -0,0 +1,49 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package runtime
+
+import (
+	"testing"
+
+	"github.com/IBM/kar/core/pkg/store"
+)
+
+// hashTag returns the hash tag of a key including its braces
+func hashTag(key string) string {
+	return key[:len(key)-len(store.UntaggedKey(key))]
+}
+
+func TestActorKeyHashTag(t *testing.T) {
+	actor := Actor{Type: "my_type", ID: "my_id"} // separators are valid in actor types and ids
+	keys := []string{
+		stateKey(actor.Type, actor.ID),
+		eventOffsetsKey(actor, "my_subscription"),
+		bindingKey("reminders", actor, "0", "my_reminder"),
+		bindingKey("subscriptions", actor, "3", "my_subscription"),
+	}
+	for _, key := range keys {
+		if tag := hashTag(key); tag != "{my_type_my_id}" {
+			t.Errorf("hash tag of %q is %q, want %q", key, tag, "{my_type_my_id}")
+		}
+	}
+	if key := store.UntaggedKey(keys[0]); key != "main_state_my_type_my_id" {
+		t.Errorf("untagged state key is %q, want %q", key, "main_state_my_type_my_id")
+	}
+	if hashTag(stateKey("my_type", "other_id")) == hashTag(keys[0]) {
+		t.Errorf("actors with different ids have the same hash tag")
+	}
+}
@@ -0,0 +1,151 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package runtime
+
+/*
+ * This file contains the configuration of OpenTelemetry tracing and
+ * the propagation of the W3C trace context to and from the application.
+ */
+
+import (
+	"context"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"time"
+
+	"github.com/IBM/kar/core/internal/config"
+	"github.com/IBM/kar/core/pkg/logger"
+	"github.com/IBM/kar/core/pkg/rpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer returns the tracer of the runtime from the global tracer provider
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/IBM/kar/core/internal/runtime")
+}
+
+// startTracing installs a tracer provider exporting spans with the configured exporter
+// and returns a function to flush the pending spans on exit
+func startTracing() (func(), error) {
+	var exporter sdktrace.SpanExporter
+	var f *os.File // the output file of the file exporter
+	var err error
+	switch config.TracingExporter {
+	case "otlp":
+		exporter, err = newOTLPExporter(config.TracingEndpoint)
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "file":
+		if f, err = os.OpenFile(config.TracingEndpoint, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err == nil {
+			if exporter, err = stdouttrace.New(stdouttrace.WithWriter(f)); err != nil {
+				f.Close()
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", config.AppName),
+		attribute.String("service.instance.id", rpc.GetNodeID()),
+		attribute.String("kar.service", config.ServiceName)))
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	logger.Info("exporting traces with the %s exporter", config.TracingExporter)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			logger.Error("failed to flush traces: %v", err)
+		}
+		if f != nil {
+			if err := f.Close(); err != nil {
+				logger.Error("failed to close trace file: %v", err)
+			}
+		}
+	}, nil
+}
+
+// newOTLPExporter returns an OTLP/HTTP exporter posting spans to the collector at the given URL
+func newOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := neturl.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host), otlptracehttp.WithURLPath(u.Path)}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), options...)
+}
+
+// requestContext returns the runtime context augmented with the trace context of an incoming request if any
+func requestContext(r *http.Request) context.Context {
+	return rpc.ExtractTrace(ctx, r.Header.Get("traceparent"), r.Header.Get("tracestate"))
+}
+
+// setTraceHeaders sets the trace context headers of an outgoing request
+func setTraceHeaders(ctx context.Context, header http.Header) {
+	traceParent, traceState := rpc.InjectTrace(ctx)
+	header.Del("traceparent")
+	header.Del("tracestate")
+	if traceParent != "" {
+		header.Set("traceparent", traceParent)
+		if traceState != "" {
+			header.Set("tracestate", traceState)
+		}
+	}
+}
+
+// startReminderSpan starts a span for the firing of a reminder continuing the trace of the request that scheduled it
+func startReminderSpan(ctx context.Context, r Reminder) (context.Context, trace.Span) {
+	return tracer().Start(rpc.ExtractTrace(ctx, r.TraceParent, r.TraceState), "kar.reminder "+r.ID, trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("kar.actor_type", r.Actor.Type), attribute.String("kar.actor_id", r.Actor.ID), attribute.String("kar.path", r.Path)))
+}
+
+// eventTraceHeaders adds the trace context of a publish request to the headers of the event
+// unless the event already carries a trace context
+func eventTraceHeaders(r *http.Request, headers map[string]string) map[string]string {
+	traceParent := r.Header.Get("traceparent")
+	if traceParent == "" || headers["traceparent"] != "" || headers["ce_traceparent"] != "" {
+		return headers
+	}
+	result := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		result[k] = v
+	}
+	result["traceparent"] = traceParent
+	if traceState := r.Header.Get("tracestate"); traceState != "" {
+		result["tracestate"] = traceState
+	}
+	return result
+}
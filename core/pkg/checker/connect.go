@@ -44,33 +44,40 @@ func (c *Connection) ConnectClient(appName string) {
 
 	c.ClientCtx, c.ClientCancel = context.WithCancel(context.Background())
 
-	redisPort, isPresent := os.LookupEnv("REDIS_PORT")
-	if !isPresent {
-		log.Print("REDIS_PORT var not set")
-	}
-
-	redisPortInteger, err := strconv.Atoi(redisPort)
-	if err != nil {
-		log.Printf("failed to convert Redis port to an integer value: %v", err)
-		os.Exit(1)
-	}
-
-	redisHost, isPresent := os.LookupEnv("REDIS_HOST")
-	if !isPresent {
-		log.Print("REDIS_HOST var not set")
-	}
-
 	sc := &store.StoreConfig{
+		Backend:           os.Getenv("KAR_STORE_BACKEND"),
 		MangleKey:         func(s string) string { return s },
 		UnmangleKey:       func(s string) string { return s },
 		RequestRetryLimit: -1 * time.Second,
 		LongOperation:     60 * time.Second,
-		Host:              redisHost,
-		Port:              redisPortInteger,
+	}
+
+	if sc.Backend == store.MemoryBackend {
+		// the memory store is private to this process, it is not shared with the server
+		log.Print("using the memory store, state is not shared with other processes")
+	} else {
+		redisPort, isPresent := os.LookupEnv("REDIS_PORT")
+		if !isPresent {
+			log.Print("REDIS_PORT var not set")
+		}
+
+		redisPortInteger, err := strconv.Atoi(redisPort)
+		if err != nil {
+			log.Printf("failed to convert Redis port to an integer value: %v", err)
+			os.Exit(1)
+		}
+
+		redisHost, isPresent := os.LookupEnv("REDIS_HOST")
+		if !isPresent {
+			log.Print("REDIS_HOST var not set")
+		}
+
+		sc.Host = redisHost
+		sc.Port = redisPortInteger
 	}
 
 	if err := store.Dial(c.ClientCtx, sc); err != nil {
-		log.Printf("failed to connect to Redis: %v", err)
+		log.Printf("failed to connect to the store: %v", err)
 		os.Exit(1)
 	}
 
@@ -0,0 +1,213 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// A Logger outputs the messages of a component.
+// The verbosity of a component defaults to the verbosity of the log.
+type Logger struct {
+	component string
+	verbosity int32 // accessed atomically, -1 if the component uses the verbosity of the log
+}
+
+// the loggers of the components
+var components = struct {
+	sync.Mutex
+	loggers map[string]*Logger
+}{loggers: map[string]*Logger{}}
+
+// New returns the logger of a component.
+func New(component string) *Logger {
+	components.Lock()
+	defer components.Unlock()
+	l := components.loggers[component]
+	if l == nil {
+		l = &Logger{component: component, verbosity: -1}
+		components.loggers[component] = l
+	}
+	return l
+}
+
+// Components returns the names of the components.
+func Components() []string {
+	components.Lock()
+	defer components.Unlock()
+	names := make([]string, 0, len(components.loggers))
+	for name := range components.loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Levels describes the verbosity of the log and of the components with a verbosity of their own.
+type Levels struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components,omitempty"`
+}
+
+// GetLevels returns the verbosity of the log and of the components with a verbosity of their own.
+func GetLevels() Levels {
+	levels := Levels{Level: levelName(atomic.LoadInt32(&verbosity)), Components: map[string]string{}}
+	components.Lock()
+	defer components.Unlock()
+	for name, l := range components.loggers {
+		if v := atomic.LoadInt32(&l.verbosity); v >= 0 {
+			levels.Components[name] = levelName(v)
+		}
+	}
+	return levels
+}
+
+// SetLevels sets the verbosity of the log if Level is not empty and the verbosity of the listed components.
+// An empty component level resets the component to the verbosity of the log.
+// Nothing is changed if a level or a component is invalid.
+func SetLevels(levels Levels) error {
+	var level int32
+	var err error
+	if levels.Level != "" {
+		if level, err = parseLevel(levels.Level); err != nil {
+			return fmt.Errorf("invalid log level %s", levels.Level)
+		}
+	}
+	components.Lock()
+	defer components.Unlock()
+	values := map[*Logger]int32{}
+	for name, s := range levels.Components {
+		l := components.loggers[name]
+		if l == nil {
+			return fmt.Errorf("unknown log component %s", name)
+		}
+		values[l] = -1
+		if s != "" {
+			if values[l], err = parseLevel(s); err != nil {
+				return fmt.Errorf("invalid log level %s for component %s", s, name)
+			}
+		}
+	}
+	if levels.Level != "" {
+		atomic.StoreInt32(&verbosity, level)
+	}
+	for l, v := range values {
+		atomic.StoreInt32(&l.verbosity, v)
+	}
+	return nil
+}
+
+// is the level enabled by the verbosity of the component?
+func (l *Logger) enabled(level int) bool {
+	v := atomic.LoadInt32(&l.verbosity)
+	if v < 0 {
+		v = atomic.LoadInt32(&verbosity)
+	}
+	return int(v) >= level
+}
+
+// Debug outputs a formatted log message.
+func (l *Logger) Debug(format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if l.enabled(debugLog) {
+		write(context.Background(), l.component, debugLog, format, args...)
+	}
+}
+
+// Info outputs a formatted log message.
+func (l *Logger) Info(format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if l.enabled(infoLog) {
+		write(context.Background(), l.component, infoLog, format, args...)
+	}
+}
+
+// Warning outputs a formatted warning message.
+func (l *Logger) Warning(format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if l.enabled(warningLog) {
+		write(context.Background(), l.component, warningLog, format, args...)
+	}
+}
+
+// Error outputs a formatted error message.
+func (l *Logger) Error(format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if l.enabled(errorLog) {
+		write(context.Background(), l.component, errorLog, format, args...)
+	}
+}
+
+// Fatal outputs a formatted error message and calls os.Exit(1).
+func (l *Logger) Fatal(format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	write(context.Background(), l.component, fatalLog, format, args...)
+}
+
+// DebugContext outputs a formatted log message with the fields of the context.
+func (l *Logger) DebugContext(ctx context.Context, format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if l.enabled(debugLog) {
+		write(ctx, l.component, debugLog, format, args...)
+	}
+}
+
+// InfoContext outputs a formatted log message with the fields of the context.
+func (l *Logger) InfoContext(ctx context.Context, format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if l.enabled(infoLog) {
+		write(ctx, l.component, infoLog, format, args...)
+	}
+}
+
+// WarningContext outputs a formatted warning message with the fields of the context.
+func (l *Logger) WarningContext(ctx context.Context, format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if l.enabled(warningLog) {
+		write(ctx, l.component, warningLog, format, args...)
+	}
+}
+
+// ErrorContext outputs a formatted error message with the fields of the context.
+func (l *Logger) ErrorContext(ctx context.Context, format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if l.enabled(errorLog) {
+		write(ctx, l.component, errorLog, format, args...)
+	}
+}
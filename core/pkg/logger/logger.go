@@ -16,18 +16,32 @@
 
 // Package logger supports leveled logging on top of the standard log package.
 //
+// Messages are written as text lines by default or as JSON objects
+// with contextual fields attached to the log or to a context.
+//
 // Example:
-//     logger.SetVerbosity("warning")
-//     logger.Error("invalid value: %v", value)
 //
+//	logger.SetVerbosity("warning")
+//	logger.Error("invalid value: %v", value)
+//
+//	ctx = logger.WithFields(ctx, logger.Fields{"request_id": id})
+//	logger.ErrorContext(ctx, "invalid value: %v", value)
 package logger
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -46,7 +60,19 @@ var severity = []string{
 	debugLog:   "DEBUG",
 }
 
-var verbosity = errorLog
+var verbosity int32 = errorLog // accessed atomically
+
+// Fields are named values attached to log messages in JSON format.
+type Fields map[string]string
+
+type fieldsKey struct{}
+
+var (
+	jsonFormat = false
+	fields     Fields     // fields attached to all messages
+	output     io.Writer  = os.Stderr
+	mu         sync.Mutex // serializes writes to output in JSON format
+)
 
 func init() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
@@ -54,33 +80,151 @@ func init() {
 
 // SetVerbosity sets the verbosity of the log.
 func SetVerbosity(s string) error {
+	i, err := parseLevel(s)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&verbosity, i)
+	return nil
+}
+
+// parse a level name or number
+func parseLevel(s string) (int32, error) {
 	s = strings.ToUpper(s)
 	for i, name := range severity {
 		if s == name {
-			verbosity = i
-			return nil
+			return int32(i), nil
 		}
 	}
 	i, err := strconv.Atoi(s)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	verbosity = i
-	return nil
+	return int32(i), nil
+}
+
+// the name of a level
+func levelName(i int32) string {
+	if i >= 0 && int(i) < len(severity) {
+		return strings.ToLower(severity[i])
+	}
+	return strconv.Itoa(int(i))
+}
+
+// is the level enabled by the verbosity of the log?
+func enabled(level int) bool {
+	return int(atomic.LoadInt32(&verbosity)) >= level
 }
 
 // SetOutput sets the output stream of the log.
 func SetOutput(w io.Writer) {
+	mu.Lock()
+	output = w
+	mu.Unlock()
 	log.SetOutput(w)
 }
 
+// SetFormat sets the format of the log: text or json.
+func SetFormat(s string) error {
+	switch strings.ToLower(s) {
+	case "", "text":
+		jsonFormat = false
+	case "json":
+		jsonFormat = true
+	default:
+		return fmt.Errorf("invalid log format %s", s)
+	}
+	return nil
+}
+
+// SetFields sets the fields attached to all messages in JSON format.
+func SetFields(f Fields) {
+	fields = f
+}
+
+// WithFields returns a copy of the context with additional fields for the messages logged with this context.
+func WithFields(ctx context.Context, f Fields) context.Context {
+	merged := Fields{}
+	for k, v := range contextFields(ctx) {
+		merged[k] = v
+	}
+	for k, v := range f {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+func contextFields(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+	f, _ := ctx.Value(fieldsKey{}).(Fields)
+	return f
+}
+
+// write a message to the log
+func write(ctx context.Context, component string, level int, format string, args ...interface{}) {
+	if !jsonFormat {
+		if level == fatalLog {
+			log.Fatalf("[FATAL] "+format, args...)
+		}
+		log.Printf("["+severity[level]+"] "+format, args...)
+		return
+	}
+	entry := map[string]string{}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	for k, v := range contextFields(ctx) {
+		entry[k] = v
+	}
+	if component != "" {
+		entry["component"] = component
+	}
+	keys := make([]string, 0, len(entry))
+	for k := range entry {
+		if k != "timestamp" && k != "level" && k != "msg" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	// fixed fields come first
+	var buf bytes.Buffer
+	buf.WriteString(`{"timestamp":`)
+	writeString(&buf, time.Now().Format("2006-01-02T15:04:05.000000Z07:00"))
+	buf.WriteString(`,"level":`)
+	writeString(&buf, severity[level])
+	buf.WriteString(`,"msg":`)
+	writeString(&buf, fmt.Sprintf(format, args...))
+	for _, k := range keys {
+		buf.WriteByte(',')
+		writeString(&buf, k)
+		buf.WriteByte(':')
+		writeString(&buf, entry[k])
+	}
+	buf.WriteString("}\n")
+
+	mu.Lock()
+	output.Write(buf.Bytes())
+	mu.Unlock()
+	if level == fatalLog {
+		os.Exit(1)
+	}
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
 // Debug outputs a formatted log message.
 func Debug(format string, args ...interface{}) {
 	if false {
 		_ = fmt.Sprintf(format, args...)
 	}
-	if verbosity >= debugLog {
-		log.Printf("[DEBUG] "+format, args...)
+	if enabled(debugLog) {
+		write(context.Background(), "", debugLog, format, args...)
 	}
 }
 
@@ -89,8 +233,8 @@ func Info(format string, args ...interface{}) {
 	if false {
 		_ = fmt.Sprintf(format, args...)
 	}
-	if verbosity >= infoLog {
-		log.Printf("[INFO] "+format, args...)
+	if enabled(infoLog) {
+		write(context.Background(), "", infoLog, format, args...)
 	}
 }
 
@@ -99,8 +243,8 @@ func Warning(format string, args ...interface{}) {
 	if false {
 		_ = fmt.Sprintf(format, args...)
 	}
-	if verbosity >= warningLog {
-		log.Printf("[WARNING] "+format, args...)
+	if enabled(warningLog) {
+		write(context.Background(), "", warningLog, format, args...)
 	}
 }
 
@@ -109,8 +253,8 @@ func Error(format string, args ...interface{}) {
 	if false {
 		_ = fmt.Sprintf(format, args...)
 	}
-	if verbosity >= errorLog {
-		log.Printf("[ERROR] "+format, args...)
+	if enabled(errorLog) {
+		write(context.Background(), "", errorLog, format, args...)
 	}
 }
 
@@ -119,5 +263,45 @@ func Fatal(format string, args ...interface{}) {
 	if false {
 		_ = fmt.Sprintf(format, args...)
 	}
-	log.Fatalf("[FATAL] "+format, args...)
+	write(context.Background(), "", fatalLog, format, args...)
+}
+
+// DebugContext outputs a formatted log message with the fields of the context.
+func DebugContext(ctx context.Context, format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if enabled(debugLog) {
+		write(ctx, "", debugLog, format, args...)
+	}
+}
+
+// InfoContext outputs a formatted log message with the fields of the context.
+func InfoContext(ctx context.Context, format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if enabled(infoLog) {
+		write(ctx, "", infoLog, format, args...)
+	}
+}
+
+// WarningContext outputs a formatted warning message with the fields of the context.
+func WarningContext(ctx context.Context, format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if enabled(warningLog) {
+		write(ctx, "", warningLog, format, args...)
+	}
+}
+
+// ErrorContext outputs a formatted error message with the fields of the context.
+func ErrorContext(ctx context.Context, format string, args ...interface{}) {
+	if false {
+		_ = fmt.Sprintf(format, args...)
+	}
+	if enabled(errorLog) {
+		write(ctx, "", errorLog, format, args...)
+	}
 }
@@ -73,6 +73,10 @@ var (
 	offset0  int64           // how far have we processed messages for unavailable services since the last node addition
 	max0     int64           // newest partition 0 offset
 
+	// loggers
+	rpcLog    = logger.New("rpc")
+	eventsLog = logger.New("events")
+
 	// errors
 	ErrUnavailable      = errors.New("unavailable")
 	errTooFewPartitions = errors.New("too few partitions")
@@ -85,7 +89,21 @@ func configureClient(config *Config) *sarama.Config {
 	conf := sarama.NewConfig()
 	conf.Version, _ = sarama.ParseKafkaVersion(config.Version)
 
-	if config.Password != "" {
+	switch {
+	case config.Mechanism == SASLOAuthBearer:
+		conf.Net.SASL.Enable = true
+		conf.Net.SASL.Handshake = true
+		conf.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+		conf.Net.SASL.TokenProvider = tokenProvider{provider: config.TokenProvider}
+	case config.Mechanism == SASLScramSHA256 || config.Mechanism == SASLScramSHA512:
+		// SASL is enabled even without a password so that sarama rejects the configuration
+		conf.Net.SASL.Enable = true
+		conf.Net.SASL.User = config.User
+		conf.Net.SASL.Password = config.Password
+		conf.Net.SASL.Handshake = true
+		conf.Net.SASL.Mechanism = sarama.SASLMechanism(config.Mechanism)
+		conf.Net.SASL.SCRAMClientGeneratorFunc = newSCRAMClient(config.Mechanism)
+	case config.Password != "":
 		conf.Net.SASL.Enable = true
 		conf.Net.SASL.User = config.User
 		conf.Net.SASL.Password = config.Password
@@ -94,11 +112,10 @@ func configureClient(config *Config) *sarama.Config {
 	}
 	if config.EnableTLS {
 		conf.Net.TLS.Enable = true
-		// TODO support custom CA certificate
-		if config.TLSSkipVerify {
-			conf.Net.TLS.Config = &tls.Config{
-				InsecureSkipVerify: true,
-			}
+		conf.Net.TLS.Config = &tls.Config{
+			RootCAs:            config.RootCAs,
+			Certificates:       config.Certificates,
+			InsecureSkipVerify: config.TLSSkipVerify,
 		}
 	}
 
@@ -141,6 +158,10 @@ func Dial(ctx context.Context, topic string, runtimePort int32, conf *Config, se
 	self.Port = runtimePort
 	processor = f
 
+	if conf.Local {
+		return dialLocal(ctx, services)
+	}
+
 	var err error
 
 	// initialize producer client
@@ -183,6 +204,7 @@ func Dial(ctx context.Context, topic string, runtimePort int32, conf *Config, se
 
 	// acquire W mutex
 	mu.Lock()
+	setRebalancing(true)
 
 	// initialize consumer group
 	cg, err := sarama.NewConsumerGroupFromClient(appTopic, consumerClient)
@@ -202,11 +224,11 @@ func Dial(ctx context.Context, topic string, runtimePort int32, conf *Config, se
 
 	go func() {
 		for {
-			logger.Info("before consume")
+			rpcLog.Info("before consume")
 			if err1 := cg.Consume(ctx, []string{appTopic}, new(handler)); err1 != nil && err1 != errTooFewPartitions {
-				logger.Fatal("Consumer error: %v", err1)
+				rpcLog.Fatal("Consumer error: %v", err1)
 			}
-			logger.Info("after consume")
+			rpcLog.Info("after consume")
 			if ctx.Err() != nil {
 				break
 			}
@@ -0,0 +1,70 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpc
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Health describes the state of the transport of this node
+type Health struct {
+	Processing    bool  // the consumer group session is set up and no rebalance or recovery is in progress
+	ProducerError error // the error returned by the last attempt to send a message if it failed
+	Closed        bool  // the transport is closed or the producer cannot be used anymore
+}
+
+var (
+	processing  int32 // accessed atomically, 1 if messages are being processed
+	producerErr struct {
+		sync.Mutex
+		err error
+	}
+)
+
+// record the start or end of a rebalance
+func setRebalancing(rebalancing bool) {
+	if rebalancing {
+		atomic.StoreInt32(&processing, 0)
+		rebalanceInProgressGauge.Set(1)
+	} else {
+		atomic.StoreInt32(&processing, 1)
+		rebalanceInProgressGauge.Set(0)
+	}
+}
+
+// record the outcome of the last attempt to send a message
+func setProducerError(err error) {
+	producerErr.Lock()
+	producerErr.err = err
+	producerErr.Unlock()
+}
+
+func getHealth() Health {
+	h := Health{Processing: atomic.LoadInt32(&processing) == 1}
+	producerErr.Lock()
+	h.ProducerError = producerErr.err
+	producerErr.Unlock()
+	select {
+	case <-closed:
+		h.Closed = true
+		h.Processing = false
+	default:
+		h.Closed = !local && producerClient != nil && producerClient.Closed()
+	}
+	return h
+}
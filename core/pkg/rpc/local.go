@@ -0,0 +1,360 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpc
+
+/*
+ * This file contains an in-process replacement for Kafka used in local mode.
+ * A single node owns partition 1 and provides all the services.
+ * Messages are delivered in order to the processor by a message loop.
+ * Events are retained in memory for the lifetime of the process.
+ */
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/cenkalti/backoff/v4"
+)
+
+var (
+	// are we running in local mode?
+	local = false
+
+	// the queue of messages to be processed by the message loop
+	localQueue = struct {
+		sync.Mutex
+		messages []Message
+		ready    chan struct{} // signaled when messages are added to the queue
+	}{ready: make(chan struct{}, 1)}
+
+	// the in-memory event topics and committed subscription offsets
+	localEvents = struct {
+		sync.Mutex
+		topics  map[string]*localTopic
+		offsets map[string]int // map group and topic to next offset
+	}{topics: map[string]*localTopic{}, offsets: map[string]int{}}
+)
+
+// An in-memory event topic with a single partition
+type localTopic struct {
+	events  []localEvent
+	changed chan struct{} // closed and replaced when the topic changes
+}
+
+// An event in an in-memory topic
+type localEvent struct {
+	key       []byte
+	value     []byte
+	headers   map[string]string
+	timestamp time.Time
+}
+
+// Start the in-process message loop and return a channel closed after shutting down
+func dialLocal(ctx context.Context, services []string) (<-chan struct{}, error) {
+	local = true
+
+	// this node provides all the services and owns the only partition
+	self.Partition = 1
+	service2nodes = map[string][]string{}
+	for _, service := range services {
+		service2nodes[service] = []string{self.Node}
+	}
+	node2partition[self.Node] = self.Partition
+	node2port[self.Node] = self.Port
+
+	rpcLog.Info("processing messages in local mode")
+	setRebalancing(false)
+
+	go func() {
+		for {
+			select {
+			case <-localQueue.ready:
+			case <-ctx.Done():
+				mu.Lock()
+				service2nodes = nil
+				node2partition = nil
+				node2port = nil
+				session2NodeCache = nil
+				close(closed)
+				mu.Unlock()
+				return
+			}
+			localQueue.Lock()
+			messages := localQueue.messages
+			localQueue.messages = nil
+			localQueue.Unlock()
+			for _, msg := range messages {
+				processor(msg)
+			}
+		}
+	}()
+
+	return closed, nil
+}
+
+// Enqueue message for the message loop
+func sendLocal(msg Message) error {
+	if m, ok := msg.(CallRequest); ok && m.Caller == "" {
+		m.Caller = self.Node
+		msg = m
+	}
+	localQueue.Lock()
+	localQueue.messages = append(localQueue.messages, msg)
+	localQueue.Unlock()
+	select {
+	case localQueue.ready <- struct{}{}:
+	default: // message loop already signaled
+	}
+	return nil
+}
+
+// Return the in-memory topic, creating it if necessary; assumes localEvents is locked
+func getLocalTopic(topic string) *localTopic {
+	t := localEvents.topics[topic]
+	if t == nil {
+		t = &localTopic{changed: make(chan struct{})}
+		localEvents.topics[topic] = t
+	}
+	return t
+}
+
+func createLocalTopic(topic string) error {
+	localEvents.Lock()
+	defer localEvents.Unlock()
+	if localEvents.topics[topic] != nil {
+		return &sarama.TopicError{Err: sarama.ErrTopicAlreadyExists}
+	}
+	getLocalTopic(topic)
+	return nil
+}
+
+func deleteLocalTopic(topic string) error {
+	localEvents.Lock()
+	defer localEvents.Unlock()
+	if t := localEvents.topics[topic]; t != nil {
+		delete(localEvents.topics, topic)
+		close(t.changed)
+	}
+	return nil
+}
+
+func seekLocal(topic, group string, position SeekPosition) error {
+	if position.Partition != nil && *position.Partition != 0 {
+		return sarama.ErrInvalidPartition
+	}
+	localEvents.Lock()
+	defer localEvents.Unlock()
+	events := getLocalTopic(topic).events
+	var offset int
+	switch {
+	case position.Offset == nil:
+		offset = sort.Search(len(events), func(i int) bool { return !events[i].timestamp.Before(position.Time) })
+	case *position.Offset == OffsetOldest:
+		offset = 0
+	case *position.Offset == OffsetNewest || *position.Offset > int64(len(events)):
+		offset = len(events)
+	default:
+		offset = int(*position.Offset)
+	}
+	localEvents.offsets[group+"/"+topic] = offset
+	return nil
+}
+
+func lagLocal(topic, group string, oldest bool) []PartitionLag {
+	localEvents.Lock()
+	defer localEvents.Unlock()
+	end := int64(len(getLocalTopic(topic).events))
+	if offset, ok := localEvents.offsets[group+"/"+topic]; ok {
+		return []PartitionLag{{Partition: 0, Offset: int64(offset), End: end, Lag: end - int64(offset)}}
+	}
+	if !oldest { // the consumer group starts from the newest offset
+		return []PartitionLag{{Partition: 0, Offset: -1, End: end, Lag: 0}}
+	}
+	return []PartitionLag{{Partition: 0, Offset: -1, End: end, Lag: end}}
+}
+
+type localPublisher struct{}
+
+func (localPublisher) Close() error {
+	return nil
+}
+
+func (p localPublisher) Publish(topic string, value []byte, options PublishOptions) (PublishResult, error) {
+	results, err := p.PublishBatch(topic, []PublishEvent{{Value: value, PublishOptions: options}}, false)
+	if err != nil {
+		return PublishResult{}, err
+	}
+	return results[0], nil
+}
+
+// PublishBatch is always atomic since the topic is locked while appending the events
+func (localPublisher) PublishBatch(topic string, events []PublishEvent, transactional bool) ([]PublishResult, error) {
+	for _, event := range events {
+		if event.Partition != nil && *event.Partition != 0 {
+			return nil, sarama.ErrInvalidPartition
+		}
+	}
+	localEvents.Lock()
+	defer localEvents.Unlock()
+	t := getLocalTopic(topic)
+	results := make([]PublishResult, len(events))
+	for i, event := range events {
+		t.events = append(t.events, localEvent{key: event.Key, value: event.Value, headers: event.Headers, timestamp: time.Now()})
+		results[i] = PublishResult{Topic: topic, Partition: 0, Offset: int64(len(t.events) - 1)}
+	}
+	close(t.changed)
+	t.changed = make(chan struct{})
+	return results, nil
+}
+
+func subscribeLocal(ctx context.Context, topic, group string, options SubscribeOptions, dest Destination, transform Transformer) (<-chan struct{}, error) {
+	key := group + "/" + topic
+
+	localEvents.Lock()
+	if _, ok := localEvents.offsets[key]; !ok && !options.OffsetOldest {
+		localEvents.offsets[key] = len(getLocalTopic(topic).events)
+	}
+	localEvents.Unlock()
+
+	closed := make(chan struct{})
+
+	go func() {
+		defer close(closed)
+		var lingerUntil time.Time // deadline for an incomplete batch to fill up
+		for {
+			localEvents.Lock()
+			t := getLocalTopic(topic)
+			offset := localEvents.offsets[key]
+			if offset > len(t.events) { // topic has been recreated
+				offset = len(t.events)
+			}
+			events := t.events[offset:]
+			changed := t.changed
+			localEvents.Unlock()
+
+			if len(events) > 0 && len(events) < options.BatchSize && options.BatchLinger > 0 {
+				if lingerUntil.IsZero() {
+					lingerUntil = time.Now().Add(options.BatchLinger)
+				}
+				if wait := time.Until(lingerUntil); wait > 0 {
+					select {
+					case <-changed:
+					case <-time.After(wait):
+					case <-ctx.Done():
+						return
+					}
+					continue
+				}
+			}
+			lingerUntil = time.Time{}
+
+			redeliver := false // consume again the events that could neither be delivered nor dead-lettered
+			for len(events) > 0 {
+				n := 1
+				if options.BatchSize > 1 {
+					n = options.BatchSize
+				}
+				if n > len(events) {
+					n = len(events)
+				}
+				batch := make([]Event, n)
+				for i, event := range events[:n] {
+					batch[i] = Event{Topic: topic, Offset: int64(offset + i), Key: event.key, Value: event.value, Headers: event.headers}
+				}
+				events = events[n:]
+
+				transformed, failed := transformEvents(ctx, transform, batch)
+				delivered := make([]Event, 0, len(batch))
+				for i, event := range batch {
+					if failed[i] == nil {
+						delivered = append(delivered, event)
+						continue
+					}
+					eventsLog.Error("failed to transform event at offset %v of topic %s: %v", event.Offset, topic, failed[i])
+					if options.DeadLetterTopic != "" {
+						publishLocalDeadLetter(topic, options.DeadLetterTopic, event, 0, failed[i])
+					}
+				}
+				if transformed != nil { // nil if events are filtered out
+					tctx, span := startDeliver(ctx, topic, delivered)
+					attempts := 0
+					err := backoff.Retry(func() error {
+						attempts++
+						var err error
+						if options.ExactlyOnce {
+							err = tellWithID(tctx, dest, eventRequestID(group, topic, 0, delivered[0].Offset, delivered[len(delivered)-1].Offset), transformed)
+						} else {
+							err = Tell(tctx, dest, time.Time{}, "", transformed)
+						}
+						if err != nil && ctx.Err() != nil {
+							return backoff.Permanent(err)
+						}
+						return err
+					}, backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), uint64(options.MaxRedelivery)), ctx))
+					endSpan(span, err)
+					if err != nil {
+						if ctx.Err() != nil {
+							return
+						}
+						eventsLog.Error("failed to tell target %v of event from topic %s after %v attempts: %v", dest.Target, topic, attempts, err)
+						if options.DeadLetterTopic == "" {
+							redeliver = true // do not advance the offset
+							break
+						}
+						for _, event := range delivered {
+							publishLocalDeadLetter(topic, options.DeadLetterTopic, event, attempts, err)
+						}
+					}
+				}
+				offset += n
+				localEvents.Lock()
+				localEvents.offsets[key] = offset
+				localEvents.Unlock()
+			}
+
+			var retry <-chan time.Time
+			if redeliver {
+				changed = nil // wait before consuming the events again
+				retry = time.After(redeliveryDelay)
+			}
+			select {
+			case <-changed:
+			case <-retry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return closed, nil
+}
+
+// publishLocalDeadLetter publishes an undeliverable event to the dead-letter topic
+// preserving the headers of the event and adding headers describing the failure
+func publishLocalDeadLetter(topic, deadLetterTopic string, event Event, attempts int, cause error) {
+	headers := map[string]string{}
+	for k, v := range event.Headers {
+		headers[k] = v
+	}
+	for _, h := range deadLetterHeaders(topic, 0, event.Offset, attempts, cause) {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	localPublisher{}.Publish(deadLetterTopic, event.Value, PublishOptions{Key: event.Key, Headers: headers})
+}
@@ -40,16 +40,18 @@ type Request interface {
 }
 
 type CallRequest struct {
-	RequestID string    // request id
-	Value     []byte    // payload
-	Deadline  time.Time // deadline to start executing request
-	Target    Target    // target
-	Method    string    // method
-	Caller    string    // source node
-	Sequence  int       // sequence number
-	ChildID   string
-	ParentID  string
-	IsEdited bool // used for debugging
+	RequestID   string    // request id
+	Value       []byte    // payload
+	Deadline    time.Time // deadline to start executing request
+	Target      Target    // target
+	Method      string    // method
+	Caller      string    // source node
+	Sequence    int       // sequence number
+	ChildID     string
+	ParentID    string
+	TraceParent string // W3C trace context of the sender
+	TraceState  string
+	IsEdited    bool // used for debugging
 }
 
 func (m CallRequest) requestID() string   { return m.RequestID }
@@ -68,15 +70,17 @@ func (m CallRequest) logString() string {
 }
 
 type TellRequest struct {
-	RequestID string    // request id
-	Value     []byte    // payload
-	Deadline  time.Time // deadline to start executing request
-	Target    Target    // target
-	Method    string    // target method
-	Sequence  int       // sequence number
-	ChildID   string
-	ParentID string //used for debugging
-	IsEdited bool //used for debugging
+	RequestID   string    // request id
+	Value       []byte    // payload
+	Deadline    time.Time // deadline to start executing request
+	Target      Target    // target
+	Method      string    // target method
+	Sequence    int       // sequence number
+	ChildID     string
+	ParentID    string //used for debugging
+	TraceParent string // W3C trace context of the sender
+	TraceState  string
+	IsEdited    bool //used for debugging
 }
 
 func (m TellRequest) requestID() string   { return m.RequestID }
@@ -126,14 +130,20 @@ func encode(topic string, partition int32, msg Message) *sarama.ProducerMessage
 		if m.Sequence != 0 {
 			meta["Sequence"] = strconv.Itoa(m.Sequence)
 		}
-		if m.IsEdited { meta["Edited"] = "1" }
+		if m.IsEdited {
+			meta["Edited"] = "1"
+		}
+		encodeTrace(m.TraceParent, m.TraceState, meta)
 		encodeTarget(m.Target, meta)
 	case TellRequest:
 		meta = map[string]string{"Type": "Tell", "RequestID": m.RequestID, "Method": m.Method, "Child": m.ChildID, "Parent": m.ParentID}
 		if m.Sequence != 0 {
 			meta["Sequence"] = strconv.Itoa(m.Sequence)
 		}
-		if m.IsEdited { meta["Edited"] = "1" }
+		if m.IsEdited {
+			meta["Edited"] = "1"
+		}
+		encodeTrace(m.TraceParent, m.TraceState, meta)
 		encodeTarget(m.Target, meta)
 	case Response:
 		meta = map[string]string{"Type": "Response", "RequestID": m.RequestID, "ErrMsg": m.ErrMsg}
@@ -174,15 +184,25 @@ func decode(msg *sarama.ConsumerMessage) Message {
 	}
 	switch meta["Type"] {
 	case "Call":
-		return CallRequest{RequestID: meta["RequestID"], ChildID: meta["Child"], ParentID: meta["Parent"], Sequence: sequence, Deadline: deadline, Target: decodeTarget(meta), Method: meta["Method"], Caller: meta["Caller"], Value: msg.Value}
+		return CallRequest{RequestID: meta["RequestID"], ChildID: meta["Child"], ParentID: meta["Parent"], Sequence: sequence, Deadline: deadline, Target: decodeTarget(meta), Method: meta["Method"], Caller: meta["Caller"], TraceParent: meta["traceparent"], TraceState: meta["tracestate"], Value: msg.Value}
 	case "Tell":
-		return TellRequest{RequestID: meta["RequestID"], ChildID: meta["Child"], Sequence: sequence, Deadline: deadline, Target: decodeTarget(meta), Method: meta["Method"], Value: msg.Value}
+		return TellRequest{RequestID: meta["RequestID"], ChildID: meta["Child"], Sequence: sequence, Deadline: deadline, Target: decodeTarget(meta), Method: meta["Method"], TraceParent: meta["traceparent"], TraceState: meta["tracestate"], Value: msg.Value}
 	case "Response":
 		return Response{RequestID: meta["RequestID"], Deadline: deadline, ErrMsg: meta["ErrMsg"], Value: msg.Value}
 	}
 	return Done{RequestID: meta["RequestID"], Deadline: deadline}
 }
 
+// the trace context uses the W3C header names so that Kafka tooling can follow traces across KAR messages
+func encodeTrace(traceParent, traceState string, meta map[string]string) {
+	if traceParent != "" {
+		meta["traceparent"] = traceParent
+		if traceState != "" {
+			meta["tracestate"] = traceState
+		}
+	}
+}
+
 func encodeTarget(target Target, meta map[string]string) {
 	switch t := target.(type) {
 	case Session:
@@ -0,0 +1,109 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/IBM/kar/core/pkg/logger"
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	produceDurationHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kar_rpc_produce_durations_histogram_seconds",
+		Help:    "KAR duration distribution of sending a message to Kafka.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+	})
+	inflightRequestsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kar_rpc_inflight_requests_gauge",
+		Help: "KAR number of requests being executed by this node.",
+	}, []string{"target"})
+	pendingCallsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kar_rpc_pending_calls_gauge",
+		Help: "KAR number of blocking calls from this node waiting for a response.",
+	})
+	handlerDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kar_rpc_handler_durations_histogram_seconds",
+		Help:    "KAR request handler duration distributions.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"method"})
+	sessionQueueDepthGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kar_rpc_session_queue_depth_gauge",
+		Help: "KAR number of requests waiting for their turn to execute on a session instance.",
+	}, []string{"type"})
+	placementCacheHitsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kar_rpc_placement_cache_hits_total",
+		Help: "KAR number of session placements found in the placement cache.",
+	})
+	placementCacheMissesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kar_rpc_placement_cache_misses_total",
+		Help: "KAR number of session placements not found in the placement cache.",
+	})
+	rebalancesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kar_rpc_rebalances_total",
+		Help: "KAR number of consumer group generations joined by this node.",
+	})
+	rebalanceInProgressGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kar_rpc_rebalance_in_progress_gauge",
+		Help: "KAR 1 if sending messages is paused by a rebalance, 0 otherwise.",
+	})
+	recoveryDurationHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kar_rpc_recovery_durations_histogram_seconds",
+		Help:    "KAR duration distribution of the recovery of failed nodes led by this node.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(produceDurationHistogram)
+	prometheus.MustRegister(inflightRequestsGauge)
+	prometheus.MustRegister(pendingCallsGauge)
+	prometheus.MustRegister(handlerDurationHistogram)
+	prometheus.MustRegister(sessionQueueDepthGauge)
+	prometheus.MustRegister(placementCacheHitsCounter)
+	prometheus.MustRegister(placementCacheMissesCounter)
+	prometheus.MustRegister(rebalancesCounter)
+	prometheus.MustRegister(rebalanceInProgressGauge)
+	prometheus.MustRegister(recoveryDurationHistogram)
+}
+
+// produce sends a message to Kafka and records the latency and the outcome
+func produce(msg *sarama.ProducerMessage) error {
+	start := time.Now()
+	_, _, err := producer.SendMessage(msg)
+	produceDurationHistogram.Observe(time.Since(start).Seconds())
+	setProducerError(err)
+	return err
+}
+
+// observeHandler records the execution of a request handler in the metrics and in a span;
+// the returned function must be called on completion
+func observeHandler(ctx context.Context, target string, m Request) (context.Context, func(error)) {
+	ctx, span := startSpan(requestTrace(ctx, m), "kar.execute", m)
+	ctx = logger.WithFields(ctx, requestFields(m))
+	inflight := inflightRequestsGauge.WithLabelValues(target)
+	inflight.Inc()
+	start := time.Now()
+	return ctx, func(err error) {
+		inflight.Dec()
+		handlerDurationHistogram.WithLabelValues(m.method()).Observe(time.Since(start).Seconds())
+		endSpan(span, err)
+	}
+}
@@ -0,0 +1,142 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// resolve the offset of a seek position in a partition
+func resolveOffset(client sarama.Client, topic string, partition int32, position SeekPosition) (int64, error) {
+	if position.Offset != nil && *position.Offset >= 0 {
+		return *position.Offset, nil
+	}
+	if position.Offset != nil { // OffsetOldest or OffsetNewest
+		return client.GetOffset(topic, partition, *position.Offset)
+	}
+	offset, err := client.GetOffset(topic, partition, position.Time.UnixMilli())
+	if err == nil && offset < 0 { // no event at or after this time
+		offset, err = client.GetOffset(topic, partition, sarama.OffsetNewest)
+	}
+	return offset, err
+}
+
+// seek commits new offsets for a consumer group, the group must have no active member
+func seek(conf *Config, topic, group string, position SeekPosition) error {
+	if conf.Local {
+		return seekLocal(topic, group, position)
+	}
+	client, err := sarama.NewClient(conf.Brokers, configureClient(conf))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return err
+	}
+	if position.Partition != nil {
+		if *position.Partition < 0 || int(*position.Partition) >= len(partitions) {
+			return sarama.ErrInvalidPartition
+		}
+		partitions = []int32{*position.Partition}
+	}
+	request := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           group,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+		RetentionTime:           -1,
+	}
+	for _, partition := range partitions {
+		offset, err := resolveOffset(client, topic, partition, position)
+		if err != nil {
+			return err
+		}
+		request.AddBlock(topic, partition, offset, 0, 0, "")
+	}
+	coordinator, err := client.Coordinator(group)
+	if err != nil {
+		return err
+	}
+	response, err := coordinator.CommitOffset(request)
+	if err != nil {
+		return err
+	}
+	for partition, kerr := range response.Errors[topic] {
+		if kerr == sarama.ErrUnknownMemberId || kerr == sarama.ErrIllegalGeneration {
+			return fmt.Errorf("consumer group %s has active members", group)
+		}
+		if kerr != sarama.ErrNoError {
+			return fmt.Errorf("failed to commit offset of partition %d: %w", partition, kerr)
+		}
+	}
+	return nil
+}
+
+// lag reports the committed offsets of a consumer group and the lag for each partition of a topic
+func lag(conf *Config, topic, group string, oldest bool) ([]PartitionLag, error) {
+	if conf.Local {
+		return lagLocal(topic, group, oldest), nil
+	}
+	client, err := sarama.NewClient(conf.Brokers, configureClient(conf))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	request := &sarama.OffsetFetchRequest{Version: 1, ConsumerGroup: group}
+	for _, partition := range partitions {
+		request.AddPartition(topic, partition)
+	}
+	coordinator, err := client.Coordinator(group)
+	if err != nil {
+		return nil, err
+	}
+	response, err := coordinator.FetchOffset(request)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]PartitionLag, len(partitions))
+	for i, partition := range partitions {
+		block := response.GetBlock(topic, partition)
+		if block == nil {
+			return nil, sarama.ErrIncompleteResponse
+		}
+		if block.Err != sarama.ErrNoError {
+			return nil, block.Err
+		}
+		end, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		start := block.Offset
+		if start < 0 { // no committed offset, the consumer group starts from the oldest or newest offset
+			if !oldest {
+				start = end
+			} else if start, err = client.GetOffset(topic, partition, sarama.OffsetOldest); err != nil {
+				return nil, err
+			}
+		}
+		result[i] = PartitionLag{Partition: partition, Offset: block.Offset, End: end, Lag: end - start}
+	}
+	return result, nil
+}
@@ -106,7 +106,7 @@ func getPartitions() ([]int32, <-chan struct{}) {
 }
 
 func getSessionNodeID(ctx context.Context, session Session) (string, error) {
-	node, err := store.Get(ctx, place(session.Name, session.ID))
+	node, err := store.Get(ctx, placeSession(session.Name, session.ID))
 	if err == store.ErrNil {
 		err = nil
 	}
@@ -114,7 +114,7 @@ func getSessionNodeID(ctx context.Context, session Session) (string, error) {
 }
 
 func delSession(ctx context.Context, session Session) error {
-	_, err := store.Del(ctx, place(session.Name, session.ID))
+	_, err := store.Del(ctx, placeSession(session.Name, session.ID))
 	return err
 }
 
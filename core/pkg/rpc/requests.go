@@ -21,6 +21,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,6 +37,8 @@ type sessionKey struct {
 
 const (
 	releasedFlow = "released"
+
+	eventRequestPrefix = "req-event-"
 )
 
 var (
@@ -44,6 +48,7 @@ var (
 	handlersNode                     = map[string]NodeHandler{}    // registered method handlers for node targets
 	sessionTable                     = sync.Map{}                  // session table: SessionKey -> *SessionInstance
 	deferredLocks                    = sync.Map{}                  // locks being defered by tail calls: deferredLockId -> chan
+	eventRequests                    = sync.Map{}                  // deliveries of events queued or executing on this node: requestId -> struct{}
 	cancellation                     = false                       // whether to cancel a pending call if the caller has failed
 	sessionBusyTimeout time.Duration = 0
 	deactivateCallback               = func(ctx context.Context, i *SessionInstance) error { i.Activated = false; return nil }
@@ -53,6 +58,22 @@ func newRequestId() string {
 	return "req-" + uuid.New().String()
 }
 
+// log fields of a request
+func requestFields(m Request) logger.Fields {
+	fields := logger.Fields{"request_id": m.requestID()}
+	switch t := m.target().(type) {
+	case Session:
+		fields["actor_type"] = t.Name
+		fields["actor_id"] = t.ID
+		if t.Flow != "" {
+			fields["flow_id"] = t.Flow
+		}
+	case Service:
+		fields["service"] = t.Name
+	}
+	return fields
+}
+
 func getLocalActivatedSessions(ctx context.Context, name string) map[string][]string {
 	information := make(map[string][]string)
 	sessionTable.Range(func(key, v interface{}) bool {
@@ -78,7 +99,7 @@ func collectInactiveSessions(ctx context.Context, time time.Time, callback func(
 				before := instance.next
 				instance.next = make(chan struct{}, 1)
 				savedLast := instance.next
-				logger.Debug("Scheduling deactivation of %v", v)
+				rpcLog.Debug("Scheduling deactivation of %v", v)
 				go func() {
 					// wait
 					select {
@@ -86,9 +107,9 @@ func collectInactiveSessions(ctx context.Context, time time.Time, callback func(
 					case <-ctx.Done():
 						return
 					}
-					logger.Debug("Deactivation of %v is executing", v)
+					rpcLog.Debug("Deactivation of %v is executing", v)
 					if instance.ActiveFlow != releasedFlow {
-						logger.Error("Flow violation: %v was already owned when acquired by deactivate", instance)
+						rpcLog.Error("Flow violation: %v was already owned when acquired by deactivate", instance)
 					}
 					instance.ActiveFlow = "flow-deactivate-" + uuid.New().String()
 
@@ -113,10 +134,10 @@ func collectInactiveSessions(ctx context.Context, time time.Time, callback func(
 						sessionTable.Delete(key)
 						close(savedLast)
 						<-instance.lock
-						logger.Debug("Deactivation of %v completed", v)
+						rpcLog.Debug("Deactivation of %v completed", v)
 					} else {
 						<-instance.lock
-						logger.Debug("Deactivation of %v aborted; subsequent task detected", v)
+						rpcLog.Debug("Deactivation of %v aborted; subsequent task detected", v)
 						savedLast <- struct{}{}
 					}
 				}()
@@ -144,7 +165,7 @@ func collectInactiveSessions(ctx context.Context, time time.Time, callback func(
 func sendOrDie(ctx context.Context, msg Message) {
 	err := Send(ctx, msg)
 	if err != nil && err != ctx.Err() && err != ErrUnavailable {
-		logger.Fatal("Producer error: cannot send message with request id %s: %v", msg.requestID(), err)
+		rpcLog.Fatal("Producer error: cannot send message with request id %s: %v", msg.requestID(), err)
 	}
 }
 
@@ -174,7 +195,7 @@ func accept(ctx context.Context, msg Message) {
 
 		var waitForChild chan Result = nil
 		if m.childID() != "" {
-			logger.Debug("Parent is preparing to wait for child to complete before exeucting: %v", m.logString())
+			rpcLog.Debug("Parent is preparing to wait for child to complete before exeucting: %v", m.logString())
 			waitForChild = make(chan Result, 1) // capacity one to be able to store result before accepting it
 			requests.Store(m.childID(), waitForChild)
 		}
@@ -188,7 +209,7 @@ func accept(ctx context.Context, msg Message) {
 					case <-ctx.Done():
 						return
 					}
-					logger.Debug("Child has completed; start execution of parent: %v", m.logString())
+					rpcLog.Debug("Child has completed; start execution of parent: %v", m.logString())
 					requests.Delete(m.childID())
 				}
 				f := handlersService[m.method()]
@@ -196,7 +217,9 @@ func accept(ctx context.Context, msg Message) {
 					errMsg := fmt.Sprintf("undefined method %v", m.method())
 					sendOrDie(ctx, Response{RequestID: m.requestID(), Deadline: m.deadline(), Node: m.Caller, ErrMsg: errMsg, Value: nil})
 				} else {
-					value, err := f(ctx, target, m.value())
+					hctx, done := observeHandler(ctx, "service", m)
+					value, err := f(hctx, target, m.value())
+					done(err)
 					if err != nil {
 						value, _ = json.Marshal(err) // attempt to serialize error object, ignore errors
 						sendOrDie(ctx, Response{RequestID: m.requestID(), Deadline: m.deadline(), Node: m.Caller, ErrMsg: err.Error(), Value: value})
@@ -217,7 +240,9 @@ func accept(ctx context.Context, msg Message) {
 					errMsg := fmt.Sprintf("undefined method %v", m.method())
 					sendOrDie(ctx, Response{RequestID: m.requestID(), Deadline: m.deadline(), Node: m.Caller, ErrMsg: errMsg, Value: nil})
 				} else {
-					value, err := f(ctx, target, m.value())
+					hctx, done := observeHandler(ctx, "node", m)
+					value, err := f(hctx, target, m.value())
+					done(err)
 					if err != nil {
 						value, _ = json.Marshal(err) // attempt to serialize error object, ignore errors
 						sendOrDie(ctx, Response{RequestID: m.requestID(), Deadline: m.deadline(), Node: m.Caller, ErrMsg: err.Error(), Value: value})
@@ -231,7 +256,7 @@ func accept(ctx context.Context, msg Message) {
 	case TellRequest:
 		if !m.deadline().IsZero() && m.deadline().Before(time.Now()) {
 			go func() {
-				logger.Warning("tell %s to %v dropped at time %v due to expired deadline %v", m.requestID(), m.target(), time.Now(), m.deadline())
+				rpcLog.Warning("tell %s to %v dropped at time %v due to expired deadline %v", m.requestID(), m.target(), time.Now(), m.deadline())
 				sendOrDie(ctx, Done{RequestID: m.requestID(), Deadline: m.deadline()})
 			}()
 			return
@@ -239,7 +264,7 @@ func accept(ctx context.Context, msg Message) {
 
 		var waitForChild chan Result = nil
 		if m.childID() != "" {
-			logger.Debug("Parent is preparing to wait for child to complete before executing: %v", m.logString())
+			rpcLog.Debug("Parent is preparing to wait for child to complete before executing: %v", m.logString())
 			waitForChild = make(chan Result, 1) // capacity one to be able to store result before accepting it
 			requests.Store(m.childID(), waitForChild)
 		}
@@ -253,23 +278,32 @@ func accept(ctx context.Context, msg Message) {
 					case <-ctx.Done():
 						return
 					}
-					logger.Debug("Child has completed; start execution of parent: %v", m.logString())
+					rpcLog.Debug("Child has completed; start execution of parent: %v", m.logString())
 					requests.Delete(m.childID())
 				}
 				f := handlersService[m.method()]
 				if f == nil {
-					logger.Warning("tell %s to %v requested undefined method %v", m.requestID(), m.target(), m.method())
+					rpcLog.Warning("tell %s to %v requested undefined method %v", m.requestID(), m.target(), m.method())
 					sendOrDie(ctx, Done{RequestID: m.requestID(), Deadline: m.deadline()})
 				} else {
-					_, err := f(ctx, target, m.value())
+					hctx, done := observeHandler(ctx, "service", m)
+					_, err := f(hctx, target, m.value())
+					done(err)
 					if err != nil && err != ctx.Err() {
-						logger.Warning("tell %s to %v returned an error: %v", m.requestID(), m.target(), err)
+						rpcLog.WarningContext(hctx, "tell %s to %v returned an error: %v", m.requestID(), m.target(), err)
 					}
 					sendOrDie(ctx, Done{RequestID: m.requestID(), Deadline: m.deadline()})
 				}
 			}()
 
 		case Session:
+			if m.Sequence == 0 && isEventRequestID(m.RequestID) {
+				if _, loaded := eventRequests.LoadOrStore(m.RequestID, struct{}{}); loaded {
+					// the events are already being delivered; no Done record since the first delivery will produce it
+					rpcLog.Debug("dropping duplicate delivery of events %v", m.logString())
+					return
+				}
+			}
 			acceptSession(ctx, target, m, waitForChild)
 
 		case Node:
@@ -277,11 +311,13 @@ func accept(ctx context.Context, msg Message) {
 			go func() {
 				f := handlersNode[m.method()]
 				if f == nil {
-					logger.Warning("tell %s to %v requested undefined method %v", m.requestID(), m.target(), m.method())
+					rpcLog.Warning("tell %s to %v requested undefined method %v", m.requestID(), m.target(), m.method())
 				} else {
-					_, err := f(ctx, target, m.value())
+					hctx, done := observeHandler(ctx, "node", m)
+					_, err := f(hctx, target, m.value())
+					done(err)
 					if err != nil && err != ctx.Err() {
-						logger.Warning("tell %s to %v returned an error: %v", m.requestID(), m.target(), err)
+						rpcLog.WarningContext(hctx, "tell %s to %v returned an error: %v", m.requestID(), m.target(), err)
 					}
 				}
 			}()
@@ -327,18 +363,18 @@ func acceptSession(ctx context.Context, target Session, msg Request, waitForChil
 			}
 		}
 		if dl == nil {
-			logger.Debug("reentrant message (no deferred lock) %v", msg.logString())
+			rpcLog.Debug("reentrant message (no deferred lock) %v", msg.logString())
 		} else {
-			logger.Debug("reentrant message (with deferred lock) %v", msg.logString())
+			rpcLog.Debug("reentrant message (with deferred lock) %v", msg.logString())
 		}
 		go handleSessionRequest(ctx, nil, waitForChild, dl, instance, target, msg, dl != nil)
 	} else if target.Flow == "nonexclusive" {
-		logger.Debug("nonexclusive message %v", msg.logString())
+		rpcLog.Debug("nonexclusive message %v", msg.logString())
 		go handleSessionRequest(ctx, nil, waitForChild, nil, instance, target, msg, false)
 	} else {
 		before := instance.next
 		instance.next = make(chan struct{}, 1)
-		logger.Debug("queued message %v", msg.logString())
+		rpcLog.Debug("queued message %v", msg.logString())
 		go handleSessionRequest(ctx, before, waitForChild, instance.next, instance, target, msg, true)
 	}
 
@@ -348,21 +384,38 @@ func acceptSession(ctx context.Context, target Session, msg Request, waitForChil
 
 // handleSessionRequest executes on a go routine spawned to process a single request; it can safely block
 func handleSessionRequest(ctx context.Context, before chan struct{}, waitForChild chan Result, after chan struct{}, instance *SessionInstance, target Session, m Request, clearFlowOnRelease bool) {
+	if tr, ok := m.(TellRequest); ok && tr.Sequence == 0 && isEventRequestID(tr.RequestID) {
+		defer eventRequests.Delete(tr.RequestID)
+	}
+
+	endQueue := func() {}
+	if before != nil || waitForChild != nil {
+		// trace the time spent waiting for the instance or for the child request
+		_, span := startSpan(requestTrace(ctx, m), "kar.queue", m)
+		endQueue = func() { span.End() }
+		defer endQueue()
+	}
+
 	if before != nil {
 		// wait for my turn to execute
-		logger.Debug("%v is waiting to execute %v", instance, m.logString())
+		rpcLog.Debug("%v is waiting to execute %v", instance, m.logString())
+		queued := sessionQueueDepthGauge.WithLabelValues(target.Name)
+		queued.Inc()
 		if sessionBusyTimeout > 0 {
 			select {
 			case <-before:
+				queued.Dec()
 			case <-ctx.Done():
+				queued.Dec()
 				return
 			case <-time.After(sessionBusyTimeout):
-				logger.Debug("%v has timed out waiting to execute %v", instance, m.logString())
+				queued.Dec()
+				rpcLog.Debug("%v has timed out waiting to execute %v", instance, m.logString())
 				errMsg := fmt.Sprintf("Possible deadlock: timed out waiting in instance queue for %v", target)
 				if cr, ok := m.(CallRequest); ok {
 					sendOrDie(ctx, Response{RequestID: cr.requestID(), Deadline: cr.deadline(), Node: cr.Caller, ErrMsg: errMsg, Value: nil})
 				} else {
-					logger.Warning(errMsg)
+					rpcLog.Warning(errMsg)
 					sendOrDie(ctx, Done{RequestID: m.requestID(), Deadline: m.deadline()})
 				}
 				// The actual task timed out, but I am still responsible for releasing `after` at the appropriate time
@@ -380,7 +433,9 @@ func handleSessionRequest(ctx context.Context, before chan struct{}, waitForChil
 			// Simple case.  No timeout, so just wait for my turn
 			select {
 			case <-before:
+				queued.Dec()
 			case <-ctx.Done():
+				queued.Dec()
 				return
 			}
 		}
@@ -388,13 +443,13 @@ func handleSessionRequest(ctx context.Context, before chan struct{}, waitForChil
 
 	if waitForChild != nil {
 		// If this task is being re-run to recover from a failure, it must wait until child task from prior execution finishes
-		logger.Debug("%v is waiting for child to finish", m.logString())
+		rpcLog.Debug("%v is waiting for child to finish", m.logString())
 		if instance.ActiveFlow != target.Flow {
-			logger.Error("Flow violation: %v was not already owned by the waiting parent's flow %v", instance, target.Flow)
+			rpcLog.Error("Flow violation: %v was not already owned by the waiting parent's flow %v", instance, target.Flow)
 		}
 		select {
 		case <-waitForChild:
-			logger.Debug("%v is released; child finished", m.logString())
+			rpcLog.Debug("%v is released; child finished", m.logString())
 			instance.ActiveFlow = releasedFlow
 		case <-ctx.Done():
 			return
@@ -402,10 +457,11 @@ func handleSessionRequest(ctx context.Context, before chan struct{}, waitForChil
 	}
 
 	// Now it is my turn to execute.
-	logger.Debug("%v is invoking handler", m.logString())
+	endQueue()
+	rpcLog.Debug("%v is invoking handler", m.logString())
 	if before != nil {
 		if instance.ActiveFlow != releasedFlow {
-			logger.Error("Flow violation: %v was already owned when it time for %v to execute", instance, target.Flow)
+			rpcLog.Error("Flow violation: %v was already owned when it time for %v to execute", instance, target.Flow)
 		}
 		instance.ActiveFlow = target.Flow
 	}
@@ -419,17 +475,21 @@ func handleSessionRequest(ctx context.Context, before chan struct{}, waitForChil
 		if cr, ok := m.(CallRequest); ok {
 			sendOrDie(ctx, Response{RequestID: m.requestID(), Deadline: m.deadline(), Node: cr.Caller, ErrMsg: errMsg, Value: nil})
 		} else {
-			logger.Warning(errMsg)
+			rpcLog.Warning(errMsg)
 			sendOrDie(ctx, Done{RequestID: m.requestID(), Deadline: m.deadline()})
 		}
 	} else {
 		var dest *Destination
 		var value []byte
 		var err error
+		hctx := logger.WithFields(ctx, requestFields(m))
 		if cr, ok := m.(CallRequest); ok && cancellation && node2partition[cr.Caller] == 0 {
-			logger.Info("Cancelling call request %s from dead sidecar %s", m.requestID(), cr.Caller)
+			rpcLog.InfoContext(hctx, "Cancelling call request %s from dead sidecar %s", m.requestID(), cr.Caller)
 		} else {
-			dest, value, err = f(ctx, target, instance, m.requestID(), m.value()) // The call to the higher-level handler that does something useful....at last!!!
+			var done func(error)
+			hctx, done = observeHandler(ctx, "session", m)
+			dest, value, err = f(hctx, target, instance, m.requestID(), m.value()) // The call to the higher-level handler that does something useful....at last!!!
+			done(err)
 		}
 		if instance.Activated && target.Flow != "nonexclusive" {
 			instance.lastAccess = time.Now()
@@ -444,7 +504,7 @@ func handleSessionRequest(ctx context.Context, before chan struct{}, waitForChil
 					value, _ = json.Marshal(err) // attempt to serialize error object, ignore errors
 					sendOrDie(ctx, Response{RequestID: m.requestID(), Deadline: m.deadline(), Node: cr.Caller, ErrMsg: err.Error(), Value: value})
 				} else {
-					logger.Warning("tell %s to %v returned an error: %v", m.requestID(), m.target(), err)
+					rpcLog.WarningContext(hctx, "tell %s to %v returned an error: %v", m.requestID(), m.target(), err)
 					sendOrDie(ctx, Done{RequestID: m.requestID(), Deadline: m.deadline()})
 				}
 			}
@@ -462,9 +522,9 @@ func handleSessionRequest(ctx context.Context, before chan struct{}, waitForChil
 				deadline := m.deadline()
 				if next, ok := dest.Target.(Session); ok && after != nil && next.DeferredLockID != "" {
 					// Defer my obligation to release after to the next invocation of this flow on this instance
-					logger.Debug("%v is deferring lock to %v", m.logString(), next.DeferredLockID)
+					rpcLog.Debug("%v is deferring lock to %v", m.logString(), next.DeferredLockID)
 					if next.Flow != instance.ActiveFlow {
-						logger.Error("Flow violation: improper lock deferal in %v from flow %v to flow %v", target, instance.ActiveFlow, next.Flow)
+						rpcLog.Error("Flow violation: improper lock deferal in %v from flow %v to flow %v", target, instance.ActiveFlow, next.Flow)
 					}
 					deferredLocks.Store(next.DeferredLockID, after)
 					after = nil
@@ -476,10 +536,10 @@ func handleSessionRequest(ctx context.Context, before chan struct{}, waitForChil
 					}
 				}
 				if cr, ok := m.(CallRequest); ok {
-					sendOrDie(ctx, CallRequest{RequestID: m.requestID(), Deadline: deadline, Caller: cr.Caller, Value: value, Target: dest.Target, Method: dest.Method, Sequence: cr.Sequence + 1})
+					sendOrDie(ctx, CallRequest{RequestID: m.requestID(), Deadline: deadline, Caller: cr.Caller, Value: value, Target: dest.Target, Method: dest.Method, Sequence: cr.Sequence + 1, TraceParent: cr.TraceParent, TraceState: cr.TraceState})
 				} else {
 					tr := m.(TellRequest)
-					sendOrDie(ctx, TellRequest{RequestID: m.requestID(), Deadline: deadline, Value: value, Target: dest.Target, Method: dest.Method, Sequence: tr.Sequence + 1})
+					sendOrDie(ctx, TellRequest{RequestID: m.requestID(), Deadline: deadline, Value: value, Target: dest.Target, Method: dest.Method, Sequence: tr.Sequence + 1, TraceParent: tr.TraceParent, TraceState: tr.TraceState})
 				}
 			}
 		}
@@ -488,9 +548,9 @@ func handleSessionRequest(ctx context.Context, before chan struct{}, waitForChil
 	// Finally, if I am responsible for releasing the next task, do so.
 	if after != nil {
 		if clearFlowOnRelease {
-			logger.Debug("%v has completed and released lock", m.logString())
+			rpcLog.Debug("%v has completed and released lock", m.logString())
 		} else {
-			logger.Error("Flow violation: %v executing %v released lock but did not clear flow", instance, m.requestID())
+			rpcLog.Error("Flow violation: %v executing %v released lock but did not clear flow", instance, m.requestID())
 		}
 		after <- struct{}{}
 	}
@@ -503,6 +563,8 @@ func call(ctx context.Context, dest Destination, deadline time.Time, parentID st
 		return nil, err
 	}
 	defer requests.Delete(requestID)
+	pendingCallsGauge.Inc()
+	defer pendingCallsGauge.Dec()
 	select {
 	case result := <-ch:
 		return result.Value, result.Err
@@ -517,6 +579,21 @@ func tell(ctx context.Context, dest Destination, deadline time.Time, parentID st
 	return Send(ctx, TellRequest{RequestID: requestID, Target: dest.Target, Method: dest.Method, Deadline: deadline, Value: value, ParentID: parentID})
 }
 
+// Call method with the given request id and return immediately (result will be discarded)
+func tellWithID(ctx context.Context, dest Destination, requestID string, value []byte) error {
+	return Send(ctx, TellRequest{RequestID: requestID, Target: dest.Target, Method: dest.Method, Value: value})
+}
+
+// Deterministic request id for the delivery of the events between the given offsets
+func eventRequestID(group, topic string, partition int32, first, last int64) string {
+	return eventRequestPrefix + group + "-" + topic + "-" + strconv.Itoa(int(partition)) + "-" + strconv.FormatInt(first, 10) + "-" + strconv.FormatInt(last, 10)
+}
+
+// Is this the request id of a delivery of events?
+func isEventRequestID(requestID string) bool {
+	return strings.HasPrefix(requestID, eventRequestPrefix)
+}
+
 // Call method and return a request id and a result channel
 func async(ctx context.Context, dest Destination, deadline time.Time, parentID string, value []byte) (string, <-chan Result, error) {
 	requestID := newRequestId()
@@ -536,6 +613,8 @@ func callEdited(ctx context.Context, dest Destination, deadline time.Time, paren
 		return nil, err
 	}
 	defer requests.Delete(requestID)
+	pendingCallsGauge.Inc()
+	defer pendingCallsGauge.Dec()
 	select {
 	case result := <-ch:
 		return result.Value, result.Err
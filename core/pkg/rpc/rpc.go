@@ -18,21 +18,28 @@ package rpc
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"time"
 )
 
 // Config specifies the Kafka configuration
 type Config struct {
-	Version            string   // Kafka version
-	Brokers            []string // Kafka brokers
-	User               string   // Kafka SASL user
-	Password           string   // Kafka SASL password
+	Version            string        // Kafka version
+	Brokers            []string      // Kafka brokers
+	User               string        // Kafka SASL user
+	Password           string        // Kafka SASL password
+	Mechanism          string        // Kafka SASL mechanism (PLAIN if empty)
+	TokenProvider      TokenProvider // Kafka SASL/OAUTHBEARER token provider
 	EnableTLS          bool
 	TLSSkipVerify      bool
+	RootCAs            *x509.CertPool    // CA certificates to verify Kafka brokers if not the system CAs
+	Certificates       []tls.Certificate // client certificates for mutual TLS if any
 	TopicConfig        map[string]*string
 	SessionBusyTimeout time.Duration
 	Cancellation       bool
+	Local              bool // use an in-process transport instead of Kafka
 }
 
 // Target of an invocation
@@ -72,8 +79,20 @@ type ServiceHandler func(context.Context, Service, []byte) ([]byte, error)
 type SessionHandler func(context.Context, Session, *SessionInstance, string, []byte) (*Destination, []byte, error)
 type NodeHandler func(context.Context, Node, []byte) ([]byte, error)
 
-// Data transformer applied to convert external events to Tell payloads
-type Transformer func(context.Context, []byte) ([]byte, error)
+// An external event consumed from a topic
+type Event struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+}
+
+// Data transformer applied to convert a batch of external events to a Tell payload
+// Batches contain a single event unless batching is enabled in the SubscribeOptions
+// A nil payload with a nil error indicates the events should be skipped
+type Transformer func(context.Context, []Event) ([]byte, error)
 
 // Result of async call
 type Result struct {
@@ -112,7 +131,7 @@ func RegisterNode(method string, handler NodeHandler) {
 	registerNode(method, handler)
 }
 
-// Connect to Kafka
+// Connect to Kafka (or start the in-process transport in local mode)
 func Connect(ctx context.Context, topic string, runtimePort int32, conf *Config, services ...string) (<-chan struct{}, error) {
 	return connect(ctx, topic, runtimePort, conf, services...)
 }
@@ -199,6 +218,11 @@ func GetServiceNodeIDs(service string) ([]string, <-chan struct{}) {
 	return getServiceNodeIDs(service)
 }
 
+// GetHealth returns the state of the transport of the current node
+func GetHealth() Health {
+	return getHealth()
+}
+
 // GetPartition returns the partition for the current node
 func GetPartition() int32 {
 	return getPartition()
@@ -235,9 +259,31 @@ func DeleteTopic(conf *Config, topic string) error {
 	return deleteTopic(conf, topic)
 }
 
+// PublishOptions describes the optional attributes of a published event
+type PublishOptions struct {
+	Key       []byte            // events with the same key are published to the same partition
+	Headers   map[string]string // headers of the event
+	Partition *int32            // explicit partition overriding the key, nil if unspecified
+}
+
+// PublishResult describes the location of a published event
+type PublishResult struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// PublishEvent is an event published as part of a batch
+type PublishEvent struct {
+	Value []byte
+	PublishOptions
+}
+
 // A Publisher makes it possible to publish events to Kafka
 type Publisher interface {
-	Publish(topic string, value []byte) error
+	Publish(topic string, value []byte, options PublishOptions) (PublishResult, error)
+	// PublishBatch publishes a batch of events in one round trip, atomically if transactional
+	PublishBatch(topic string, events []PublishEvent, transactional bool) ([]PublishResult, error)
 	Close() error
 }
 
@@ -246,7 +292,49 @@ func NewPublisher(conf *Config) (Publisher, error) {
 	return newPublisher(conf)
 }
 
+// SubscribeOptions controls the delivery of events to a subscriber
+type SubscribeOptions struct {
+	OffsetOldest    bool          // use the oldest available offset if no offset was previously committed
+	DeadLetterTopic string        // topic receiving the events that cannot be delivered, "" to skip malformed events and consume the others again
+	MaxRedelivery   int           // number of times to retry delivering an event before giving up
+	BatchSize       int           // maximum number of events per batch, 0 to disable batching
+	BatchLinger     time.Duration // maximum time to wait for a batch to fill up
+	ExactlyOnce     bool          // derive request ids from event offsets so that redelivered events can be deduplicated
+}
+
 // Subscribe to a topic
-func Subscribe(ctx context.Context, conf *Config, topic, group string, oldest bool, dest Destination, transform Transformer) (<-chan struct{}, error) {
-	return subscribe(ctx, conf, topic, group, oldest, dest, transform)
+func Subscribe(ctx context.Context, conf *Config, topic, group string, options SubscribeOptions, dest Destination, transform Transformer) (<-chan struct{}, error) {
+	return subscribe(ctx, conf, topic, group, options, dest, transform)
+}
+
+// Special offsets for SeekPosition
+const (
+	OffsetNewest int64 = -1 // the offset of the next event to be published
+	OffsetOldest int64 = -2 // the oldest available offset
+)
+
+// SeekPosition describes the position to move a consumer group to
+type SeekPosition struct {
+	Offset    *int64    // absolute offset, OffsetNewest, or OffsetOldest; nil to seek to Time
+	Time      time.Time // the offset of the first event published at or after this time
+	Partition *int32    // partition to seek, nil for all partitions
+}
+
+// PartitionLag describes the progress of a consumer group in a partition
+type PartitionLag struct {
+	Partition int32 `json:"partition"`
+	Offset    int64 `json:"offset"` // committed offset, -1 if none
+	End       int64 `json:"end"`    // offset of the next event to be published
+	Lag       int64 `json:"lag"`    // number of events not yet consumed
+}
+
+// Seek moves a consumer group to a new position in a topic; the consumer group must have no active member
+func Seek(conf *Config, topic, group string, position SeekPosition) error {
+	return seek(conf, topic, group, position)
+}
+
+// Lag returns the committed offsets and lag of a consumer group for each partition of a topic;
+// oldest specifies where the consumer group starts in partitions without a committed offset
+func Lag(conf *Config, topic, group string, oldest bool) ([]PartitionLag, error) {
+	return lag(conf, topic, group, oldest)
 }
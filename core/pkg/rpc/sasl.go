@@ -0,0 +1,217 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// SASL mechanisms
+const (
+	SASLPlain       = sarama.SASLTypePlaintext
+	SASLScramSHA256 = sarama.SASLTypeSCRAMSHA256
+	SASLScramSHA512 = sarama.SASLTypeSCRAMSHA512
+	SASLOAuthBearer = sarama.SASLTypeOAuth
+)
+
+// A TokenProvider provides access tokens for SASL/OAUTHBEARER authentication.
+// Token is invoked every time a connection to a broker is established.
+type TokenProvider interface {
+	Token() (string, error)
+}
+
+// tokenProvider adapts a TokenProvider to sarama
+type tokenProvider struct {
+	provider TokenProvider
+}
+
+func (p tokenProvider) Token() (*sarama.AccessToken, error) {
+	token, err := p.provider.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &sarama.AccessToken{Token: token}, nil
+}
+
+// fileTokenProvider reads access tokens from a file, rereading the file when modified
+type fileTokenProvider struct {
+	path    string
+	lock    sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+// NewFileTokenProvider returns a TokenProvider that reads the token from a file.
+// The file is read again whenever its modification time changes, so the token
+// can be refreshed by an external process.
+func NewFileTokenProvider(path string) TokenProvider {
+	return &fileTokenProvider{path: path}
+}
+
+func (p *fileTokenProvider) Token() (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return "", err
+	}
+	if p.token != "" && info.ModTime().Equal(p.modTime) {
+		return p.token, nil
+	}
+	buf, err := os.ReadFile(p.path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(buf))
+	if token == "" {
+		return "", fmt.Errorf("empty token file %s", p.path)
+	}
+	p.token = token
+	p.modTime = info.ModTime()
+	return p.token, nil
+}
+
+// scramClient implements the client side of the SCRAM authentication exchange (RFC 5802)
+type scramClient struct {
+	hash      func() hash.Hash
+	user      string
+	password  string
+	gs2Header string
+	nonce     string
+	firstBare string // client-first-message-bare
+	signature []byte // expected server signature
+	step      int
+}
+
+func newSCRAMClient(mechanism string) func() sarama.SCRAMClient {
+	h := sha256.New
+	if mechanism == SASLScramSHA512 {
+		h = sha512.New
+	}
+	return func() sarama.SCRAMClient { return &scramClient{hash: h} }
+}
+
+// escape a SCRAM user name
+func scramEscape(s string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s)
+}
+
+func (c *scramClient) hmac(key []byte, message string) []byte {
+	mac := hmac.New(c.hash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	c.user = userName
+	c.password = password
+	c.gs2Header = "n,,"
+	if authzID != "" {
+		c.gs2Header = "n,a=" + scramEscape(authzID) + ","
+	}
+	c.nonce = base64.RawStdEncoding.EncodeToString(buf)
+	c.step = 0
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	c.step++
+	switch c.step {
+	case 1: // client-first-message
+		c.firstBare = "n=" + scramEscape(c.user) + ",r=" + c.nonce
+		return c.gs2Header + c.firstBare, nil
+
+	case 2: // server-first-message -> client-final-message
+		attributes := scramAttributes(challenge)
+		if e, ok := attributes["e"]; ok {
+			return "", fmt.Errorf("SCRAM authentication failed: %s", e)
+		}
+		nonce := attributes["r"]
+		if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+			return "", errors.New("SCRAM authentication failed: invalid server nonce")
+		}
+		salt, err := base64.StdEncoding.DecodeString(attributes["s"])
+		if err != nil {
+			return "", fmt.Errorf("SCRAM authentication failed: invalid salt: %w", err)
+		}
+		iterations, err := strconv.Atoi(attributes["i"])
+		if err != nil || iterations <= 0 {
+			return "", errors.New("SCRAM authentication failed: invalid iteration count")
+		}
+		finalWithoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(c.gs2Header)) + ",r=" + nonce
+		authMessage := c.firstBare + "," + challenge + "," + finalWithoutProof
+		saltedPassword := pbkdf2.Key([]byte(c.password), salt, iterations, c.hash().Size(), c.hash)
+		clientKey := c.hmac(saltedPassword, "Client Key")
+		h := c.hash()
+		h.Write(clientKey)
+		clientSignature := c.hmac(h.Sum(nil), authMessage)
+		proof := make([]byte, len(clientKey))
+		for i := range clientKey {
+			proof[i] = clientKey[i] ^ clientSignature[i]
+		}
+		c.signature = c.hmac(c.hmac(saltedPassword, "Server Key"), authMessage)
+		return finalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+
+	case 3: // server-final-message
+		attributes := scramAttributes(challenge)
+		if e, ok := attributes["e"]; ok {
+			return "", fmt.Errorf("SCRAM authentication failed: %s", e)
+		}
+		signature, err := base64.StdEncoding.DecodeString(attributes["v"])
+		if err != nil || !hmac.Equal(signature, c.signature) {
+			return "", errors.New("SCRAM authentication failed: invalid server signature")
+		}
+		return "", nil
+
+	default:
+		return "", errors.New("SCRAM authentication failed: unexpected challenge")
+	}
+}
+
+func (c *scramClient) Done() bool {
+	return c.step >= 3
+}
+
+// parse the attributes of a SCRAM message
+func scramAttributes(message string) map[string]string {
+	attributes := map[string]string{}
+	for _, attribute := range strings.Split(message, ",") {
+		if kv := strings.SplitN(attribute, "=", 2); len(kv) == 2 {
+			attributes[kv[0]] = kv[1]
+		}
+	}
+	return attributes
+}
@@ -0,0 +1,123 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+// SCRAM-SHA-256 authentication exchange from RFC 7677 section 3
+const (
+	rfc7677Nonce       = "rOprNGfwEbeRWgbNEkqO"
+	rfc7677ClientFirst = "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"
+	rfc7677ServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	rfc7677ClientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	rfc7677ServerFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+)
+
+// beginRFC7677 starts the exchange of RFC 7677 with the nonce of the RFC
+func beginRFC7677(t *testing.T) sarama.SCRAMClient {
+	c := newSCRAMClient(SASLScramSHA256)()
+	if err := c.Begin("user", "pencil", ""); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	c.(*scramClient).nonce = rfc7677Nonce
+	return c
+}
+
+func TestSCRAMClientRFC7677(t *testing.T) {
+	c := beginRFC7677(t)
+	steps := []struct{ challenge, response string }{
+		{"", rfc7677ClientFirst},
+		{rfc7677ServerFirst, rfc7677ClientFinal},
+		{rfc7677ServerFinal, ""},
+	}
+	for i, step := range steps {
+		if c.Done() {
+			t.Fatalf("exchange done before step %v", i+1)
+		}
+		response, err := c.Step(step.challenge)
+		if err != nil {
+			t.Fatalf("step %v failed: %v", i+1, err)
+		}
+		if response != step.response {
+			t.Errorf("step %v returned %q, want %q", i+1, response, step.response)
+		}
+	}
+	if !c.Done() {
+		t.Errorf("exchange not done after the server-final-message")
+	}
+}
+
+func TestSCRAMClientErrors(t *testing.T) {
+	tests := []struct {
+		name                     string
+		serverFirst, serverFinal string
+		err                      string
+	}{
+		{"server error", "e=unknown-user", "", "unknown-user"},
+		{"foreign nonce", strings.Replace(rfc7677ServerFirst, "r=rOpr", "r=xOpr", 1), "", "invalid server nonce"},
+		{"unextended nonce", "r=" + rfc7677Nonce + ",s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096", "", "invalid server nonce"},
+		{"invalid salt", strings.Replace(rfc7677ServerFirst, "s=W22Z", "s=!22Z", 1), "", "invalid salt"},
+		{"invalid iterations", strings.Replace(rfc7677ServerFirst, "i=4096", "i=0", 1), "", "invalid iteration count"},
+		{"invalid server signature", rfc7677ServerFirst, "v=7rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=", "invalid server signature"},
+		{"server final error", rfc7677ServerFirst, "e=invalid-proof", "invalid-proof"},
+	}
+	for _, test := range tests {
+		c := beginRFC7677(t)
+		c.Step("")
+		_, err := c.Step(test.serverFirst)
+		if err == nil && test.serverFinal != "" {
+			_, err = c.Step(test.serverFinal)
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: exchange returned error %v, want error containing %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestSCRAMUserEscaping(t *testing.T) {
+	c := newSCRAMClient(SASLScramSHA512)()
+	if err := c.Begin("a=b,c", "pencil", "admin"); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	response, _ := c.Step("")
+	if prefix := "n,a=admin,n=a=3Db=2Cc,r="; !strings.HasPrefix(response, prefix) {
+		t.Errorf("client-first-message is %q, want prefix %q", response, prefix)
+	}
+}
+
+func TestConfigureClientSCRAM(t *testing.T) {
+	conf := configureClient(&Config{Version: "2.8.0", User: "user", Mechanism: SASLScramSHA256})
+	if !conf.Net.SASL.Enable || conf.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA256 {
+		t.Errorf("SCRAM without a password disables SASL")
+	}
+	if err := conf.Validate(); err == nil {
+		t.Errorf("SCRAM without a password is a valid configuration")
+	}
+	conf = configureClient(&Config{Version: "2.8.0", User: "user", Password: "pencil", Mechanism: SASLScramSHA512})
+	if err := conf.Validate(); err != nil || conf.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA512 {
+		t.Errorf("SCRAM configuration is invalid: %v", err)
+	}
+	conf = configureClient(&Config{Version: "2.8.0", Mechanism: SASLPlain})
+	if conf.Net.SASL.Enable {
+		t.Errorf("PLAIN without a password enables SASL")
+	}
+}
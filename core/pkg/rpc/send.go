@@ -21,7 +21,6 @@ import (
 	"math/rand"
 	"strings"
 
-	"github.com/IBM/kar/core/pkg/logger"
 	"github.com/IBM/kar/core/pkg/store"
 )
 
@@ -33,12 +32,18 @@ func place(names ...string) string {
 	return key
 }
 
+// placeSession returns the placement key of a session
+// tagged with the service and session so it is stored in the same hash slot as the other keys of the session
+func placeSession(service, session string) string {
+	return store.TaggedKey(service+"_"+session, place(service, session))
+}
+
 func alt(id string) string {
 	return "alt_" + id
 }
 
 func instance(key string) (string, string) {
-	parts := strings.Split(key, "_")
+	parts := strings.Split(store.UntaggedKey(key), "_")
 	return parts[1], parts[2]
 }
 
@@ -59,13 +64,15 @@ func routeToSession(ctx context.Context, service, session string) (string, int32
 		return "", 0, nil // no matching service
 	}
 
-	key := place(service, session)
+	key := placeSession(service, session)
 	if PlacementCache {
 		if e, ok := session2NodeCache.Load(key); ok {
 			entry := e.(*placementCacheEntry)
 			entry.used = true
+			placementCacheHitsCounter.Inc()
 			return entry.node, node2partition[entry.node], nil
 		}
+		placementCacheMissesCounter.Inc()
 	}
 
 	// Attempt to place (will discover global placement if already placed by someone else)
@@ -91,6 +98,13 @@ func routeToSession(ctx context.Context, service, session string) (string, int32
 
 // Send message (errors: cancelled, Redis, Kafka, ErrUnavailable)
 func Send(ctx context.Context, msg Message) error {
+	msg, span := startSend(ctx, msg)
+	err := send(ctx, msg)
+	endSpan(span, err)
+	return err
+}
+
+func send(ctx context.Context, msg Message) error {
 	// acquire R mutex
 	mu.RLock()
 	defer mu.RUnlock()
@@ -137,7 +151,12 @@ func Send(ctx context.Context, msg Message) error {
 	}
 
 	// send message
-	_, _, err := producer.SendMessage(encode(appTopic, partition, msg))
+	var err error
+	if local {
+		err = sendLocal(msg)
+	} else {
+		err = produce(encode(appTopic, partition, msg))
+	}
 	if err == nil && redirected != "" {
 		store.Del(ctx, redirected)
 	}
@@ -154,14 +173,13 @@ func resend(ctx context.Context, msg Request, drop bool) error {
 		switch v := msg.(type) {
 		case CallRequest:
 			m := Response{RequestID: v.RequestID, Node: v.Caller, ErrMsg: "node died before processing call request", Value: nil}
-			_, _, err := producer.SendMessage(encode(appTopic, node2partition[v.Caller], m))
-			return err
+			return produce(encode(appTopic, node2partition[v.Caller], m))
 		case TellRequest:
 			// TODO: don't hardcode debugger endpoint
 			if msg.method() != "handlerDebugger" {
-				logger.Warning("node died before processing tell request with id %s", v.requestID())
+				rpcLog.Warning("node died before processing tell request with id %s", v.requestID())
 			}
-			//logger.Warning("\tmessage: %v %v\n", msg.target(), string(msg.value()))
+			//rpcLog.Warning("\tmessage: %v %v\n", msg.target(), string(msg.value()))
 			return nil
 		}
 	case Service:
@@ -180,12 +198,10 @@ func resend(ctx context.Context, msg Request, drop bool) error {
 		store.Set(ctx, alt(msg.childID()), node)
 	}
 	// resend message
-	_, _, err := producer.SendMessage(encode(appTopic, partition, msg))
-	return err
+	return produce(encode(appTopic, partition, msg))
 }
 
 // Resend response during recovery (errors: cancelled, Redis, Kafka)
 func respond(ctx context.Context, msg Done) error {
-	_, _, err := producer.SendMessage(encode(appTopic, 0, msg))
-	return err
+	return produce(encode(appTopic, 0, msg))
 }
@@ -0,0 +1,33 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpc
+
+import (
+	"testing"
+
+	"github.com/IBM/kar/core/pkg/store"
+)
+
+func TestPlaceSession(t *testing.T) {
+	key := placeSession("my_type", "my_id")
+	if want := store.TaggedKey("my_type_my_id", "rpc_my_type_my_id"); key != want {
+		t.Errorf("placeSession returned %q, want %q", key, want)
+	}
+	if service, session := instance(placeSession("type", "id")); service != "type" || session != "id" {
+		t.Errorf("instance returned %q, %q, want %q, %q", service, session, "type", "id")
+	}
+}
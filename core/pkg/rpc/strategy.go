@@ -20,7 +20,6 @@ import (
 	"encoding/json"
 	"sync"
 
-	"github.com/IBM/kar/core/pkg/logger"
 	"github.com/Shopify/sarama"
 )
 
@@ -31,7 +30,7 @@ func (s *strategy) Name() string { return "custom" }
 
 // Assign partitions to group members
 func (s *strategy) Plan(members map[string]sarama.ConsumerGroupMemberMetadata, topics map[string][]int32) (sarama.BalanceStrategyPlan, error) {
-	logger.Info("enter plan")
+	rpcLog.Info("enter plan")
 
 	partitions := topics[appTopic]     // topic partitions
 	node2member := map[string]string{} // a map from node id to sarama member id
@@ -91,7 +90,7 @@ func (s *strategy) Plan(members map[string]sarama.ConsumerGroupMemberMetadata, t
 			newest[p] = max
 			if p != 0 && !recovery[p] {
 				clean = false
-				logger.Info("partition %d is not empty: %d < %d", p, min, max)
+				rpcLog.Info("partition %d is not empty: %d < %d", p, min, max)
 			} else if p == 0 && offset0 < max {
 				max0 = max
 				clean = false // only recover if there is a new node or new content in partition 0
@@ -118,7 +117,7 @@ func (s *strategy) Plan(members map[string]sarama.ConsumerGroupMemberMetadata, t
 			if err := admin.CreatePartitions(appTopic, int32(len(partitions))+missing, nil, false); err != nil {
 				return nil, err
 			}
-			logger.Info("exit plan errTooFewPartitions")
+			rpcLog.Info("exit plan errTooFewPartitions")
 			return nil, errTooFewPartitions
 		}
 	}
@@ -143,7 +142,7 @@ func (s *strategy) Plan(members map[string]sarama.ConsumerGroupMemberMetadata, t
 		recovery = nil
 	}
 
-	logger.Info("exit plan")
+	rpcLog.Info("exit plan")
 
 	return plan, nil
 }
@@ -154,7 +153,7 @@ func (s *strategy) AssignmentData(memberID string, topics map[string][]int32, ge
 }
 
 func updateRoutes() error {
-	logger.Info("enter update routes")
+	rpcLog.Info("enter update routes")
 
 	// retrieve consumer group description
 	groups, err := admin.DescribeConsumerGroups([]string{appTopic})
@@ -198,7 +197,7 @@ func updateRoutes() error {
 		}
 	}
 
-	logger.Info("exit update routes")
+	rpcLog.Info("exit update routes")
 
 	return nil
 }
@@ -19,13 +19,19 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/IBM/kar/core/pkg/logger"
 	"github.com/Shopify/sarama"
+	"github.com/cenkalti/backoff/v4"
 )
 
 func createTopic(conf *Config, topic string, parameters string) error {
+	if conf.Local {
+		return createLocalTopic(topic)
+	}
+
 	var params sarama.TopicDetail
 	var err error
 
@@ -56,6 +62,9 @@ func createTopic(conf *Config, topic string, parameters string) error {
 }
 
 func deleteTopic(conf *Config, topic string) error {
+	if conf.Local {
+		return deleteLocalTopic(topic)
+	}
 	admin, err := sarama.NewClusterAdmin(conf.Brokers, configureClient(conf))
 	if err != nil {
 		return err
@@ -70,35 +79,133 @@ func deleteTopic(conf *Config, topic string) error {
 
 type publisher struct {
 	producer sarama.SyncProducer
+	conf     *Config
+	txn      *transactionalProducer // created on first use
+	txnLock  sync.Mutex
 }
 
 func newPublisher(conf *Config) (Publisher, error) {
-	p, err := sarama.NewSyncProducer(conf.Brokers, configureClient(conf))
+	if conf.Local {
+		return localPublisher{}, nil
+	}
+	config := configureClient(conf)
+	config.Producer.Partitioner = newEventPartitioner
+	p, err := sarama.NewSyncProducer(conf.Brokers, config)
 	if err != nil {
 		return nil, err
 	}
-	return publisher{producer: p}, nil
+	return &publisher{producer: p, conf: conf}, nil
 }
 
-func (p publisher) Close() error {
+func (p *publisher) Close() error {
+	p.txnLock.Lock()
+	if p.txn != nil {
+		p.txn.close()
+	}
+	p.txnLock.Unlock()
 	return p.producer.Close()
 }
 
-func (p publisher) Publish(topic string, value []byte) error {
-	_, _, err := p.producer.SendMessage(&sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.ByteEncoder(value),
-	})
-	return err
+func (p *publisher) Publish(topic string, value []byte, options PublishOptions) (PublishResult, error) {
+	msg := newProducerMessage(topic, value, options)
+	partition, offset, err := p.producer.SendMessage(msg)
+	return PublishResult{Topic: topic, Partition: partition, Offset: offset}, err
+}
+
+func (p *publisher) PublishBatch(topic string, events []PublishEvent, transactional bool) ([]PublishResult, error) {
+	if len(events) == 0 {
+		return []PublishResult{}, nil
+	}
+	if transactional {
+		p.txnLock.Lock()
+		if p.txn == nil {
+			txn, err := newTransactionalProducer(p.conf)
+			if err != nil {
+				p.txnLock.Unlock()
+				return nil, err
+			}
+			p.txn = txn
+		}
+		txn := p.txn
+		p.txnLock.Unlock()
+		return txn.publish(topic, events)
+	}
+
+	msgs := make([]*sarama.ProducerMessage, len(events))
+	for i, event := range events {
+		msgs[i] = newProducerMessage(topic, event.Value, event.PublishOptions)
+	}
+	err := p.producer.SendMessages(msgs)
+	results := make([]PublishResult, len(msgs))
+	for i, msg := range msgs {
+		results[i] = PublishResult{Topic: topic, Partition: msg.Partition, Offset: msg.Offset}
+	}
+	return results, err
+}
+
+func newProducerMessage(topic string, value []byte, options PublishOptions) *sarama.ProducerMessage {
+	msg := &sarama.ProducerMessage{
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(value),
+		Headers: encodeEventHeaders(options.Headers),
+	}
+	if options.Key != nil {
+		msg.Key = sarama.ByteEncoder(options.Key)
+	}
+	if options.Partition != nil {
+		msg.Partition = *options.Partition
+		msg.Metadata = explicitPartition{}
+	}
+	return msg
+}
+
+func encodeEventHeaders(headers map[string]string) []sarama.RecordHeader {
+	if len(headers) == 0 {
+		return nil
+	}
+	result := make([]sarama.RecordHeader, 0, len(headers))
+	for k, v := range headers {
+		result = append(result, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return result
+}
+
+// metadata of a message published to an explicit partition
+type explicitPartition struct{}
+
+// eventPartitioner partitions events by key unless an explicit partition is specified
+type eventPartitioner struct {
+	hash sarama.Partitioner
+}
+
+func newEventPartitioner(topic string) sarama.Partitioner {
+	return eventPartitioner{hash: sarama.NewHashPartitioner(topic)}
+}
+
+func (p eventPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if _, ok := msg.Metadata.(explicitPartition); ok {
+		if msg.Partition < 0 || msg.Partition >= numPartitions {
+			return -1, sarama.ErrInvalidPartition
+		}
+		return msg.Partition, nil
+	}
+	return p.hash.Partition(msg, numPartitions)
+}
+
+func (p eventPartitioner) RequiresConsistency() bool {
+	return true
 }
 
 type subscriber struct {
-	topic     string
-	target    Target
-	method    string
-	ctx       context.Context
-	transform Transformer
-	ready     chan struct{}
+	topic      string
+	group      string
+	target     Target
+	method     string
+	ctx        context.Context
+	transform  Transformer
+	options    SubscribeOptions
+	deadLetter sarama.SyncProducer // producer for the dead-letter topic if any
+	ready      chan struct{}
 }
 
 func (s *subscriber) Setup(session sarama.ConsumerGroupSession) error {
@@ -112,38 +219,238 @@ func (*subscriber) Cleanup(session sarama.ConsumerGroupSession) error {
 }
 
 func (s *subscriber) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for msg := range claim.Messages() {
-		transformed, err := s.transform(s.ctx, msg.Value)
-		if err != nil {
-			logger.Error("failed to transform event from topic %s: %v", s.topic, err)
+	if s.options.BatchSize <= 1 {
+		for msg := range claim.Messages() {
+			if !s.deliver(session, []*sarama.ConsumerMessage{msg}) {
+				return nil
+			}
 		}
-		err = Tell(s.ctx, Destination{Target: s.target, Method: s.method}, time.Time{}, "", transformed)
-		if err != nil {
-			logger.Error("failed to tell target %v of event from topic %s: %v", s.target, s.topic, err)
+		return nil
+	}
+
+	// accumulate events until the batch is full, the linger time has elapsed,
+	// or no more events are available if there is no linger time
+	batch := make([]*sarama.ConsumerMessage, 0, s.options.BatchSize)
+	var linger *time.Timer
+	var lingerC <-chan time.Time // nil unless waiting for a batch to fill up
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok { // undelivered events will be consumed again
+				if linger != nil {
+					linger.Stop()
+				}
+				return nil
+			}
+			batch = append(batch, msg)
+			if len(batch) == 1 && s.options.BatchLinger > 0 {
+				linger = time.NewTimer(s.options.BatchLinger)
+				lingerC = linger.C
+			}
+			if len(batch) < s.options.BatchSize && (s.options.BatchLinger > 0 || len(claim.Messages()) > 0) {
+				continue
+			}
+		case <-lingerC:
+		}
+		if linger != nil {
+			linger.Stop()
+			linger, lingerC = nil, nil
+		}
+		if !s.deliver(session, batch) {
+			return nil
+		}
+		batch = batch[:0]
+	}
+}
+
+// delay before consuming again the events that could neither be delivered nor dead-lettered
+const redeliveryDelay = 5 * time.Second
+
+// transformEvents applies the transformer to a batch of events.
+// If the batch cannot be transformed, the events are transformed one at a time to find the events at fault
+// and the batch is transformed again without them. It returns the payload for the remaining events,
+// nil if they are all filtered out, and the errors of the events that cannot be transformed.
+func transformEvents(ctx context.Context, transform Transformer, events []Event) ([]byte, []error) {
+	failed := make([]error, len(events))
+	transformed, err := transform(ctx, events)
+	if err == nil {
+		return transformed, failed
+	}
+	if len(events) == 1 {
+		failed[0] = err
+		return nil, failed
+	}
+	remaining := make([]Event, 0, len(events))
+	for i, event := range events {
+		if _, err := transform(ctx, []Event{event}); err != nil {
+			failed[i] = err
 		} else {
+			remaining = append(remaining, event)
+		}
+	}
+	if len(remaining) == 0 {
+		return nil, failed
+	}
+	transformed, err = transform(ctx, remaining)
+	if err != nil { // the events cannot be transformed together
+		for i := range events {
+			if failed[i] == nil {
+				failed[i] = err
+			}
+		}
+		return nil, failed
+	}
+	return transformed, failed
+}
+
+// deliver a batch of events and mark them as consumed, return false to stop consuming the claim
+// so that the events that could neither be delivered nor dead-lettered are consumed again
+func (s *subscriber) deliver(session sarama.ConsumerGroupSession, batch []*sarama.ConsumerMessage) bool {
+	events := make([]Event, len(batch))
+	for i, msg := range batch {
+		events[i] = decodeEvent(msg)
+	}
+	transformed, failed := transformEvents(s.ctx, s.transform, events)
+	remaining := make([]*sarama.ConsumerMessage, 0, len(batch))
+	delivered := make([]Event, 0, len(batch))
+	for i, msg := range batch {
+		if failed[i] == nil {
+			remaining = append(remaining, msg)
+			delivered = append(delivered, events[i])
+			continue
+		}
+		eventsLog.Error("failed to transform event at offset %v of partition %v of topic %s: %v", msg.Offset, msg.Partition, s.topic, failed[i])
+		if s.deadLetter != nil && s.publishDeadLetter(msg, 0, failed[i]) != nil {
+			return s.redeliver()
+		}
+		session.MarkMessage(msg, "") // skip the event if there is no dead-letter topic
+	}
+	if transformed == nil { // events filtered out
+		for _, msg := range remaining {
 			session.MarkMessage(msg, "")
 		}
+		return true
 	}
-	return nil
+	ctx, span := startDeliver(s.ctx, s.topic, delivered)
+	attempts := 0
+	err := backoff.Retry(func() error {
+		attempts++
+		var err error
+		if s.options.ExactlyOnce {
+			requestID := eventRequestID(s.group, s.topic, remaining[0].Partition, remaining[0].Offset, remaining[len(remaining)-1].Offset)
+			err = tellWithID(ctx, Destination{Target: s.target, Method: s.method}, requestID, transformed)
+		} else {
+			err = Tell(ctx, Destination{Target: s.target, Method: s.method}, time.Time{}, "", transformed)
+		}
+		if err != nil && s.ctx.Err() != nil {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), uint64(s.options.MaxRedelivery)), s.ctx))
+	endSpan(span, err)
+	if err != nil {
+		if s.ctx.Err() != nil {
+			return false
+		}
+		eventsLog.Error("failed to tell target %v of event from topic %s after %v attempts: %v", s.target, s.topic, attempts, err)
+		if s.deadLetter == nil {
+			return s.redeliver()
+		}
+		for _, msg := range remaining {
+			if s.publishDeadLetter(msg, attempts, err) != nil {
+				return s.redeliver()
+			}
+			session.MarkMessage(msg, "")
+		}
+	} else {
+		for _, msg := range remaining {
+			session.MarkMessage(msg, "")
+		}
+	}
+	return true
+}
+
+// redeliver waits before returning false so that the consumption of the claim restarts from the last marked event
+func (s *subscriber) redeliver() bool {
+	select {
+	case <-time.After(redeliveryDelay):
+	case <-s.ctx.Done():
+	}
+	return false
+}
+
+// decodeEvent converts a consumed message to an event
+func decodeEvent(msg *sarama.ConsumerMessage) Event {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	return Event{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset, Key: msg.Key, Value: msg.Value, Headers: headers}
+}
+
+// publishDeadLetter publishes an undeliverable event to the dead-letter topic
+// preserving the headers of the event and adding headers describing the failure
+func (s *subscriber) publishDeadLetter(msg *sarama.ConsumerMessage, attempts int, cause error) error {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+5)
+	for _, h := range msg.Headers {
+		headers = append(headers, *h)
+	}
+	headers = append(headers, deadLetterHeaders(msg.Topic, msg.Partition, msg.Offset, attempts, cause)...)
+	_, _, err := s.deadLetter.SendMessage(&sarama.ProducerMessage{
+		Topic:   s.options.DeadLetterTopic,
+		Key:     sarama.ByteEncoder(msg.Key),
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	})
+	if err != nil {
+		eventsLog.Error("failed to publish event from topic %s to dead-letter topic %s: %v", s.topic, s.options.DeadLetterTopic, err)
+	}
+	return err
 }
 
-func subscribe(ctx context.Context, conf *Config, topic, group string, oldest bool, dest Destination, transform Transformer) (<-chan struct{}, error) {
+// headers describing why an event was published to a dead-letter topic
+func deadLetterHeaders(topic string, partition int32, offset int64, attempts int, cause error) []sarama.RecordHeader {
+	return []sarama.RecordHeader{
+		{Key: []byte("DeadLetterError"), Value: []byte(cause.Error())},
+		{Key: []byte("DeadLetterTopic"), Value: []byte(topic)},
+		{Key: []byte("DeadLetterPartition"), Value: []byte(strconv.Itoa(int(partition)))},
+		{Key: []byte("DeadLetterOffset"), Value: []byte(strconv.FormatInt(offset, 10))},
+		{Key: []byte("DeadLetterAttempts"), Value: []byte(strconv.Itoa(attempts))},
+	}
+}
+
+func subscribe(ctx context.Context, conf *Config, topic, group string, options SubscribeOptions, dest Destination, transform Transformer) (<-chan struct{}, error) {
+	if conf.Local {
+		return subscribeLocal(ctx, topic, group, options, dest, transform)
+	}
 	config := configureClient(conf)
-	if oldest {
+	if options.OffsetOldest {
 		config.Consumer.Offsets.Initial = sarama.OffsetOldest
 	}
+	if config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		config.Consumer.IsolationLevel = sarama.ReadCommitted // skip events of aborted transactions
+	}
 	cg, err := sarama.NewConsumerGroup(conf.Brokers, group, config)
 	if err != nil {
 		return nil, err
 	}
 
+	var deadLetter sarama.SyncProducer
+	if options.DeadLetterTopic != "" {
+		deadLetter, err = sarama.NewSyncProducer(conf.Brokers, configureClient(conf))
+		if err != nil {
+			cg.Close()
+			return nil, err
+		}
+	}
+
 	closed := make(chan struct{})
 	ready := make(chan struct{})
 
 	go func() {
 		for {
-			if err1 := cg.Consume(ctx, []string{topic}, &subscriber{topic: topic, target: dest.Target, method: dest.Method, ctx: ctx, transform: transform, ready: ready}); err1 != nil {
-				logger.Error("subscriber error: %v", err1)
+			if err1 := cg.Consume(ctx, []string{topic}, &subscriber{topic: topic, group: group, target: dest.Target, method: dest.Method, ctx: ctx, transform: transform, options: options, deadLetter: deadLetter, ready: ready}); err1 != nil {
+				eventsLog.Error("subscriber error: %v", err1)
 				break
 			}
 			if ctx.Err() != nil {
@@ -151,6 +458,9 @@ func subscribe(ctx context.Context, conf *Config, topic, group string, oldest bo
 			}
 		}
 		cg.Close()
+		if deadLetter != nil {
+			deadLetter.Close()
+		}
 		close(closed)
 	}()
 
@@ -0,0 +1,134 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpc
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// W3C trace context propagator
+var traceContext = propagation.TraceContext{}
+
+// tracer returns the tracer of the rpc layer from the global tracer provider
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/IBM/kar/core/pkg/rpc")
+}
+
+// InjectTrace returns the W3C traceparent and tracestate of the span in the context if any
+func InjectTrace(ctx context.Context) (traceParent, traceState string) {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier["traceparent"], carrier["tracestate"]
+}
+
+// ExtractTrace returns a context with the remote span described by the W3C traceparent and tracestate
+func ExtractTrace(ctx context.Context, traceParent, traceState string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return traceContext.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent, "tracestate": traceState})
+}
+
+// extract the trace context of a request
+func requestTrace(ctx context.Context, m Request) context.Context {
+	switch v := m.(type) {
+	case CallRequest:
+		return ExtractTrace(ctx, v.TraceParent, v.TraceState)
+	case TellRequest:
+		return ExtractTrace(ctx, v.TraceParent, v.TraceState)
+	}
+	return ctx
+}
+
+// startSend starts a producer span for a request and records the span in the request
+func startSend(ctx context.Context, msg Message) (Message, trace.Span) {
+	var r Request
+	switch m := msg.(type) {
+	case CallRequest:
+		if m.TraceParent != "" { // resending
+			return msg, nil
+		}
+		r = m
+	case TellRequest:
+		if m.TraceParent != "" {
+			return msg, nil
+		}
+		r = m
+	default:
+		return msg, nil
+	}
+	ctx, span := tracer().Start(ctx, "kar.send "+r.method(), trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(requestAttributes(r)...))
+	traceParent, traceState := InjectTrace(ctx)
+	switch m := msg.(type) {
+	case CallRequest:
+		m.TraceParent, m.TraceState = traceParent, traceState
+		msg = m
+	case TellRequest:
+		m.TraceParent, m.TraceState = traceParent, traceState
+		msg = m
+	}
+	return msg, span
+}
+
+// endSpan ends a span recording the error if any
+func endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startSpan starts a span for the processing of a request as a child of the span that sent the request
+func startSpan(ctx context.Context, name string, m Request) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name+" "+m.method(), trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(requestAttributes(m)...))
+}
+
+// attributes of a request span
+func requestAttributes(m Request) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{attribute.String("kar.request_id", m.requestID())}
+	switch t := m.target().(type) {
+	case Session:
+		attributes = append(attributes, attribute.String("kar.service", t.Name), attribute.String("kar.session", t.ID))
+	case Service:
+		attributes = append(attributes, attribute.String("kar.service", t.Name))
+	case Node:
+		attributes = append(attributes, attribute.String("kar.node", t.ID))
+	}
+	return attributes
+}
+
+// startDeliver starts a span for the delivery of a batch of events continuing the trace of the first event if any;
+// the trace context is read from the W3C headers or from the CloudEvents distributed tracing extension
+func startDeliver(ctx context.Context, topic string, batch []Event) (context.Context, trace.Span) {
+	headers := batch[0].Headers
+	traceParent, traceState := headers["traceparent"], headers["tracestate"]
+	if traceParent == "" {
+		traceParent, traceState = headers["ce_traceparent"], headers["ce_tracestate"]
+	}
+	return tracer().Start(ExtractTrace(ctx, traceParent, traceState), "kar.deliver "+topic, trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("kar.topic", topic), attribute.Int("kar.events", len(batch))))
+}
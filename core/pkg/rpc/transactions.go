@@ -0,0 +1,303 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/uuid"
+)
+
+// A transactionalProducer publishes batches of events atomically using Kafka transactions.
+// Sarama does not implement the producer side of transactions, so the transactionalProducer
+// sends the requests of the transaction protocol to the brokers directly.
+// Transactions are serialized; each transaction publishes at most one batch per partition.
+type transactionalProducer struct {
+	lock        sync.Mutex
+	client      sarama.Client
+	id          string                     // transactional id
+	producerID  int64                      // producer id assigned by the transaction coordinator
+	epoch       int16                      // producer epoch assigned by the transaction coordinator
+	sequences   map[string]map[int32]int32 // next sequence number for each topic and partition
+	initialized bool                       // false if the producer id must be (re)initialized
+}
+
+func newTransactionalProducer(conf *Config) (*transactionalProducer, error) {
+	config := configureClient(conf)
+	if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return nil, errors.New("transactions require Kafka version 0.11.0.0 or above")
+	}
+	client, err := sarama.NewClient(conf.Brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	return &transactionalProducer{client: client, id: "kar-txn-" + uuid.New().String()}, nil
+}
+
+func (p *transactionalProducer) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err := p.client.Close(); err != nil {
+		rpcLog.Warning("failed to close transactional producer: %v", err)
+	}
+}
+
+// retryTxn retries an operation failing with a transient coordinator error
+func retryTxn(op func() error) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 50 * time.Millisecond
+	b.MaxElapsedTime = 30 * time.Second
+	return backoff.Retry(func() error {
+		err := op()
+		switch err {
+		case nil:
+			return nil
+		case sarama.ErrConsumerCoordinatorNotAvailable, sarama.ErrNotCoordinatorForConsumer,
+			sarama.ErrOffsetsLoadInProgress, sarama.ErrConcurrentTransactions:
+			return err
+		default:
+			return backoff.Permanent(err)
+		}
+	}, b)
+}
+
+// coordinator returns the transaction coordinator for the transactional id
+func (p *transactionalProducer) coordinator() (*sarama.Broker, error) {
+	var coordinator *sarama.Broker
+	err := retryTxn(func() error {
+		controller, err := p.client.Controller()
+		if err != nil {
+			return err
+		}
+		response, err := controller.FindCoordinator(&sarama.FindCoordinatorRequest{
+			Version:         1,
+			CoordinatorKey:  p.id,
+			CoordinatorType: sarama.CoordinatorTransaction,
+		})
+		if err != nil {
+			return err
+		}
+		if response.Err != sarama.ErrNoError {
+			return response.Err
+		}
+		coordinator, err = p.client.Broker(response.Coordinator.ID())
+		if err == sarama.ErrBrokerNotFound {
+			coordinator = response.Coordinator
+			err = coordinator.Open(p.client.Config())
+			if err == sarama.ErrAlreadyConnected {
+				err = nil
+			}
+		}
+		return err
+	})
+	return coordinator, err
+}
+
+// initialize obtains a new producer id or epoch, aborting any pending transaction
+func (p *transactionalProducer) initialize(coordinator *sarama.Broker) error {
+	return retryTxn(func() error {
+		response, err := coordinator.InitProducerID(&sarama.InitProducerIDRequest{
+			TransactionalID:    &p.id,
+			TransactionTimeout: time.Minute,
+		})
+		if err != nil {
+			return err
+		}
+		if response.Err != sarama.ErrNoError {
+			return response.Err
+		}
+		p.producerID = response.ProducerID
+		p.epoch = response.ProducerEpoch
+		p.sequences = map[string]map[int32]int32{}
+		p.initialized = true
+		return nil
+	})
+}
+
+// end commits or aborts the current transaction
+func (p *transactionalProducer) end(coordinator *sarama.Broker, commit bool) error {
+	return retryTxn(func() error {
+		response, err := coordinator.EndTxn(&sarama.EndTxnRequest{
+			TransactionalID:   p.id,
+			ProducerID:        p.producerID,
+			ProducerEpoch:     p.epoch,
+			TransactionResult: commit,
+		})
+		if err != nil {
+			return err
+		}
+		if response.Err != sarama.ErrNoError {
+			return response.Err
+		}
+		return nil
+	})
+}
+
+// publish publishes a batch of events in a transaction
+func (p *transactionalProducer) publish(topic string, events []PublishEvent) ([]PublishResult, error) {
+	batches, indices, err := p.batch(topic, events)
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	coordinator, err := p.coordinator()
+	if err != nil {
+		return nil, err
+	}
+	if !p.initialized {
+		if err := p.initialize(coordinator); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]PublishResult, len(events))
+	err = p.produce(coordinator, topic, batches, indices, results)
+	if err == nil {
+		err = p.end(coordinator, true)
+	} else if abortErr := p.end(coordinator, false); abortErr != nil {
+		rpcLog.Warning("failed to abort transaction %s: %v", p.id, abortErr)
+	}
+	if err != nil {
+		// the sequence numbers are no longer reliable, a new epoch will abort the transaction if still pending
+		p.initialized = false
+		return nil, err
+	}
+	return results, nil
+}
+
+// batch partitions the events and returns one record batch per partition
+// together with the indices of the events in each batch
+func (p *transactionalProducer) batch(topic string, events []PublishEvent) (map[int32]*sarama.RecordBatch, map[int32][]int, error) {
+	partitions, err := p.client.Partitions(topic)
+	if err != nil {
+		return nil, nil, err
+	}
+	partitioner := newEventPartitioner(topic)
+	timestamp := time.Now().Truncate(time.Millisecond)
+	batches := map[int32]*sarama.RecordBatch{}
+	indices := map[int32][]int{} // indices of the events in each batch
+	for i, event := range events {
+		partition, err := partitioner.Partition(newProducerMessage(topic, event.Value, event.PublishOptions), int32(len(partitions)))
+		if err != nil {
+			return nil, nil, err
+		}
+		batch := batches[partition]
+		if batch == nil {
+			batch = &sarama.RecordBatch{
+				Version:         2,
+				FirstTimestamp:  timestamp,
+				MaxTimestamp:    timestamp,
+				IsTransactional: true,
+			}
+			batches[partition] = batch
+		}
+		record := &sarama.Record{Key: event.Key, Value: event.Value, OffsetDelta: int64(len(batch.Records))}
+		for k, v := range event.Headers {
+			record.Headers = append(record.Headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+		}
+		batch.Records = append(batch.Records, record)
+		batch.LastOffsetDelta = int32(len(batch.Records) - 1)
+		indices[partition] = append(indices[partition], i)
+	}
+	return batches, indices, nil
+}
+
+// produce adds the partitions to the transaction and produces the record batches
+func (p *transactionalProducer) produce(coordinator *sarama.Broker, topic string, batches map[int32]*sarama.RecordBatch, indices map[int32][]int, results []PublishResult) error {
+	// add the partitions to the transaction
+	topicPartitions := make([]int32, 0, len(batches))
+	for partition := range batches {
+		topicPartitions = append(topicPartitions, partition)
+	}
+	err := retryTxn(func() error {
+		response, err := coordinator.AddPartitionsToTxn(&sarama.AddPartitionsToTxnRequest{
+			TransactionalID: p.id,
+			ProducerID:      p.producerID,
+			ProducerEpoch:   p.epoch,
+			TopicPartitions: map[string][]int32{topic: topicPartitions},
+		})
+		if err != nil {
+			return err
+		}
+		for _, partitionErrors := range response.Errors {
+			for _, partitionError := range partitionErrors {
+				if partitionError.Err != sarama.ErrNoError {
+					return partitionError.Err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// group the batches by partition leader
+	if p.sequences[topic] == nil {
+		p.sequences[topic] = map[int32]int32{}
+	}
+	requests := map[*sarama.Broker]*sarama.ProduceRequest{}
+	leaderPartitions := map[*sarama.Broker][]int32{}
+	for partition, batch := range batches {
+		leader, err := p.client.Leader(topic, partition)
+		if err != nil {
+			return err
+		}
+		if requests[leader] == nil {
+			requests[leader] = &sarama.ProduceRequest{
+				TransactionalID: &p.id,
+				RequiredAcks:    sarama.WaitForAll,
+				Timeout:         int32(p.client.Config().Producer.Timeout / time.Millisecond),
+				Version:         3,
+			}
+		}
+		batch.ProducerID = p.producerID
+		batch.ProducerEpoch = p.epoch
+		batch.FirstSequence = p.sequences[topic][partition]
+		p.sequences[topic][partition] += int32(len(batch.Records))
+		requests[leader].AddBatch(topic, partition, batch)
+		leaderPartitions[leader] = append(leaderPartitions[leader], partition)
+	}
+
+	// produce the batches
+	for leader, request := range requests {
+		response, err := leader.Produce(request)
+		if err != nil {
+			return err
+		}
+		for _, partition := range leaderPartitions[leader] {
+			block := response.GetBlock(topic, partition)
+			if block == nil {
+				return sarama.ErrIncompleteResponse
+			}
+			if block.Err != sarama.ErrNoError {
+				return block.Err
+			}
+			for j, i := range indices[partition] {
+				results[i] = PublishResult{Topic: topic, Partition: partition, Offset: block.Offset + int64(j)}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpc
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+const txnTopic = "txn-topic"
+
+// mockTxnBroker returns a single broker cluster acting as the transaction coordinator
+// and as the leader of the two partitions of txnTopic
+func mockTxnBroker(t *testing.T, handlers map[string]sarama.MockResponse) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	responses := map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader(txnTopic, 0, broker.BrokerID()).
+			SetLeader(txnTopic, 1, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockWrapper(&sarama.FindCoordinatorResponse{
+			Version:     1,
+			Coordinator: sarama.NewBroker(broker.Addr()),
+		}),
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{ProducerID: 1000, ProducerEpoch: 1}),
+		"AddPartitionsToTxnRequest": sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{
+			Errors: map[string][]*sarama.PartitionError{txnTopic: {}},
+		}),
+		"ProduceRequest": sarama.NewMockWrapper(produceResponse(sarama.ErrNoError)),
+		"EndTxnRequest":  sarama.NewMockWrapper(&sarama.EndTxnResponse{}),
+	}
+	for k, v := range handlers {
+		responses[k] = v
+	}
+	broker.SetHandlerByMap(responses)
+	return broker
+}
+
+// produceResponse returns a response assigning offset 10 to partition 0 and offset 20 to partition 1
+func produceResponse(err sarama.KError) *sarama.ProduceResponse {
+	response := &sarama.ProduceResponse{Version: 3}
+	response.AddTopicPartition(txnTopic, 0, err)
+	response.AddTopicPartition(txnTopic, 1, err)
+	response.Blocks[txnTopic][0].Offset = 10
+	response.Blocks[txnTopic][1].Offset = 20
+	return response
+}
+
+func newMockTxnProducer(t *testing.T, broker *sarama.MockBroker) *transactionalProducer {
+	p, err := newTransactionalProducer(&Config{Version: "0.11.0.0", Brokers: []string{broker.Addr()}})
+	if err != nil {
+		t.Fatalf("failed to create transactional producer: %v", err)
+	}
+	return p
+}
+
+func partitionOf(p int32) *int32 {
+	return &p
+}
+
+// txnRequests returns the transaction requests received by the broker
+func txnRequests(broker *sarama.MockBroker) []interface{} {
+	var requests []interface{}
+	for _, rr := range broker.History() {
+		switch rr.Request.(type) {
+		case *sarama.MetadataRequest, *sarama.FindCoordinatorRequest:
+		default:
+			requests = append(requests, rr.Request)
+		}
+	}
+	return requests
+}
+
+func TestTransactionCommit(t *testing.T) {
+	broker := mockTxnBroker(t, nil)
+	defer broker.Close()
+	p := newMockTxnProducer(t, broker)
+	defer p.close()
+
+	events := []PublishEvent{
+		{Value: []byte("a"), PublishOptions: PublishOptions{Partition: partitionOf(0)}},
+		{Value: []byte("b"), PublishOptions: PublishOptions{Partition: partitionOf(1)}},
+		{Value: []byte("c"), PublishOptions: PublishOptions{Partition: partitionOf(0), Headers: map[string]string{"h": "v"}}},
+	}
+	results, err := p.publish(txnTopic, events)
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	expected := []PublishResult{
+		{Topic: txnTopic, Partition: 0, Offset: 10},
+		{Topic: txnTopic, Partition: 1, Offset: 20},
+		{Topic: txnTopic, Partition: 0, Offset: 11},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("publish returned %v, want %v", results, expected)
+	}
+
+	received := txnRequests(broker)
+	if len(received) != 4 {
+		t.Fatalf("broker received %v transaction requests, want 4: %#v", len(received), received)
+	}
+	if r, ok := received[0].(*sarama.InitProducerIDRequest); !ok || r.TransactionalID == nil || *r.TransactionalID != p.id {
+		t.Errorf("first request is %#v, want InitProducerIDRequest for %v", received[0], p.id)
+	}
+	if r, ok := received[1].(*sarama.AddPartitionsToTxnRequest); !ok {
+		t.Errorf("second request is %#v, want AddPartitionsToTxnRequest", received[1])
+	} else {
+		partitions := r.TopicPartitions[txnTopic]
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+		if r.ProducerID != 1000 || r.ProducerEpoch != 1 || !reflect.DeepEqual(partitions, []int32{0, 1}) {
+			t.Errorf("AddPartitionsToTxnRequest is %#v, want partitions 0 and 1 for producer 1000 epoch 1", r)
+		}
+	}
+	if r, ok := received[2].(*sarama.ProduceRequest); !ok || r.TransactionalID == nil || *r.TransactionalID != p.id || r.RequiredAcks != sarama.WaitForAll {
+		t.Errorf("third request is %#v, want transactional ProduceRequest", received[2])
+	}
+	if r, ok := received[3].(*sarama.EndTxnRequest); !ok || !r.TransactionResult {
+		t.Errorf("fourth request is %#v, want commit", received[3])
+	}
+
+	// sequence numbers continue from one transaction to the next
+	if seq := p.sequences[txnTopic]; seq[0] != 2 || seq[1] != 1 {
+		t.Errorf("sequence numbers are %v, want 2 for partition 0 and 1 for partition 1", seq)
+	}
+	if _, err := p.publish(txnTopic, events[:1]); err != nil {
+		t.Fatalf("second publish failed: %v", err)
+	}
+	if seq := p.sequences[txnTopic]; seq[0] != 3 || seq[1] != 1 {
+		t.Errorf("sequence numbers are %v, want 3 for partition 0 and 1 for partition 1", seq)
+	}
+	inits := 0
+	for _, r := range txnRequests(broker) {
+		if _, ok := r.(*sarama.InitProducerIDRequest); ok {
+			inits++
+		}
+	}
+	if inits != 1 {
+		t.Errorf("producer id initialized %v times, want once", inits)
+	}
+}
+
+func TestTransactionAbort(t *testing.T) {
+	broker := mockTxnBroker(t, map[string]sarama.MockResponse{
+		"ProduceRequest": sarama.NewMockSequence(produceResponse(sarama.ErrOutOfOrderSequenceNumber), produceResponse(sarama.ErrNoError)),
+		"InitProducerIDRequest": sarama.NewMockSequence(
+			&sarama.InitProducerIDResponse{ProducerID: 1000, ProducerEpoch: 1},
+			&sarama.InitProducerIDResponse{ProducerID: 1000, ProducerEpoch: 2}),
+	})
+	defer broker.Close()
+	p := newMockTxnProducer(t, broker)
+	defer p.close()
+
+	events := []PublishEvent{{Value: []byte("a"), PublishOptions: PublishOptions{Partition: partitionOf(0)}}}
+	if _, err := p.publish(txnTopic, events); err != sarama.ErrOutOfOrderSequenceNumber {
+		t.Fatalf("publish returned %v, want %v", err, sarama.ErrOutOfOrderSequenceNumber)
+	}
+	received := txnRequests(broker)
+	if r, ok := received[len(received)-1].(*sarama.EndTxnRequest); !ok || r.TransactionResult {
+		t.Errorf("last request is %#v, want abort", received[len(received)-1])
+	}
+	if p.initialized {
+		t.Errorf("producer still initialized after failed transaction")
+	}
+
+	// the next transaction bumps the epoch and resets the sequence numbers
+	results, err := p.publish(txnTopic, events)
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	if results[0].Offset != 10 {
+		t.Errorf("publish returned %v, want offset 10", results)
+	}
+	if p.epoch != 2 || p.sequences[txnTopic][0] != 1 {
+		t.Errorf("epoch is %v and sequence number is %v, want 2 and 1", p.epoch, p.sequences[txnTopic][0])
+	}
+}
+
+func TestTransactionRetry(t *testing.T) {
+	broker := mockTxnBroker(t, map[string]sarama.MockResponse{
+		"AddPartitionsToTxnRequest": sarama.NewMockSequence(
+			&sarama.AddPartitionsToTxnResponse{Errors: map[string][]*sarama.PartitionError{
+				txnTopic: {{Partition: 0, Err: sarama.ErrConcurrentTransactions}},
+			}},
+			&sarama.AddPartitionsToTxnResponse{Errors: map[string][]*sarama.PartitionError{txnTopic: {}}}),
+		"EndTxnRequest": sarama.NewMockSequence(
+			&sarama.EndTxnResponse{Err: sarama.ErrConsumerCoordinatorNotAvailable},
+			&sarama.EndTxnResponse{}),
+	})
+	defer broker.Close()
+	p := newMockTxnProducer(t, broker)
+	defer p.close()
+
+	events := []PublishEvent{{Value: []byte("a"), PublishOptions: PublishOptions{Partition: partitionOf(0)}}}
+	if _, err := p.publish(txnTopic, events); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	counts := map[string]int{}
+	for _, r := range txnRequests(broker) {
+		counts[reflect.TypeOf(r).Elem().Name()]++
+	}
+	if counts["AddPartitionsToTxnRequest"] != 2 || counts["EndTxnRequest"] != 2 {
+		t.Errorf("broker received %v, want two AddPartitionsToTxnRequest and two EndTxnRequest", counts)
+	}
+}
+
+func TestTransactionInvalidPartition(t *testing.T) {
+	broker := mockTxnBroker(t, nil)
+	defer broker.Close()
+	p := newMockTxnProducer(t, broker)
+	defer p.close()
+
+	events := []PublishEvent{
+		{Value: []byte("a"), PublishOptions: PublishOptions{Partition: partitionOf(0)}},
+		{Value: []byte("b"), PublishOptions: PublishOptions{Partition: partitionOf(2)}},
+	}
+	if _, err := p.publish(txnTopic, events); err != sarama.ErrInvalidPartition {
+		t.Fatalf("publish returned %v, want %v", err, sarama.ErrInvalidPartition)
+	}
+	if received := txnRequests(broker); len(received) != 0 {
+		t.Errorf("broker received transaction requests %#v, want none", received)
+	}
+}
+
+func TestTransactionPartitionByKey(t *testing.T) {
+	broker := mockTxnBroker(t, nil)
+	defer broker.Close()
+	p := newMockTxnProducer(t, broker)
+	defer p.close()
+
+	// events with the same key are published to the same partition as without transactions
+	events := []PublishEvent{
+		{Value: []byte("a"), PublishOptions: PublishOptions{Key: []byte("customer-42")}},
+		{Value: []byte("b"), PublishOptions: PublishOptions{Key: []byte("customer-42")}},
+	}
+	results, err := p.publish(txnTopic, events)
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	expected, _ := newEventPartitioner(txnTopic).Partition(newProducerMessage(txnTopic, nil, events[0].PublishOptions), 2)
+	for _, result := range results {
+		if result.Partition != expected {
+			t.Errorf("event published to partition %v, want %v", result.Partition, expected)
+		}
+	}
+	if results[1].Offset != results[0].Offset+1 {
+		t.Errorf("events published at offsets %v and %v, want consecutive offsets", results[0].Offset, results[1].Offset)
+	}
+}
@@ -19,8 +19,8 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"time"
 
-	"github.com/IBM/kar/core/pkg/logger"
 	"github.com/Shopify/sarama"
 )
 
@@ -32,13 +32,15 @@ type handler struct {
 
 // Setup consumer group session, assumes W mutex is held on entry
 func (h *handler) Setup(session sarama.ConsumerGroupSession) error {
+	rebalancesCounter.Inc()
+
 	if len(session.Claims()[appTopic]) == 0 { // in recovery, but not leader, nothing to do
-		logger.Info("waiting for recovery, generation %d, claims %v", session.GenerationID(), session.Claims()[appTopic])
+		rpcLog.Info("waiting for recovery, generation %d, claims %v", session.GenerationID(), session.Claims()[appTopic])
 		return nil // keep mutex
 	}
 
 	if recovery != nil { // recovery leader
-		logger.Info("leading recovery, generation %d, claims %v", session.GenerationID(), session.Claims()[appTopic])
+		rpcLog.Info("leading recovery, generation %d, claims %v", session.GenerationID(), session.Claims()[appTopic])
 
 		// initialize map
 		h.channels = map[int32]chan (<-chan *sarama.ConsumerMessage){}
@@ -52,7 +54,7 @@ func (h *handler) Setup(session sarama.ConsumerGroupSession) error {
 		return nil // keep mutex
 	}
 	// not in recovery, each node has been assigned one partition
-	logger.Info("processing messages, generation %d, claims %v", session.GenerationID(), session.Claims()[appTopic])
+	rpcLog.Info("processing messages, generation %d, claims %v", session.GenerationID(), session.Claims()[appTopic])
 	self.Partition = session.Claims()[appTopic][0]
 
 	// update service2nodes and node2partitions
@@ -69,21 +71,23 @@ func (h *handler) Setup(session sarama.ConsumerGroupSession) error {
 	// signal and release mutex on successful setup to resume producer activity
 	close(tick)
 	tick = make(chan struct{})
+	setRebalancing(false)
 	mu.Unlock()
 	return nil
 }
 
 // Cleanup consumer group session, assumes W mutex is held on entry iff in recovery
 func (*handler) Cleanup(session sarama.ConsumerGroupSession) error {
-	logger.Info("completed generation %d", session.GenerationID())
+	rpcLog.Info("completed generation %d", session.GenerationID())
 
 	// marshal latest info (to share our assigned partition with others if decided)
 	consumerClient.Config().Consumer.Group.Member.UserData, _ = json.Marshal(self)
 
 	if recovery == nil && len(session.Claims()[appTopic]) > 0 { // not in recovery
 		mu.Lock() // acquire W mutex to prevent producer from sending
+		setRebalancing(true)
 	}
-	logger.Info("finish cleanup %v", session.GenerationID())
+	rpcLog.Info("finish cleanup %v", session.GenerationID())
 	return nil
 }
 
@@ -94,7 +98,7 @@ func (h *handler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama
 		return h.recover(session, claim)
 	}
 
-	logger.Info("begin claim %v %v", session.GenerationID(), claim.Partition())
+	rpcLog.Info("begin claim %v %v", session.GenerationID(), claim.Partition())
 
 	// not in recovery (nodes other than the leader are not assigned partitions during recovery)
 	for msg := range claim.Messages() {
@@ -109,7 +113,7 @@ func (h *handler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama
 		}
 		head = msg.Offset + 1
 	}
-	logger.Info("finish claim %v %v", session.GenerationID(), claim.Partition())
+	rpcLog.Info("finish claim %v %v", session.GenerationID(), claim.Partition())
 	return nil
 }
 
@@ -127,10 +131,13 @@ func (h *handler) recover(session sarama.ConsumerGroupSession, claim sarama.Cons
 		return nil
 	}
 
-	logger.Info("enter recover %v %v", session.GenerationID(), claim.Partition())
+	rpcLog.Info("enter recover %v %v", session.GenerationID(), claim.Partition())
 
 	defer close(h.finished)
 
+	start := time.Now()
+	defer func() { recoveryDurationHistogram.Observe(time.Since(start).Seconds()) }()
+
 	orphans := []Message{}                  // all the messages in dead partitions in order
 	orphans0 := []Message{}                 // all the requests in partition 0 in order
 	calls := map[string][]string{}          // map caller id to callee ids for blocking calls
@@ -231,7 +238,7 @@ func (h *handler) recover(session sarama.ConsumerGroupSession, claim sarama.Cons
 
 	orphans = append(orphans, orphans0...)
 
-	logger.Info("recover done reading %v %v", session.GenerationID(), claim.Partition())
+	rpcLog.Info("recover done reading %v %v", session.GenerationID(), claim.Partition())
 
 	// resend messages targetting dead nodes
 	for _, msg := range orphans {
@@ -272,7 +279,7 @@ func (h *handler) recover(session sarama.ConsumerGroupSession, claim sarama.Cons
 				err := resend(session.Context(), v, ok0 && s0 >= max[k])
 				if err != nil {
 					if err != session.Context().Err() {
-						logger.Error("resend error during recovery: %v", err)
+						rpcLog.Error("resend error during recovery: %v", err)
 					}
 					return err
 				}
@@ -283,7 +290,7 @@ func (h *handler) recover(session sarama.ConsumerGroupSession, claim sarama.Cons
 					err := respond(session.Context(), Done{RequestID: k, Deadline: v.deadline()})
 					if err != nil {
 						if err != session.Context().Err() {
-							logger.Error("resend error during recovery: %v", err)
+							rpcLog.Error("resend error during recovery: %v", err)
 						}
 						return err
 					}
@@ -297,7 +304,7 @@ func (h *handler) recover(session sarama.ConsumerGroupSession, claim sarama.Cons
 	// remember partition 0 offset to avoid an infinite recovery loop
 	offset0 = max0
 
-	logger.Info("exit recover %v %v", session.GenerationID(), claim.Partition())
+	rpcLog.Info("exit recover %v %v", session.GenerationID(), claim.Partition())
 
 	return nil
 }
@@ -0,0 +1,221 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// number of hash slots in a Redis Cluster
+const numSlots = 16384
+
+// crc16 implements the CRC16-CCITT (XMODEM) checksum used by Redis Cluster
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// slot returns the hash slot of a key, only hashing the hash tag of the key if any
+func slot(key string) int {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return int(crc16(key) % numSlots)
+}
+
+// cluster tracks the topology of a Redis Cluster and maintains a connection pool for each master
+type cluster struct {
+	lock      sync.RWMutex
+	seeds     []string                         // the addresses of the seed nodes
+	slots     [numSlots]string                 // the address of the master serving each slot
+	pools     map[string]*redis.Pool           // the connection pools by address
+	newPool   func(address string) *redis.Pool // the function to create a connection pool
+	refreshes chan struct{}                    // the requests to refresh the topology
+	closed    chan struct{}                    // channel closed when closing the cluster
+}
+
+func newCluster(seeds []string, newPool func(address string) *redis.Pool) *cluster {
+	c := &cluster{
+		seeds:     seeds,
+		pools:     map[string]*redis.Pool{},
+		newPool:   newPool,
+		refreshes: make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case <-c.closed:
+				return
+			case <-c.refreshes:
+				if err := c.refresh(); err != nil {
+					storeLog.Warning("failed to refresh Redis Cluster topology: %v", err)
+				}
+			}
+		}
+	}()
+	return c
+}
+
+// pool returns the connection pool for an address
+func (c *cluster) pool(address string) *redis.Pool {
+	c.lock.RLock()
+	p := c.pools[address]
+	c.lock.RUnlock()
+	if p != nil {
+		return p
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if p = c.pools[address]; p == nil {
+		p = c.newPool(address)
+		c.pools[address] = p
+	}
+	return p
+}
+
+// address returns the address of the master serving the key
+func (c *cluster) address(key string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if address := c.slots[slot(key)]; address != "" {
+		return address
+	}
+	return c.seeds[0] // slot not covered, the node will redirect or report the failure
+}
+
+// masters returns the addresses of the masters
+func (c *cluster) masters() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	seen := map[string]bool{}
+	addresses := []string{}
+	for _, address := range c.slots {
+		if address != "" && !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// moved records the new master of a slot and requests a refresh of the topology
+func (c *cluster) moved(slot int, address string) {
+	c.lock.Lock()
+	c.slots[slot] = address
+	c.lock.Unlock()
+	c.requestRefresh()
+}
+
+// requestRefresh asynchronously refreshes the topology
+func (c *cluster) requestRefresh() {
+	select {
+	case c.refreshes <- struct{}{}:
+	default: // a refresh is already pending
+	}
+}
+
+// refresh fetches the slot assignment from the first reachable node
+func (c *cluster) refresh() error {
+	c.lock.RLock()
+	addresses := append([]string{}, c.seeds...)
+	for address := range c.pools {
+		addresses = append(addresses, address)
+	}
+	c.lock.RUnlock()
+	err := errors.New("no Redis Cluster node")
+	for _, address := range addresses {
+		var slots [numSlots]string
+		if slots, err = c.fetchSlots(address); err == nil {
+			c.lock.Lock()
+			c.slots = slots
+			c.lock.Unlock()
+			return nil
+		}
+	}
+	return err
+}
+
+// fetchSlots obtains the slot assignment from a node using CLUSTER SLOTS
+func (c *cluster) fetchSlots(address string) (slots [numSlots]string, err error) {
+	conn := c.pool(address).Get()
+	defer conn.Close()
+	entries, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return
+	}
+	host, _, _ := net.SplitHostPort(address)
+	for _, entry := range entries {
+		// each entry is: start slot, end slot, master (host, port, id...), replicas...
+		fields, err := redis.Values(entry, nil)
+		if err != nil || len(fields) < 3 {
+			return slots, fmt.Errorf("invalid CLUSTER SLOTS reply from %s", address)
+		}
+		start, err1 := redis.Int(fields[0], nil)
+		end, err2 := redis.Int(fields[1], nil)
+		master, err3 := redis.Values(fields[2], nil)
+		if err1 != nil || err2 != nil || err3 != nil || len(master) < 2 || start < 0 || end >= numSlots {
+			return slots, fmt.Errorf("invalid CLUSTER SLOTS reply from %s", address)
+		}
+		masterHost, _ := redis.String(master[0], nil)
+		masterPort, err := redis.Int(master[1], nil)
+		if err != nil {
+			return slots, fmt.Errorf("invalid CLUSTER SLOTS reply from %s", address)
+		}
+		if masterHost == "" || masterHost == "?" { // unknown endpoint, use the address of the node
+			masterHost = host
+		}
+		masterAddress := net.JoinHostPort(masterHost, strconv.Itoa(masterPort))
+		for i := start; i <= end; i++ {
+			slots[i] = masterAddress
+		}
+	}
+	return slots, nil
+}
+
+// close closes the connection pools
+func (c *cluster) close() error {
+	close(c.closed)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var err error
+	for _, p := range c.pools {
+		if e := p.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
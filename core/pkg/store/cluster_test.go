@@ -0,0 +1,145 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package store
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestCRC16(t *testing.T) {
+	// check value of CRC16-CCITT (XMODEM) from the Redis Cluster specification
+	if got := crc16("123456789"); got != 0x31C3 {
+		t.Errorf("crc16(\"123456789\") = %#x, want 0x31c3", got)
+	}
+	if got := crc16(""); got != 0 {
+		t.Errorf("crc16(\"\") = %#x, want 0", got)
+	}
+}
+
+func TestSlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		// slots reported by CLUSTER KEYSLOT
+		{"foo", 12182},
+		{"bar", 5061},
+		{"hello", 866},
+		{"123456789", 12739},
+		// only the hash tag is hashed
+		{"{foo}", 12182},
+		{"{foo}.following", 12182},
+		{"x{bar}y", 5061},
+		// only the first hash tag is considered
+		{"foo{bar}{zap}", 5061},
+		// the hash tag ends at the first closing brace
+		{"foo{{bar}}zap", slotOf("{bar")},
+		// empty or unterminated hash tags are ignored
+		{"foo{}{bar}", slotOf("foo{}{bar}")},
+		{"{bar", slotOf("{bar")},
+		{"bar}", slotOf("bar}")},
+	}
+	for _, test := range tests {
+		if got := slot(test.key); got != test.want {
+			t.Errorf("slot(%q) = %v, want %v", test.key, got, test.want)
+		}
+	}
+}
+
+// the slot of a key hashed in its entirety
+func slotOf(s string) int {
+	return int(crc16(s) % numSlots)
+}
+
+func TestMangleHashTag(t *testing.T) {
+	sc := &StoreConfig{
+		MangleKey:   func(key string) string { return "kar:" + key },
+		UnmangleKey: func(key string) string { return key[len("kar:"):] },
+	}
+	s := &redisStore{sc: sc, cluster: &cluster{}}
+	tests := []struct {
+		key, mangled string
+	}{
+		{TaggedKey("actor", "state"), "{actor}kar:state"},
+		{TaggedKey("{a_b}_{c}", "state"), "{a_b_c}kar:state"}, // braces are removed from hash tags
+		{"untagged", "{}kar:untagged"},
+		{"un{tag}ged", "{}kar:un{tag}ged"},
+	}
+	for _, test := range tests {
+		mangled := s.mangle(test.key)
+		if mangled != test.mangled {
+			t.Errorf("mangle(%q) = %q, want %q", test.key, mangled, test.mangled)
+		}
+		if key := s.unmangle(mangled); key != test.key {
+			t.Errorf("unmangle(%q) = %q, want %q", mangled, key, test.key)
+		}
+	}
+	if slot(s.mangle(TaggedKey("a_b", "state_a_b"))) != slot(s.mangle(TaggedKey("a_b", "rpc_a_b"))) {
+		t.Errorf("keys with the same hash tag are not stored in the same slot")
+	}
+
+	// hash tags are dropped outside of cluster mode
+	s = &redisStore{sc: sc}
+	if mangled := s.mangle(TaggedKey("actor", "state")); mangled != "kar:state" {
+		t.Errorf("mangle(%q) = %q, want %q", TaggedKey("actor", "state"), mangled, "kar:state")
+	}
+	if key := s.unmangle("kar:state"); key != "state" {
+		t.Errorf("unmangle(%q) = %q, want %q", "kar:state", key, "state")
+	}
+}
+
+func TestRetriable(t *testing.T) {
+	s := &redisStore{sc: &StoreConfig{Mode: RedisCluster}}
+	dial := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	write := &net.OpError{Op: "write", Err: errors.New("broken pipe")}
+	read := &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+	tests := []struct {
+		command string
+		err     error
+		want    bool
+	}{
+		{"EVAL", redis.Error("MOVED 3999 127.0.0.1:6381"), true},
+		{"EVAL", redis.Error("ASK 3999 127.0.0.1:6381"), true},
+		{"EVAL", redis.Error("TRYAGAIN Multiple keys request during rehashing of slot"), true},
+		{"EVAL", redis.Error("CLUSTERDOWN The cluster is down"), true},
+		{"EVAL", redis.Error("READONLY You can't write against a read only replica."), true},
+		{"EVAL", redis.Error("ERR unknown command"), false},
+		{"EVAL", dial, true},
+		{"EVAL", write, true},
+		{"EVAL", read, false}, // the script may have been executed
+		{"EVAL", io.EOF, false},
+		{"HSET", read, false},
+		{"HGET", read, true},
+		{"HGETALL", io.EOF, true},
+	}
+	for _, test := range tests {
+		if got := s.retriable(test.command, test.err); got != test.want {
+			t.Errorf("retriable(%v, %v) = %v, want %v", test.command, test.err, got, test.want)
+		}
+	}
+
+	// network errors are never retried in standalone mode
+	s = &redisStore{sc: &StoreConfig{}}
+	if s.retriable("HGET", dial) {
+		t.Errorf("retriable(HGET, %v) = true in standalone mode, want false", dial)
+	}
+}
@@ -0,0 +1,586 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package store
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errWrongType indicates that an operation was applied to a key holding the wrong kind of value.
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// memoryStore is a Store holding all data in the memory of the process
+// It mimics the semantics of the Redis commands used by the Redis backend
+// Keys are not mangled since the data is private to the process
+type memoryStore struct {
+	lock    sync.Mutex
+	strings map[string]string
+	hashes  map[string]map[string]string
+	zsets   map[string]map[string]int64
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		strings: map[string]string{},
+		hashes:  map[string]map[string]string{},
+		zsets:   map[string]map[string]int64{},
+	}
+}
+
+// exists returns true if key holds a value of any kind
+func (s *memoryStore) exists(key string) bool {
+	if _, ok := s.strings[key]; ok {
+		return true
+	}
+	if _, ok := s.hashes[key]; ok {
+		return true
+	}
+	_, ok := s.zsets[key]
+	return ok
+}
+
+// del deletes key and returns the number of keys deleted
+func (s *memoryStore) del(key string) int {
+	if !s.exists(key) {
+		return 0
+	}
+	delete(s.strings, key)
+	delete(s.hashes, key)
+	delete(s.zsets, key)
+	return 1
+}
+
+// keys returns all keys matching the glob-style pattern, ignoring their hash tags
+func (s *memoryStore) keys(pattern string) []string {
+	re := globToRegexp(pattern)
+	keys := []string{}
+	for k := range s.strings {
+		if re.MatchString(UntaggedKey(k)) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range s.hashes {
+		if re.MatchString(UntaggedKey(k)) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range s.zsets {
+		if re.MatchString(UntaggedKey(k)) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// hash returns the hash stored at key or nil if none; create it if requested
+func (s *memoryStore) hash(key string, create bool) (map[string]string, error) {
+	if h, ok := s.hashes[key]; ok {
+		return h, nil
+	}
+	if s.exists(key) {
+		return nil, errWrongType
+	}
+	if !create {
+		return nil, nil
+	}
+	h := map[string]string{}
+	s.hashes[key] = h
+	return h, nil
+}
+
+// str returns the string stored at key and whether there is one
+func (s *memoryStore) str(key string) (string, bool, error) {
+	if v, ok := s.strings[key]; ok {
+		return v, true, nil
+	}
+	if s.exists(key) {
+		return "", false, errWrongType
+	}
+	return "", false, nil
+}
+
+// cleanup deletes the hash or sorted set at key if empty like Redis does
+func (s *memoryStore) cleanup(key string) {
+	if h, ok := s.hashes[key]; ok && len(h) == 0 {
+		delete(s.hashes, key)
+	}
+	if z, ok := s.zsets[key]; ok && len(z) == 0 {
+		delete(s.zsets, key)
+	}
+}
+
+// globToRegexp converts a Redis glob-style pattern to a regular expression
+func globToRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString("(?s:.*)")
+		case '?':
+			b.WriteString("(?s:.)")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			j := strings.IndexByte(pattern[i+1:], ']')
+			if j < 0 {
+				b.WriteString(regexp.QuoteMeta(pattern[i:]))
+				i = len(pattern)
+				break
+			}
+			class := pattern[i+1 : i+1+j]
+			b.WriteString("[")
+			if strings.HasPrefix(class, "^") {
+				b.WriteString("^")
+				class = class[1:]
+			}
+			b.WriteString(strings.ReplaceAll(class, "\\", "\\\\"))
+			b.WriteString("]")
+			i += j + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+	}
+	return re
+}
+
+// Ping always succeeds.
+func (s *memoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close discards all data.
+func (s *memoryStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.strings = map[string]string{}
+	s.hashes = map[string]map[string]string{}
+	s.zsets = map[string]map[string]int64{}
+	return nil
+}
+
+// Keys
+
+func (s *memoryStore) Set(ctx context.Context, key, value string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.del(key)
+	s.strings[key] = value
+	return "OK", nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	v, ok, err := s.str(key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrNil
+	}
+	return v, nil
+}
+
+func (s *memoryStore) Del(ctx context.Context, key string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.del(key), nil
+}
+
+func (s *memoryStore) CompareAndSet(ctx context.Context, key string, expected, value *string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if expected == nil && value != nil && s.exists(key) { // like SETNX
+		return 0, nil
+	}
+	v, ok, err := s.str(key)
+	if err != nil {
+		return 0, err
+	}
+	if expected == nil && ok || expected != nil && (!ok || v != *expected) {
+		return 0, nil
+	}
+	if value == nil {
+		delete(s.strings, key)
+	} else {
+		s.strings[key] = *value
+	}
+	return 1, nil
+}
+
+func (s *memoryStore) CAS(ctx context.Context, key string, expected string, desired string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	v, ok, err := s.str(key)
+	if err != nil {
+		return "", err
+	}
+	if ok && v == expected || !ok && expected == "" {
+		s.strings[key] = desired
+		return desired, nil
+	}
+	return v, nil
+}
+
+func (s *memoryStore) Keys(ctx context.Context, pattern string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.keys(pattern), nil
+}
+
+func (s *memoryStore) Purge(ctx context.Context, pattern string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	count := 0
+	for _, k := range s.keys(pattern) {
+		count += s.del(k)
+	}
+	return count, nil
+}
+
+// Hashes
+
+func (s *memoryStore) HSetMultiple(ctx context.Context, hash string, keyValuePairs map[string]string) (int, error) {
+	if len(keyValuePairs) == 0 {
+		return 0, nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, err := s.hash(hash, true)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for k, v := range keyValuePairs {
+		if _, ok := h[k]; !ok {
+			added++
+		}
+		h[k] = v
+	}
+	return added, nil
+}
+
+func (s *memoryStore) HReplace(ctx context.Context, hash string, keyValuePairs map[string]string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.del(hash)
+	if len(keyValuePairs) == 0 {
+		return 0, nil
+	}
+	h := make(map[string]string, len(keyValuePairs))
+	for k, v := range keyValuePairs {
+		h[k] = v
+	}
+	s.hashes[hash] = h
+	return len(h), nil
+}
+
+func (s *memoryStore) HUpdate(ctx context.Context, hash, versionKey, expected string, removals []string, updates map[string]string) (int, int, int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, err := s.hash(hash, true)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer s.cleanup(hash)
+	version := 0
+	if versionKey != "" {
+		if v, ok := h[versionKey]; ok {
+			if version, err = strconv.Atoi(v); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+		if !matchVersion(h, versionKey, version, expected) {
+			return 0, 0, version, ErrConflict
+		}
+	}
+	removed := 0
+	for _, k := range removals {
+		if _, ok := h[k]; ok {
+			delete(h, k)
+			removed++
+		}
+	}
+	added := 0
+	for k, v := range updates {
+		if _, ok := h[k]; !ok {
+			added++
+		}
+		h[k] = v
+	}
+	if versionKey != "" && (removed > 0 || len(updates) > 0) {
+		version++
+		h[versionKey] = strconv.Itoa(version)
+	}
+	if _, ok := h[versionKey]; ok && versionKey != "" && len(h) == 1 {
+		delete(h, versionKey)
+		version = 0
+	}
+	return removed, added, version, nil
+}
+
+// matchVersion checks the version of a hash against the expected version, * if the hash must not be empty
+func matchVersion(h map[string]string, versionKey string, version int, expected string) bool {
+	switch expected {
+	case "":
+		return true
+	case "*":
+		_, ok := h[versionKey]
+		if ok {
+			return len(h) > 1
+		}
+		return len(h) > 0
+	default:
+		e, err := strconv.Atoi(expected)
+		return err == nil && e == version
+	}
+}
+
+func (s *memoryStore) HClear(ctx context.Context, hash, versionKey, expected string) (int, int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, err := s.hash(hash, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer s.cleanup(hash)
+	version := 0
+	if v, ok := h[versionKey]; ok {
+		if version, err = strconv.Atoi(v); err != nil {
+			return 0, 0, err
+		}
+	}
+	if !matchVersion(h, versionKey, version, expected) {
+		return 0, version, ErrConflict
+	}
+	removed := len(h)
+	if _, ok := h[versionKey]; ok {
+		removed--
+	}
+	delete(s.hashes, hash)
+	return removed, 0, nil
+}
+
+func (s *memoryStore) HGet(ctx context.Context, hash, key string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, err := s.hash(hash, false)
+	if err != nil {
+		return "", err
+	}
+	v, ok := h[key]
+	if !ok {
+		return "", ErrNil
+	}
+	return v, nil
+}
+
+func (s *memoryStore) HDelMultiple(ctx context.Context, hash string, keys []string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, err := s.hash(hash, false)
+	if err != nil {
+		return 0, err
+	}
+	defer s.cleanup(hash)
+	removed := 0
+	for _, k := range keys {
+		if _, ok := h[k]; ok {
+			delete(h, k)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (s *memoryStore) HMGet(ctx context.Context, hash string, keys []string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, err := s.hash(hash, false)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = h[k]
+	}
+	return values, nil
+}
+
+// HScan returns all the matching entries at once hence always returns a 0 cursor
+func (s *memoryStore) HScan(ctx context.Context, hash string, cursor int, match string) (int, []string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, err := s.hash(hash, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if match == "" {
+		match = "*"
+	}
+	re := globToRegexp(match)
+	ans := []string{}
+	for k, v := range h {
+		if re.MatchString(k) {
+			ans = append(ans, k, v)
+		}
+	}
+	return 0, ans, nil
+}
+
+func (s *memoryStore) HGetAll(ctx context.Context, hash string) (map[string]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, err := s.hash(hash, false)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(h))
+	for k, v := range h {
+		m[k] = v
+	}
+	return m, nil
+}
+
+func (s *memoryStore) HExists(ctx context.Context, hash string, key string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, err := s.hash(hash, false)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := h[key]; ok {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (s *memoryStore) HKeys(ctx context.Context, hash string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, err := s.hash(hash, false)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Sorted sets
+
+// zset returns the sorted set stored at key or nil if none; create it if requested
+func (s *memoryStore) zset(key string, create bool) (map[string]int64, error) {
+	if z, ok := s.zsets[key]; ok {
+		return z, nil
+	}
+	if s.exists(key) {
+		return nil, errWrongType
+	}
+	if !create {
+		return nil, nil
+	}
+	z := map[string]int64{}
+	s.zsets[key] = z
+	return z, nil
+}
+
+func (s *memoryStore) ZAdd(ctx context.Context, key string, score int64, value string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	z, err := s.zset(key, true)
+	if err != nil {
+		return 0, err
+	}
+	_, ok := z[value]
+	z[value] = score
+	if ok {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (s *memoryStore) ZRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	z, err := s.zset(key, false)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, 0, len(z))
+	for m := range z {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if z[members[i]] != z[members[j]] {
+			return z[members[i]] < z[members[j]]
+		}
+		return members[i] < members[j]
+	})
+	n := len(members)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return []string{}, nil
+	}
+	return members[start : stop+1], nil
+}
+
+func (s *memoryStore) ZRemRangeByScore(ctx context.Context, key string, min, max int64) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	z, err := s.zset(key, false)
+	if err != nil {
+		return 0, err
+	}
+	defer s.cleanup(key)
+	removed := 0
+	for m, score := range z {
+		if score >= min && score <= max {
+			delete(z, m)
+			removed++
+		}
+	}
+	return removed, nil
+}
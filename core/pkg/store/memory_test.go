@@ -0,0 +1,336 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package store
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var bg = context.Background()
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestMemoryCompareAndSet(t *testing.T) {
+	tests := []struct {
+		name            string
+		initial         *string // initial string value, nil if absent
+		expected, value *string
+		want            int
+		final           *string
+	}{
+		// SETNX
+		{"create absent", nil, nil, strPtr("a"), 1, strPtr("a")},
+		{"create present", strPtr("a"), nil, strPtr("b"), 0, strPtr("a")},
+		// GET
+		{"check absent", nil, nil, nil, 1, nil},
+		{"check present", strPtr("a"), nil, nil, 0, strPtr("a")},
+		// conditional DEL
+		{"delete match", strPtr("a"), strPtr("a"), nil, 1, nil},
+		{"delete mismatch", strPtr("a"), strPtr("b"), nil, 0, strPtr("a")},
+		{"delete absent", nil, strPtr("a"), nil, 0, nil},
+		// conditional SET
+		{"set match", strPtr("a"), strPtr("a"), strPtr("b"), 1, strPtr("b")},
+		{"set mismatch", strPtr("a"), strPtr("c"), strPtr("b"), 0, strPtr("a")},
+		{"set absent", nil, strPtr("a"), strPtr("b"), 0, nil},
+		{"set empty value absent", nil, strPtr(""), strPtr("b"), 0, nil},
+	}
+	for _, test := range tests {
+		s := newMemoryStore()
+		if test.initial != nil {
+			s.Set(bg, "k", *test.initial)
+		}
+		got, err := s.CompareAndSet(bg, "k", test.expected, test.value)
+		if err != nil || got != test.want {
+			t.Errorf("%s: CompareAndSet returned %v, %v, want %v", test.name, got, err, test.want)
+		}
+		v, err := s.Get(bg, "k")
+		if test.final == nil && err != ErrNil || test.final != nil && (err != nil || v != *test.final) {
+			t.Errorf("%s: Get returned %q, %v after CompareAndSet", test.name, v, err)
+		}
+	}
+
+	// SETNX fails on a key holding another kind of value
+	s := newMemoryStore()
+	s.HSetMultiple(bg, "k", map[string]string{"f": "v"})
+	if got, err := s.CompareAndSet(bg, "k", nil, strPtr("a")); got != 0 || err != nil {
+		t.Errorf("CompareAndSet on a hash returned %v, %v, want 0", got, err)
+	}
+	if _, err := s.CompareAndSet(bg, "k", strPtr("a"), strPtr("b")); err != errWrongType {
+		t.Errorf("CompareAndSet on a hash returned %v, want %v", err, errWrongType)
+	}
+}
+
+func TestMemoryCAS(t *testing.T) {
+	tests := []struct {
+		name              string
+		initial           *string
+		expected, desired string
+		want, final       string
+	}{
+		{"absent", nil, "", "a", "a", "a"},
+		{"absent mismatch", nil, "x", "a", "", ""},
+		{"match", strPtr("a"), "a", "b", "b", "b"},
+		{"mismatch", strPtr("a"), "x", "b", "a", "a"},
+		{"present empty expected", strPtr("a"), "", "b", "a", "a"},
+		{"empty value", strPtr(""), "", "b", "b", "b"},
+	}
+	for _, test := range tests {
+		s := newMemoryStore()
+		if test.initial != nil {
+			s.Set(bg, "k", *test.initial)
+		}
+		got, err := s.CAS(bg, "k", test.expected, test.desired)
+		if err != nil || got != test.want {
+			t.Errorf("%s: CAS returned %q, %v, want %q", test.name, got, err, test.want)
+		}
+		if v, _ := s.Get(bg, "k"); v != test.final {
+			t.Errorf("%s: value is %q after CAS, want %q", test.name, v, test.final)
+		}
+	}
+}
+
+func TestMemoryHUpdate(t *testing.T) {
+	tests := []struct {
+		name                    string
+		initial                 map[string]string
+		versionKey, expected    string
+		removals                []string
+		updates                 map[string]string
+		removed, added, version int
+		conflict                bool
+		final                   map[string]string
+	}{
+		{"unversioned", map[string]string{"a": "1", "b": "2"}, "", "", []string{"a", "x"}, map[string]string{"b": "3", "c": "4"},
+			1, 1, 0, false, map[string]string{"b": "3", "c": "4"}},
+		{"versioned create", nil, "v", "", nil, map[string]string{"a": "1"},
+			0, 1, 1, false, map[string]string{"a": "1", "v": "1"}},
+		{"versioned match", map[string]string{"a": "1", "v": "4"}, "v", "4", []string{"a"}, map[string]string{"b": "2"},
+			1, 1, 5, false, map[string]string{"b": "2", "v": "5"}},
+		{"versioned mismatch", map[string]string{"a": "1", "v": "4"}, "v", "3", []string{"a"}, nil,
+			0, 0, 4, true, map[string]string{"a": "1", "v": "4"}},
+		{"versioned no change", map[string]string{"a": "1", "v": "4"}, "v", "4", []string{"x"}, nil,
+			0, 0, 4, false, map[string]string{"a": "1", "v": "4"}},
+		{"versioned remove last", map[string]string{"a": "1", "v": "4"}, "v", "", []string{"a"}, nil,
+			1, 0, 0, false, nil},
+		{"nonempty match", map[string]string{"a": "1", "v": "4"}, "v", "*", nil, map[string]string{"a": "2"},
+			0, 0, 5, false, map[string]string{"a": "2", "v": "5"}},
+		{"nonempty unversioned match", map[string]string{"a": "1"}, "v", "*", nil, map[string]string{"a": "2"},
+			0, 0, 1, false, map[string]string{"a": "2", "v": "1"}},
+		{"nonempty only version", map[string]string{"v": "4"}, "v", "*", nil, map[string]string{"a": "2"},
+			0, 0, 4, true, map[string]string{"v": "4"}},
+		{"nonempty absent", nil, "v", "*", nil, map[string]string{"a": "2"},
+			0, 0, 0, true, nil},
+		{"absent expected version", nil, "v", "0", nil, map[string]string{"a": "2"},
+			0, 1, 1, false, map[string]string{"a": "2", "v": "1"}},
+		{"invalid expected version", map[string]string{"v": "4"}, "v", "x", nil, map[string]string{"a": "2"},
+			0, 0, 4, true, map[string]string{"v": "4"}},
+		{"unversioned remove all", map[string]string{"a": "1"}, "", "", []string{"a"}, nil,
+			1, 0, 0, false, nil},
+	}
+	for _, test := range tests {
+		s := newMemoryStore()
+		s.HSetMultiple(bg, "h", test.initial)
+		removed, added, version, err := s.HUpdate(bg, "h", test.versionKey, test.expected, test.removals, test.updates)
+		if test.conflict != (err == ErrConflict) || err != nil && err != ErrConflict {
+			t.Errorf("%s: HUpdate returned error %v, want conflict %v", test.name, err, test.conflict)
+		}
+		if removed != test.removed || added != test.added || version != test.version {
+			t.Errorf("%s: HUpdate returned %v, %v, %v, want %v, %v, %v", test.name, removed, added, version, test.removed, test.added, test.version)
+		}
+		final, _ := s.HGetAll(bg, "h")
+		if len(final) == 0 && len(test.final) == 0 {
+			if s.exists("h") {
+				t.Errorf("%s: empty hash not deleted", test.name)
+			}
+		} else if !reflect.DeepEqual(final, test.final) {
+			t.Errorf("%s: hash is %v after HUpdate, want %v", test.name, final, test.final)
+		}
+	}
+}
+
+func TestMemoryHClear(t *testing.T) {
+	s := newMemoryStore()
+	s.HSetMultiple(bg, "h", map[string]string{"a": "1", "b": "2", "v": "4"})
+	if removed, version, err := s.HClear(bg, "h", "v", "3"); err != ErrConflict || removed != 0 || version != 4 {
+		t.Errorf("HClear returned %v, %v, %v, want 0, 4, %v", removed, version, err, ErrConflict)
+	}
+	if removed, version, err := s.HClear(bg, "h", "v", "*"); err != nil || removed != 2 || version != 0 {
+		t.Errorf("HClear returned %v, %v, %v, want 2, 0", removed, version, err)
+	}
+	if s.exists("h") {
+		t.Errorf("cleared hash not deleted")
+	}
+	if removed, version, err := s.HClear(bg, "h", "v", "*"); err != ErrConflict || removed != 0 || version != 0 {
+		t.Errorf("HClear of an absent hash returned %v, %v, %v, want 0, 0, %v", removed, version, err, ErrConflict)
+	}
+	if removed, version, err := s.HClear(bg, "h", "v", ""); err != nil || removed != 0 || version != 0 {
+		t.Errorf("HClear of an absent hash returned %v, %v, %v, want 0, 0", removed, version, err)
+	}
+	s.HSetMultiple(bg, "h", map[string]string{"v": "4"})
+	if removed, _, err := s.HClear(bg, "h", "v", "4"); err != nil || removed != 0 || s.exists("h") {
+		t.Errorf("HClear of a hash holding only a version returned %v, %v", removed, err)
+	}
+}
+
+func TestMemoryHReplace(t *testing.T) {
+	s := newMemoryStore()
+	s.HSetMultiple(bg, "h", map[string]string{"a": "1", "b": "2"})
+	if n, err := s.HReplace(bg, "h", map[string]string{"b": "3", "c": "4"}); err != nil || n != 2 {
+		t.Errorf("HReplace returned %v, %v, want 2", n, err)
+	}
+	if h, _ := s.HGetAll(bg, "h"); !reflect.DeepEqual(h, map[string]string{"b": "3", "c": "4"}) {
+		t.Errorf("hash is %v after HReplace", h)
+	}
+	s.Set(bg, "k", "v")
+	if n, err := s.HReplace(bg, "k", map[string]string{"a": "1"}); err != nil || n != 1 {
+		t.Errorf("HReplace of a string returned %v, %v, want 1", n, err)
+	}
+	if n, err := s.HReplace(bg, "k", nil); err != nil || n != 0 || s.exists("k") {
+		t.Errorf("HReplace with an empty map returned %v, %v and kept the hash", n, err)
+	}
+}
+
+func TestMemoryZRange(t *testing.T) {
+	s := newMemoryStore()
+	s.ZAdd(bg, "z", 3, "c")
+	s.ZAdd(bg, "z", 1, "a")
+	s.ZAdd(bg, "z", 2, "b2")
+	s.ZAdd(bg, "z", 2, "b1") // equal scores are ordered lexicographically
+	if n, _ := s.ZAdd(bg, "z", 0, "c"); n != 0 {
+		t.Errorf("ZAdd of an existing member returned %v, want 0", n)
+	}
+	tests := []struct {
+		start, stop int
+		want        []string
+	}{
+		{0, -1, []string{"c", "a", "b1", "b2"}},
+		{0, 0, []string{"c"}},
+		{1, 2, []string{"a", "b1"}},
+		{-2, -1, []string{"b1", "b2"}},
+		{-10, 1, []string{"c", "a"}},
+		{2, 10, []string{"b1", "b2"}},
+		{3, 3, []string{"b2"}},
+		{4, 10, []string{}},
+		{2, 1, []string{}},
+		{0, -10, []string{}},
+		{-1, -2, []string{}},
+	}
+	for _, test := range tests {
+		got, err := s.ZRange(bg, "z", test.start, test.stop)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ZRange(%v, %v) returned %v, %v, want %v", test.start, test.stop, got, err, test.want)
+		}
+	}
+	if got, err := s.ZRange(bg, "absent", 0, -1); err != nil || len(got) != 0 {
+		t.Errorf("ZRange of an absent key returned %v, %v, want []", got, err)
+	}
+
+	// removing all members deletes the key
+	if n, _ := s.ZRemRangeByScore(bg, "z", 0, 2); n != 4 {
+		t.Errorf("ZRemRangeByScore returned %v, want 4", n)
+	}
+	if s.exists("z") {
+		t.Errorf("empty sorted set not deleted")
+	}
+}
+
+func TestMemoryHScan(t *testing.T) {
+	s := newMemoryStore()
+	s.HSetMultiple(bg, "h", map[string]string{"a1": "1", "a2": "2", "b1": "3"})
+	tests := []struct {
+		match string
+		want  map[string]string
+	}{
+		{"", map[string]string{"a1": "1", "a2": "2", "b1": "3"}},
+		{"*", map[string]string{"a1": "1", "a2": "2", "b1": "3"}},
+		{"a*", map[string]string{"a1": "1", "a2": "2"}},
+		{"?1", map[string]string{"a1": "1", "b1": "3"}},
+		{"[ab]2", map[string]string{"a2": "2"}},
+		{"c*", map[string]string{}},
+	}
+	for _, test := range tests {
+		// iterate like a Redis client until the cursor returns to 0
+		got := map[string]string{}
+		cursor := 0
+		for i := 0; ; i++ {
+			next, entries, err := s.HScan(bg, "h", cursor, test.match)
+			if err != nil {
+				t.Fatalf("HScan(%q) failed: %v", test.match, err)
+			}
+			if len(entries)%2 != 0 {
+				t.Fatalf("HScan(%q) returned an odd number of elements %v", test.match, entries)
+			}
+			for j := 0; j < len(entries); j += 2 {
+				got[entries[j]] = entries[j+1]
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+			if i > len(test.want) {
+				t.Fatalf("HScan(%q) does not terminate", test.match)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("HScan(%q) returned %v, want %v", test.match, got, test.want)
+		}
+	}
+	if cursor, entries, err := s.HScan(bg, "absent", 0, ""); cursor != 0 || len(entries) != 0 || err != nil {
+		t.Errorf("HScan of an absent key returned %v, %v, %v, want 0, []", cursor, entries, err)
+	}
+	s.Set(bg, "k", "v")
+	if _, _, err := s.HScan(bg, "k", 0, ""); err != errWrongType {
+		t.Errorf("HScan of a string returned %v, want %v", err, errWrongType)
+	}
+}
+
+func TestMemoryKeys(t *testing.T) {
+	s := newMemoryStore()
+	s.Set(bg, "kar:a", "1")
+	s.HSetMultiple(bg, "kar:b", map[string]string{"f": "v"})
+	s.ZAdd(bg, "kar:c", 1, "m")
+	s.Set(bg, TaggedKey("tag", "kar:d"), "3") // patterns ignore hash tags
+	s.Set(bg, "other", "2")
+	keys, _ := s.Keys(bg, "kar:*")
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"kar:a", "kar:b", "kar:c", "{tag}kar:d"}) {
+		t.Errorf("Keys returned %v, want [kar:a kar:b kar:c {tag}kar:d]", keys)
+	}
+	if n, _ := s.Purge(bg, "kar:*"); n != 4 {
+		t.Errorf("Purge returned %v, want 4", n)
+	}
+	if keys, _ := s.Keys(bg, "*"); !reflect.DeepEqual(keys, []string{"other"}) {
+		t.Errorf("Keys returned %v after Purge, want [other]", keys)
+	}
+}
+
+func TestDialError(t *testing.T) {
+	backend = newMemoryStore()
+	defer func() { backend = nil }()
+	for _, conf := range []*StoreConfig{{Backend: "unknown"}, {Backend: RedisBackend, Mode: "unknown"}} {
+		if err := Dial(bg, conf); err == nil {
+			t.Errorf("Dial(%+v) succeeded", conf)
+		}
+		if _, ok := backend.(*memoryStore); !ok {
+			t.Errorf("failed Dial(%+v) replaced the backend with %#v", conf, backend)
+		}
+	}
+}
@@ -0,0 +1,649 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package store
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var requestDurationHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "kar_redis_request_durations_histogram_seconds",
+	Help:    "KAR Redis request duration distributions.",
+	Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+})
+
+func init() {
+	prometheus.MustRegister(requestDurationHistogram)
+}
+
+// redisStore is a Store backed by a Redis server, a Redis master discovered by Redis Sentinel, or a Redis Cluster
+type redisStore struct {
+	// connection pool (standalone and sentinel modes)
+	pool *redis.Pool
+
+	// lock held when replacing the connection pool after a failover
+	lock sync.RWMutex
+
+	// cluster topology and connection pools (cluster mode)
+	cluster *cluster
+
+	// options to connect to Redis and to the sentinels
+	options, sentinelOptions []redis.DialOption
+
+	// channel closed when closing the store
+	closed chan struct{}
+
+	// store configuration
+	sc *StoreConfig
+}
+
+// maximum number of consecutive cluster redirections for a command
+const maxRedirections = 16
+
+// connectionPool returns the pool for a node, or for the node serving the key if address is empty
+func (s *redisStore) connectionPool(address, key string) *redis.Pool {
+	if s.cluster == nil {
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		return s.pool
+	}
+	if address == "" {
+		address = s.cluster.address(key)
+	}
+	return s.cluster.pool(address)
+}
+
+func (s *redisStore) getValidConnection(ctx context.Context, address, key string, limit time.Duration) (redis.Conn, error) {
+	conn, err := s.connectionPool(address, key).GetContext(ctx)
+	if err == context.Canceled {
+		return nil, err
+	}
+	if err != nil {
+		b := backoff.NewExponentialBackOff()
+		if limit >= 0 {
+			b.MaxElapsedTime = limit
+		}
+		err = backoff.Retry(func() error {
+			conn.Close()
+			conn, err = s.connectionPool(address, key).GetContext(ctx)
+			if err == ctx.Err() {
+				return backoff.Permanent(err)
+			}
+			return err
+		}, b)
+	}
+	return conn, err
+}
+
+// the key of a command, used to route the command in cluster mode
+func commandKey(command string, args []interface{}) string {
+	if command == "EVAL" {
+		return args[2].(string)
+	}
+	if len(args) > 0 {
+		if key, ok := args[0].(string); ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// commands that can be executed again safely if a connection fails while waiting for the reply
+var readOnlyCommands = map[string]bool{
+	"EXISTS": true, "GET": true, "HEXISTS": true, "HGET": true, "HGETALL": true, "HKEYS": true,
+	"HMGET": true, "HSCAN": true, "KEYS": true, "PING": true, "SCAN": true, "ZRANGE": true,
+}
+
+// retriable returns true if a failed command can be sent again in sentinel or cluster mode,
+// either because the command was rejected without being executed because of a failover or
+// cluster reconfiguration, or because the connection failed before the command was sent,
+// or because the command is read-only.
+// A write command whose reply was lost may have been executed and is never sent again.
+func (s *redisStore) retriable(command string, err error) bool {
+	if e, ok := err.(redis.Error); ok {
+		switch strings.Fields(string(e) + " ")[0] {
+		case "READONLY": // the master was demoted
+			if s.sc.Mode == RedisSentinel {
+				s.resetPool()
+			}
+			return true
+		case "MOVED", "ASK", "TRYAGAIN", "CLUSTERDOWN", "MASTERDOWN", "LOADING":
+			if s.cluster != nil {
+				s.cluster.requestRefresh()
+			}
+			return true
+		}
+		return false
+	}
+	if s.sc.Mode != RedisSentinel && s.sc.Mode != RedisCluster {
+		return false
+	}
+	// network error
+	if s.cluster != nil {
+		s.cluster.requestRefresh()
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "write") {
+		return true // the command was not sent entirely
+	}
+	return readOnlyCommands[command]
+}
+
+// redirection returns the target of a cluster redirection and true for an ASK redirection
+func (s *redisStore) redirection(err error) (string, bool, bool) {
+	e, ok := err.(redis.Error)
+	if !ok || s.cluster == nil {
+		return "", false, false
+	}
+	fields := strings.Fields(string(e)) // MOVED|ASK slot address
+	if len(fields) != 3 || fields[0] != "MOVED" && fields[0] != "ASK" {
+		return "", false, false
+	}
+	if fields[0] == "MOVED" {
+		if slot, err := strconv.Atoi(fields[1]); err == nil && slot >= 0 && slot < numSlots {
+			s.cluster.moved(slot, fields[2])
+		}
+	}
+	return fields[2], fields[0] == "ASK", true
+}
+
+// send a command using a connection from the pool
+func (s *redisStore) doRaw(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	return s.doNode(ctx, "", command, args...)
+}
+
+// send a command to a node, or to the node serving the key of the command if address is empty
+// retry the command if it was redirected or if it failed without being executed
+func (s *redisStore) doNode(ctx context.Context, address string, command string, args ...interface{}) (reply interface{}, err error) {
+	opStart := time.Now()
+	key := commandKey(command, args)
+	target := address
+	asking := false
+	redirections := 0
+	var b *backoff.ExponentialBackOff
+	var connElapsed time.Duration
+	for {
+		conn, connErr := s.getValidConnection(ctx, target, key, s.sc.RequestRetryLimit)
+		if connErr != nil {
+			return nil, connErr
+		}
+		start := time.Now()
+		if asking {
+			conn.Send("ASKING")
+		}
+		reply, err = conn.Do(command, args...)
+		connElapsed = time.Since(start)
+		conn.Close()
+		if err == nil {
+			break
+		}
+		if redirect, ask, ok := s.redirection(err); ok && redirections < maxRedirections {
+			redirections++
+			target, asking = redirect, ask
+			if !ask {
+				target = address // route by key using the updated slot
+			}
+			continue
+		}
+		if !s.retriable(command, err) {
+			panic(fmt.Sprintf("Failed to send command %v to redis: %v", command, err))
+		}
+		if b == nil {
+			b = backoff.NewExponentialBackOff()
+			b.InitialInterval = 50 * time.Millisecond
+			if s.sc.RequestRetryLimit >= 0 {
+				b.MaxElapsedTime = s.sc.RequestRetryLimit
+			}
+		}
+		wait := b.NextBackOff()
+		if wait == backoff.Stop {
+			panic(fmt.Sprintf("Failed to send command %v to redis: %v", command, err))
+		}
+		storeLog.Warning("retrying Redis command %v after error: %v", command, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		target, asking, redirections = address, false, 0
+	}
+	elapsed := time.Since(opStart)
+	requestDurationHistogram.Observe(connElapsed.Seconds())
+	if elapsed > s.sc.LongOperation {
+		storeLog.Error("Slow Redis operation: %v total seconds (%v in conn.Do). Command was %v %v", elapsed.Seconds(), connElapsed.Seconds(), command, args[0])
+	}
+	return
+}
+
+// mangle a key, keeping its hash tag as a prefix in cluster mode and dropping it otherwise
+// keys without a hash tag are prefixed with {} in cluster mode so that the entire key is hashed
+func (s *redisStore) mangle(key string) string {
+	untagged := UntaggedKey(key)
+	if s.cluster == nil {
+		return s.sc.MangleKey(untagged)
+	}
+	tag := key[:len(key)-len(untagged)]
+	if tag == "" {
+		tag = "{}"
+	}
+	return tag + s.sc.MangleKey(untagged)
+}
+
+// mangle a key pattern, matching any hash tag in cluster mode
+func (s *redisStore) manglePattern(pattern string) string {
+	if s.cluster == nil {
+		return s.sc.MangleKey(pattern)
+	}
+	return "{*}" + s.sc.MangleKey(pattern)
+}
+
+// unmangle a key, keeping its hash tag unless empty
+func (s *redisStore) unmangle(key string) string {
+	untagged := UntaggedKey(key)
+	tag := key[:len(key)-len(untagged)]
+	if tag == "{}" {
+		tag = ""
+	}
+	return tag + s.sc.UnmangleKey(untagged)
+}
+
+// mangle the key before sending the command (assuming args[0] is the key)
+func (s *redisStore) do(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	args[0] = s.mangle(args[0].(string))
+	return s.doRaw(ctx, command, args...)
+}
+
+// newPool creates a connection pool
+func (s *redisStore) newPool(dial func() (redis.Conn, error)) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     3,
+		MaxActive:   16,
+		IdleTimeout: 240 * time.Second,
+		Wait:        true,
+		Dial:        dial,
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
+
+// dialRedis connects to Redis.
+func dialRedis(ctx context.Context, sc *StoreConfig) (*redisStore, error) {
+	redisOptions := []redis.DialOption{}
+	sentinelOptions := []redis.DialOption{}
+
+	if sc.EnableTLS {
+		redisOptions = append(redisOptions, redis.DialUseTLS(true))
+		if sc.CA != nil {
+			roots := x509.NewCertPool()
+			roots.AddCert(sc.CA)
+			redisOptions = append(redisOptions, redis.DialTLSConfig(&tls.Config{RootCAs: roots}))
+		}
+		if sc.TLSSkipVerify {
+			redisOptions = append(redisOptions, redis.DialTLSSkipVerify(true))
+		}
+		sentinelOptions = append(sentinelOptions, redisOptions...)
+	}
+	if sc.SentinelPassword != "" {
+		sentinelOptions = append(sentinelOptions, redis.DialPassword(sc.SentinelPassword))
+	}
+	if sc.User != "" {
+		redisOptions = append(redisOptions, redis.DialUsername(sc.User))
+	}
+	if sc.Password != "" {
+		redisOptions = append(redisOptions, redis.DialPassword(sc.Password))
+	}
+	if sc.RequestRetryLimit >= 0 {
+		redisOptions = append(redisOptions, redis.DialConnectTimeout(sc.RequestRetryLimit))
+		redisOptions = append(redisOptions, redis.DialReadTimeout(sc.RequestRetryLimit))
+		redisOptions = append(redisOptions, redis.DialWriteTimeout(sc.RequestRetryLimit))
+		sentinelOptions = append(sentinelOptions, redis.DialConnectTimeout(sc.RequestRetryLimit))
+	}
+
+	address := net.JoinHostPort(sc.Host, strconv.Itoa(sc.Port))
+
+	s := &redisStore{sc: sc, options: redisOptions, sentinelOptions: sentinelOptions, closed: make(chan struct{})}
+	switch sc.Mode {
+	case "", RedisStandalone:
+		s.pool = s.newPool(func() (redis.Conn, error) {
+			return redis.Dial("tcp", address, redisOptions...)
+		})
+	case RedisSentinel:
+		if len(sc.Addresses) == 0 {
+			sc.Addresses = []string{address}
+		}
+		s.pool = s.newPool(s.dialMaster)
+		go s.watchSentinels()
+	case RedisCluster:
+		seeds := sc.Addresses
+		if len(seeds) == 0 {
+			seeds = []string{address}
+		}
+		s.cluster = newCluster(seeds, func(address string) *redis.Pool {
+			return s.newPool(func() (redis.Conn, error) {
+				return redis.Dial("tcp", address, redisOptions...)
+			})
+		})
+	default:
+		return nil, fmt.Errorf("unknown Redis mode %q", sc.Mode)
+	}
+	var limit time.Duration = sc.RequestRetryLimit
+	if limit <= 0 {
+		limit = 30 * time.Second
+	}
+	if s.cluster != nil {
+		b := backoff.NewExponentialBackOff()
+		b.MaxElapsedTime = limit
+		return s, backoff.Retry(s.cluster.refresh, backoff.WithContext(b, ctx))
+	}
+	conn, err := s.getValidConnection(ctx, "", "", limit)
+	if err == nil {
+		defer conn.Close()
+		_, err = conn.Do("PING")
+	}
+	return s, err
+}
+
+// Ping sends a PING command to the server without retrying, waiting at most until the deadline of the context.
+func (s *redisStore) Ping(ctx context.Context) error {
+	timeout := time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	conn, err := s.connectionPool("", "").GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = redis.DoWithTimeout(conn, timeout, "PING")
+	return err
+}
+
+// Close terminates the connection pool.
+func (s *redisStore) Close() error {
+	close(s.closed)
+	if s.cluster != nil {
+		return s.cluster.close()
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.pool.Close()
+}
+
+// Keys
+
+func (s *redisStore) Set(ctx context.Context, key, value string) (string, error) {
+	return redis.String(s.do(ctx, "SET", key, value))
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) (string, error) {
+	return redis.String(s.do(ctx, "GET", key))
+}
+
+func (s *redisStore) Del(ctx context.Context, key string) (int, error) {
+	return redis.Int(s.do(ctx, "DEL", key))
+}
+
+func (s *redisStore) CompareAndSet(ctx context.Context, key string, expected, value *string) (int, error) {
+	if expected == nil && value == nil {
+		_, err := redis.String(s.do(ctx, "GET", key))
+		if err != nil {
+			if err == ErrNil {
+				return 1, nil
+			}
+			return 0, err
+		}
+		return 0, nil
+	}
+	if expected == nil {
+		return redis.Int(s.do(ctx, "SETNX", key, *value))
+	}
+	if value == nil {
+		return redis.Int(s.doRaw(ctx, "EVAL", "if redis.call('GET', KEYS[1]) == ARGV[1] then redis.call('DEL', KEYS[1]); return 1 else return 0 end", 1, s.mangle(key), *expected))
+	}
+	return redis.Int(s.doRaw(ctx, "EVAL", "if redis.call('GET', KEYS[1]) == ARGV[1] then redis.call('SET', KEYS[1], ARGV[2]); return 1 else return 0 end", 1, s.mangle(key), *expected, *value))
+}
+
+func (s *redisStore) CAS(ctx context.Context, key string, expected string, desired string) (string, error) {
+	script := "local v=redis.call('GET', KEYS[1]); if v==ARGV[1] or v==false and ARGV[1]=='' then redis.call('SET', KEYS[1], ARGV[2]); return ARGV[2] else return v end"
+	value, err := redis.String(s.doRaw(ctx, "EVAL", script, 1, s.mangle(key), expected, desired))
+	if err == ErrNil {
+		err = nil
+	}
+	return value, err
+}
+
+// nodes returns the addresses of the masters in cluster mode or a single empty address otherwise
+func (s *redisStore) nodes() []string {
+	if s.cluster == nil {
+		return []string{""}
+	}
+	return s.cluster.masters()
+}
+
+func (s *redisStore) Keys(ctx context.Context, pattern string) ([]string, error) {
+	pattern = s.manglePattern(pattern)
+	keys := []string{}
+	for _, node := range s.nodes() {
+		mangledKeys, err := redis.Strings(s.doNode(ctx, node, "KEYS", pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, val := range mangledKeys {
+			keys = append(keys, s.unmangle(val))
+		}
+	}
+	return keys, nil
+}
+
+func (s *redisStore) Purge(ctx context.Context, pattern string) (int, error) {
+	pattern = s.manglePattern(pattern)
+	bags := [][]interface{}{}
+	for _, node := range s.nodes() {
+		cursor := 0
+		for {
+			reply, err := redis.Values(s.doNode(ctx, node, "SCAN", cursor, "MATCH", pattern, "COUNT", 100))
+			if err != nil {
+				return 0, err
+			}
+			cursor, _ = strconv.Atoi(string(reply[0].([]byte)))
+			keys := reply[1].([]interface{})
+			if len(keys) > 0 {
+				if s.cluster != nil {
+					// keys in different slots cannot be deleted together
+					for _, key := range keys {
+						bags = append(bags, []interface{}{string(key.([]byte))})
+					}
+				} else {
+					bags = append(bags, keys)
+				}
+			}
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+	count := 0
+	for _, keys := range bags {
+		n, err := redis.Int(s.doRaw(ctx, "DEL", keys...))
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// Hashes
+
+func (s *redisStore) HSetMultiple(ctx context.Context, hash string, keyValuePairs map[string]string) (int, error) {
+	nPairs := len(keyValuePairs)
+	if nPairs == 0 {
+		return 0, nil
+	}
+	args := make([]interface{}, 2*nPairs+1)
+	args[0] = hash
+	idx := 1
+	for k, v := range keyValuePairs {
+		args[idx] = k
+		args[idx+1] = v
+		idx += 2
+	}
+	return redis.Int(s.do(ctx, "HSET", args...))
+}
+
+func (s *redisStore) HReplace(ctx context.Context, hash string, keyValuePairs map[string]string) (int, error) {
+	script := "redis.call('DEL', KEYS[1]); for i=1,#ARGV,2 do redis.call('HSET', KEYS[1], ARGV[i], ARGV[i+1]) end; return #ARGV/2"
+	args := make([]interface{}, 0, 3+2*len(keyValuePairs))
+	args = append(args, script, 1, s.mangle(hash))
+	for k, v := range keyValuePairs {
+		args = append(args, k, v)
+	}
+	return redis.Int(s.doRaw(ctx, "EVAL", args...))
+}
+
+func (s *redisStore) HUpdate(ctx context.Context, hash, versionKey, expected string, removals []string, updates map[string]string) (int, int, int, error) {
+	script := "local v=ARGV[1]; local n=tonumber(ARGV[3]); local removed=0; local added=0; local version=0; " +
+		"if v~='' then version=tonumber(redis.call('HGET', KEYS[1], v) or '0'); " +
+		"if ARGV[2]=='*' then if redis.call('HLEN', KEYS[1])<=redis.call('HEXISTS', KEYS[1], v) then return {0, 0, version, 0} end " +
+		"elseif ARGV[2]~='' and tonumber(ARGV[2])~=version then return {0, 0, version, 0} end end; " +
+		"for i=4,n+3 do removed=removed+redis.call('HDEL', KEYS[1], ARGV[i]) end; " +
+		"for i=n+4,#ARGV,2 do added=added+redis.call('HSET', KEYS[1], ARGV[i], ARGV[i+1]) end; " +
+		"if v~='' and (removed>0 or n+4<=#ARGV) then version=redis.call('HINCRBY', KEYS[1], v, 1) end; " +
+		"if v~='' and redis.call('HLEN', KEYS[1])<=redis.call('HEXISTS', KEYS[1], v) then redis.call('DEL', KEYS[1]); version=0 end; " +
+		"return {removed, added, version, 1}"
+	args := make([]interface{}, 0, 6+len(removals)+2*len(updates))
+	args = append(args, script, 1, s.mangle(hash), versionKey, expected, len(removals))
+	for _, k := range removals {
+		args = append(args, k)
+	}
+	for k, v := range updates {
+		args = append(args, k, v)
+	}
+	reply, err := redis.Ints(s.doRaw(ctx, "EVAL", args...))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if reply[3] == 0 {
+		return 0, 0, reply[2], ErrConflict
+	}
+	return reply[0], reply[1], reply[2], nil
+}
+
+func (s *redisStore) HClear(ctx context.Context, hash, versionKey, expected string) (int, int, error) {
+	script := "local v=ARGV[1]; local version=tonumber(redis.call('HGET', KEYS[1], v) or '0'); local removed=0; " +
+		"if ARGV[2]=='*' then if redis.call('HLEN', KEYS[1])<=redis.call('HEXISTS', KEYS[1], v) then return {0, version, 0} end " +
+		"elseif ARGV[2]~='' and tonumber(ARGV[2])~=version then return {0, version, 0} end; " +
+		"removed=redis.call('HLEN', KEYS[1])-redis.call('HEXISTS', KEYS[1], v); redis.call('DEL', KEYS[1]); " +
+		"return {removed, 0, 1}"
+	reply, err := redis.Ints(s.doRaw(ctx, "EVAL", script, 1, s.mangle(hash), versionKey, expected))
+	if err != nil {
+		return 0, 0, err
+	}
+	if reply[2] == 0 {
+		return 0, reply[1], ErrConflict
+	}
+	return reply[0], reply[1], nil
+}
+
+func (s *redisStore) HGet(ctx context.Context, hash, key string) (string, error) {
+	return redis.String(s.do(ctx, "HGET", hash, key))
+}
+
+func (s *redisStore) HDelMultiple(ctx context.Context, hash string, keys []string) (int, error) {
+	args := make([]interface{}, len(keys)+1)
+	args[0] = hash
+	for i := range keys {
+		args[i+1] = keys[i]
+	}
+	return redis.Int(s.do(ctx, "HDEL", args...))
+}
+
+func (s *redisStore) HMGet(ctx context.Context, hash string, keys []string) ([]string, error) {
+	args := make([]interface{}, len(keys)+1)
+	args[0] = hash
+	for i := range keys {
+		args[i+1] = keys[i]
+	}
+	return redis.Strings(s.do(ctx, "HMGET", args...))
+}
+
+func (s *redisStore) HScan(ctx context.Context, hash string, cursor int, match string) (int, []string, error) {
+	var response []interface{}
+	var err error
+	if match != "" {
+		response, err = redis.Values(s.do(ctx, "HSCAN", hash, cursor, "MATCH", match, "COUNT", 1000)) // if we are filtering, increase count by quite a bit to compensate
+	} else {
+		response, err = redis.Values(s.do(ctx, "HSCAN", hash, cursor))
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	cursor, err = strconv.Atoi(string(response[0].([]byte)))
+	if err != nil {
+		return 0, nil, err
+	}
+	data := response[1].([]interface{})
+	ans := make([]string, len(data))
+	for i := range data {
+		ans[i] = string(data[i].([]byte))
+	}
+	return cursor, ans, nil
+}
+
+func (s *redisStore) HGetAll(ctx context.Context, hash string) (map[string]string, error) {
+	return redis.StringMap(s.do(ctx, "HGETALL", hash))
+}
+
+func (s *redisStore) HExists(ctx context.Context, hash string, key string) (int, error) {
+	return redis.Int(s.do(ctx, "HEXISTS", hash, key))
+}
+
+func (s *redisStore) HKeys(ctx context.Context, hash string) ([]string, error) {
+	return redis.Strings(s.do(ctx, "HKEYS", hash))
+}
+
+// Sorted sets
+
+func (s *redisStore) ZAdd(ctx context.Context, key string, score int64, value string) (int, error) {
+	return redis.Int(s.do(ctx, "ZADD", key, score, value))
+}
+
+func (s *redisStore) ZRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	return redis.Strings(s.do(ctx, "ZRANGE", key, start, stop))
+}
+
+func (s *redisStore) ZRemRangeByScore(ctx context.Context, key string, min, max int64) (int, error) {
+	return redis.Int(s.do(ctx, "ZREMRANGEBYSCORE", key, min, max))
+}
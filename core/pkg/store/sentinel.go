@@ -0,0 +1,143 @@
+//
+// Copyright IBM Corporation 2020,2023
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package store
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gomodule/redigo/redis"
+)
+
+// timeout for sentinel queries
+const sentinelTimeout = 5 * time.Second
+
+// sentinelMaster asks the sentinels for the address of the master
+func (s *redisStore) sentinelMaster() (string, error) {
+	err := fmt.Errorf("no sentinel knows master %s", s.sc.MasterName)
+	for _, sentinel := range s.sc.Addresses {
+		conn, dialErr := redis.Dial("tcp", sentinel, s.sentinelOptions...)
+		if dialErr != nil {
+			err = dialErr
+			continue
+		}
+		reply, queryErr := redis.Strings(redis.DoWithTimeout(conn, sentinelTimeout, "SENTINEL", "get-master-addr-by-name", s.sc.MasterName))
+		conn.Close()
+		if queryErr == nil && len(reply) == 2 {
+			return net.JoinHostPort(reply[0], reply[1]), nil
+		}
+		if queryErr != nil && queryErr != redis.ErrNil {
+			err = queryErr
+		}
+	}
+	return "", err
+}
+
+// dialMaster connects to the master discovered by the sentinels
+func (s *redisStore) dialMaster() (redis.Conn, error) {
+	address, err := s.sentinelMaster()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := redis.Dial("tcp", address, s.options...)
+	if err != nil {
+		return nil, err
+	}
+	// the sentinels may not have noticed a failure yet
+	role, err := redis.Values(conn.Do("ROLE"))
+	if err == nil && len(role) > 0 {
+		if r, _ := redis.String(role[0], nil); r != "master" {
+			err = fmt.Errorf("%s is not a master", address)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// resetPool replaces the connection pool after a failover
+func (s *redisStore) resetPool() {
+	s.lock.Lock()
+	pool := s.pool
+	s.pool = s.newPool(s.dialMaster)
+	s.lock.Unlock()
+	pool.Close()
+}
+
+// watchSentinels resets the connection pool when the sentinels switch to a new master
+func (s *redisStore) watchSentinels() {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0
+	for i := 0; ; i++ {
+		sentinel := s.sc.Addresses[i%len(s.sc.Addresses)]
+		err := s.watchSentinel(sentinel, b)
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+		storeLog.Warning("lost connection to Redis sentinel %s: %v", sentinel, err)
+		select {
+		case <-s.closed:
+			return
+		case <-time.After(b.NextBackOff()):
+		}
+	}
+}
+
+// watchSentinel subscribes to the master switches of a sentinel until the connection fails
+func (s *redisStore) watchSentinel(sentinel string, b backoff.BackOff) error {
+	conn, err := redis.Dial("tcp", sentinel, s.sentinelOptions...)
+	if err != nil {
+		return err
+	}
+	psc := redis.PubSubConn{Conn: conn}
+	if err := psc.Subscribe("+switch-master"); err != nil {
+		conn.Close()
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// unblock Receive when closing the store
+		select {
+		case <-s.closed:
+		case <-done:
+		}
+		conn.Close()
+	}()
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Subscription:
+			b.Reset()
+		case redis.Message:
+			// message is: master-name old-ip old-port new-ip new-port
+			fields := strings.Fields(string(v.Data))
+			if len(fields) == 5 && fields[0] == s.sc.MasterName {
+				storeLog.Info("Redis master %s switched to %s", s.sc.MasterName, net.JoinHostPort(fields[3], fields[4]))
+				s.resetPool()
+			}
+		case error:
+			return v
+		}
+	}
+}
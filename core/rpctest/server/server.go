@@ -55,7 +55,9 @@ func exitNode(ctx context.Context, t rpc.Node, v []byte) ([]byte, error) {
 func main() {
 	logger.SetVerbosity("INFO")
 
+	// the memory backend is private to this process: clients connected to it do not see the same state
 	sc := &store.StoreConfig{
+		Backend:           os.Getenv("KAR_STORE_BACKEND"),
 		MangleKey:         func(s string) string { return s },
 		UnmangleKey:       func(s string) string { return s },
 		RequestRetryLimit: -1 * time.Second,
@@ -45,10 +45,19 @@ unset REDIS_HOST
 unset REDIS_PORT
 unset REDIS_PASSWORD
 unset REDIS_USER
+unset REDIS_MODE
+unset REDIS_ADDRESSES
+unset REDIS_MASTER_NAME
+unset REDIS_SENTINEL_PASSWORD
 unset KAFKA_VERSION
 unset KAFKA_ENABLE_TLS
 unset KAFKA_BROKERS
 unset KAFKA_PASSWORD
+unset KAFKA_SASL_MECHANISM
+unset KAFKA_TOKEN_FILE
+unset KAFKA_CA
+unset KAFKA_CLIENT_CERT
+unset KAFKA_CLIENT_KEY
 
 # setup redis env variables
 export REDIS_ENABLE_TLS=true
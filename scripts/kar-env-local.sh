@@ -28,10 +28,19 @@ unset REDIS_HOST
 unset REDIS_PORT
 unset REDIS_PASSWORD
 unset REDIS_USER
+unset REDIS_MODE
+unset REDIS_ADDRESSES
+unset REDIS_MASTER_NAME
+unset REDIS_SENTINEL_PASSWORD
 unset KAFKA_VERSION
 unset KAFKA_ENABLE_TLS
 unset KAFKA_BROKERS
 unset KAFKA_PASSWORD
+unset KAFKA_SASL_MECHANISM
+unset KAFKA_TOKEN_FILE
+unset KAFKA_CA
+unset KAFKA_CLIENT_CERT
+unset KAFKA_CLIENT_KEY
 
 export KAFKA_BROKERS=${KAFKA_DEPLOY_HOST:-localhost}:31093
 export KAFKA_VERSION=3.3